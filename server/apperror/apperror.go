@@ -0,0 +1,175 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Codes that clients can rely on. Every status has a generic code; a few
+// failures that clients handle specially have their own.
+const (
+	CodeBadRequest         = "bad_request"
+	CodeInvalidBody        = "invalid_body"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeSessionExpired     = "session_expired"
+	CodeForbidden          = "forbidden"
+	CodeEmailNotVerified   = "email_not_verified"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodeGone               = "gone"
+	CodeValidationFailed   = "validation_failed"
+	CodeRateLimited        = "rate_limited"
+	CodeInternal           = "internal_error"
+)
+
+// Error is an error a handler returns to end the request with an error
+// response. Err is the underlying cause; it is logged, never sent.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details fiber.Map
+	Fields  map[string]string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithCode returns a copy of the error with a more specific code.
+func (e *Error) WithCode(code string) *Error {
+	copied := *e
+	copied.Code = code
+	return &copied
+}
+
+// WithDetails returns a copy of the error that also sends details.
+func (e *Error) WithDetails(details fiber.Map) *Error {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+// WithFields returns a copy of the error that also sends a message per
+// invalid request field.
+func (e *Error) WithFields(fields map[string]string) *Error {
+	copied := *e
+	copied.Fields = fields
+	return &copied
+}
+
+func New(status int, code string, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func BadRequest(message string) *Error {
+	return New(fiber.StatusBadRequest, CodeBadRequest, message)
+}
+
+// InvalidBody is returned when the request body cannot be parsed at all.
+func InvalidBody() *Error {
+	return New(fiber.StatusBadRequest, CodeInvalidBody, "Invalid request body")
+}
+
+func Unauthorized(message string) *Error {
+	return New(fiber.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+func Forbidden(message string) *Error {
+	return New(fiber.StatusForbidden, CodeForbidden, message)
+}
+
+func NotFound(message string) *Error {
+	return New(fiber.StatusNotFound, CodeNotFound, message)
+}
+
+func Conflict(message string) *Error {
+	return New(fiber.StatusConflict, CodeConflict, message)
+}
+
+func Gone(message string) *Error {
+	return New(fiber.StatusGone, CodeGone, message)
+}
+
+// Unprocessable is for well-formed requests with missing or invalid fields.
+func Unprocessable(message string) *Error {
+	return New(fiber.StatusUnprocessableEntity, CodeValidationFailed, message)
+}
+
+// InvalidField is a validation failure of a single request field.
+func InvalidField(field string, message string) *Error {
+	return Unprocessable(message).WithFields(map[string]string{field: message})
+}
+
+func TooManyRequests(message string) *Error {
+	return New(fiber.StatusTooManyRequests, CodeRateLimited, message)
+}
+
+// Internal reports a server-side failure. message is shown to the client, err
+// only to the logs.
+func Internal(message string, err error) *Error {
+	return &Error{Status: fiber.StatusInternalServerError, Code: CodeInternal, Message: message, Err: err}
+}
+
+// Body is the JSON sent for every error response.
+type Body struct {
+	Code      string            `json:"code"`
+	Message   string            `json:"message"`
+	RequestID string            `json:"requestId"`
+	Details   fiber.Map         `json:"details,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+// Handler is the fiber ErrorHandler. It turns an *Error into its response,
+// keeps the status of a *fiber.Error, and answers anything else with a 500
+// whose cause is logged.
+func Handler(ctx *fiber.Ctx, err error) error {
+	var appErr *Error
+	if !errors.As(err, &appErr) {
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) && fiberErr.Code < fiber.StatusInternalServerError {
+			appErr = New(fiberErr.Code, codeForStatus(fiberErr.Code), fiberErr.Message)
+		} else {
+			appErr = Internal("Internal server error", err)
+		}
+	}
+
+	requestID, _ := ctx.Locals("requestid").(string)
+	if appErr.Status >= fiber.StatusInternalServerError {
+		log.Printf("Request %s %s %s failed: %v", requestID, ctx.Method(), ctx.Path(), appErr)
+	}
+
+	return ctx.Status(appErr.Status).JSON(Body{
+		Code:      appErr.Code,
+		Message:   appErr.Message,
+		RequestID: requestID,
+		Details:   appErr.Details,
+		Fields:    appErr.Fields,
+	})
+}
+
+// codeForStatus names the errors fiber raises itself, such as unknown routes,
+// after their status: "not_found", "method_not_allowed" and so on.
+func codeForStatus(status int) string {
+	switch status {
+	case fiber.StatusUnprocessableEntity:
+		return CodeValidationFailed
+	case fiber.StatusTooManyRequests:
+		return CodeRateLimited
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"blog_post/config"
+	"blog_post/db_aws"
+	"blog_post/generate"
+	"blog_post/migrate"
+	"blog_post/seeds"
+
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const usage = `usage:
+  main                          start the server
+  main migrate up               apply all pending migrations
+  main migrate down [steps]     revert the last migration (or the last steps)
+  main migrate status           list migrations and whether they are applied
+  main migrate create <name>    add an empty migration to MIGRATIONS_DIR
+  main seed [-reset] [set|file...]
+                                load fixture sets or YAML/JSON files (default: demo);
+                                -reset empties the database first (APP_ENV=development only)
+  main seed list                list the bundled fixture sets
+  main generate [flags]         insert synthetic users, posts, threads and likes
+                                for load testing (see main generate -h)`
+
+// runCommand runs the maintenance subcommand named by args and exits.
+func runCommand(cfg config.Config, args []string) {
+	switch args[0] {
+	case "migrate":
+		runMigrate(cfg, args[1:])
+	case "seed":
+		runSeed(cfg, args[1:])
+	case "generate":
+		runGenerate(cfg, args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func runMigrate(cfg config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			log.Fatal("usage: main migrate create <name>")
+		}
+		upPath, downPath, err := migrate.Create(cfg.MigrationsDir, args[1])
+		if err != nil {
+			log.Fatalf("Failed to create migration: %v", err)
+		}
+		fmt.Println("Created", upPath)
+		fmt.Println("Created", downPath)
+		return
+	}
+
+	if err := cfg.ValidateDatabase(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	sqlDB, err := db_aws.Connect(cfg.Database.URL).DB()
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer sqlDB.Close()
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrate.Up(ctx, sqlDB)
+		for _, migration := range applied {
+			fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Nothing to apply")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				log.Fatalf("Invalid number of steps %q", args[1])
+			}
+		}
+		reverted, err := migrate.Down(ctx, sqlDB, steps)
+		for _, migration := range reverted {
+			fmt.Printf("Reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("Nothing to revert")
+		}
+	case "status":
+		statuses, err := migrate.GetStatus(ctx, sqlDB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Local().Format(time.RFC3339)
+			}
+			if status.Missing {
+				state += " (file missing)"
+			}
+			fmt.Printf("%04d_%-40s %s\n", status.Version, status.Name, state)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func runSeed(cfg config.Config, args []string) {
+	if len(args) == 1 && args[0] == "list" {
+		for _, name := range seeds.Sets() {
+			fmt.Println(name)
+		}
+		return
+	}
+
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	reset := flags.Bool("reset", false, "empty the database before seeding (APP_ENV=development only)")
+	flags.Parse(args)
+
+	// Refuse before connecting so that a mistyped command never gets near a
+	// production database.
+	if *reset && !cfg.IsDevelopment() {
+		log.Fatal("Refusing to reset the database: set APP_ENV=development to allow it")
+	}
+
+	sources := flags.Args()
+	if len(sources) == 0 {
+		sources = []string{"demo"}
+	}
+
+	fixtures := []seeds.Fixture{}
+	for _, source := range sources {
+		fixture, err := seeds.Load(source)
+		if err != nil {
+			log.Fatalf("Failed to load fixtures: %v", err)
+		}
+		fixtures = append(fixtures, fixture)
+	}
+
+	if err := cfg.ValidateDatabase(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	db := db_aws.InitDb(cfg.Database.URL)
+
+	if *reset {
+		if err := seeds.Reset(db, cfg.Env); err != nil {
+			log.Fatalf("Failed to reset the database: %v", err)
+		}
+		fmt.Println("Database reset")
+	}
+
+	for i, fixture := range fixtures {
+		summary, err := seeds.Apply(db, fixture, db_aws.Argon2Params(cfg.Argon2))
+		if err != nil {
+			log.Fatalf("Failed to seed %s: %v", sources[i], err)
+		}
+		fmt.Printf("Seeded %s: %d users, %d tags, %d posts, %d comments, %d likes\n", sources[i], summary.Users, summary.Tags, summary.Posts, summary.Comments, summary.Likes)
+	}
+}
+
+func runGenerate(cfg config.Config, args []string) {
+	opts := generate.Options{PasswordParams: db_aws.Argon2Params(cfg.Argon2)}
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	flags.IntVar(&opts.Users, "users", 100, "number of users")
+	flags.IntVar(&opts.Posts, "posts", 1000, "number of posts")
+	flags.IntVar(&opts.Comments, "comments", 10000, "number of comments")
+	flags.IntVar(&opts.Tags, "tags", 25, "number of tags")
+	flags.IntVar(&opts.PostLikes, "post-likes", 20000, "number of post likes")
+	flags.IntVar(&opts.CommentLikes, "comment-likes", 20000, "number of comment likes")
+	flags.IntVar(&opts.MaxDepth, "depth", 8, "maximum nesting of comment threads")
+	flags.Int64Var(&opts.Seed, "seed", 1, "random seed; the same seed produces the same data")
+	flags.IntVar(&opts.BatchSize, "batch", 500, "rows per INSERT")
+	flags.StringVar(&opts.Password, "password", "password", "password of every generated user")
+	flags.Float64Var(&opts.ImageRatio, "image-ratio", 0.3, "share of posts with a placeholder image when -images is set")
+	images := flags.Bool("images", false, "upload placeholder images to S3")
+	flags.Parse(args)
+
+	if *images {
+		store, err := db_aws.NewS3Storage(cfg.Storage)
+		if err != nil {
+			log.Fatalf("Failed to create S3 client: %v", err)
+		}
+		opts.Storage = store
+	}
+
+	if err := cfg.ValidateDatabase(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	db := db_aws.InitDb(cfg.Database.URL)
+
+	started := time.Now()
+	summary, err := generate.Run(context.Background(), db, opts)
+	if err != nil {
+		log.Fatalf("Failed to generate data: %v", err)
+	}
+	fmt.Printf("Generated %d users, %d tags, %d posts (%d images), %d comments, %d post likes and %d comment likes in %s\n",
+		summary.Users, summary.Tags, summary.Posts, summary.Images, summary.Comments, summary.PostLikes, summary.CommentLikes, time.Since(started).Round(time.Millisecond))
+	fmt.Printf("Users sign in as gen-%d-000000@example.test ... with password %q\n", opts.Seed, opts.Password)
+}
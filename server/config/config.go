@@ -0,0 +1,342 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+)
+
+type Database struct {
+	URL string
+}
+
+type Storage struct {
+	Bucket string
+	Region string
+}
+
+type Mail struct {
+	// Transport is "smtp" or "outbox".
+	Transport    string
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	OutboxDir    string
+}
+
+// Argon2 mirrors db_aws.Argon2Params field for field so that one converts
+// to the other.
+type Argon2 struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+}
+
+type RateLimit struct {
+	Max    int
+	Window time.Duration
+}
+
+type Config struct {
+	// Env is APP_ENV: development, production, or anything else for
+	// staging-like environments.
+	Env            string
+	Port           string
+	AppURL         string
+	APIURL         string
+	AllowedOrigins string
+	CookieSecure   bool
+	AdminEmails    string
+	TOTPIssuer     string
+	MigrationsDir  string
+
+	Database      Database
+	Storage       Storage
+	Mail          Mail
+	Argon2        Argon2
+	OIDCProviders []OIDCProvider
+	// RateLimits holds the RATE_LIMIT_<NAME> overrides, keyed by the lower
+	// case name.
+	RateLimits map[string]RateLimit
+
+	DeletedRetention    time.Duration
+	DeletionGracePeriod time.Duration
+	// ReportHideThreshold is the number of distinct reporters that hides a
+	// post; 0 disables hiding.
+	ReportHideThreshold int
+}
+
+func (c Config) IsDevelopment() bool {
+	return c.Env == EnvDevelopment
+}
+
+// source looks settings up in the environment first, then in the optional
+// config file.
+type source struct {
+	file   map[string]string
+	errors []error
+}
+
+func (s *source) lookup(key string) (string, bool) {
+	if value, found := os.LookupEnv(key); found {
+		return value, true
+	}
+	value, found := s.file[key]
+	return value, found
+}
+
+func (s *source) keys() []string {
+	keys := []string{}
+	for _, entry := range os.Environ() {
+		keys = append(keys, strings.SplitN(entry, "=", 2)[0])
+	}
+	for key := range s.file {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (s *source) fail(format string, args ...interface{}) {
+	s.errors = append(s.errors, fmt.Errorf(format, args...))
+}
+
+func (s *source) string(key string, def string) string {
+	if value, found := s.lookup(key); found && value != "" {
+		return value
+	}
+	return def
+}
+
+func (s *source) bool(key string, def bool) bool {
+	value := s.string(key, "")
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		s.fail("%s must be true or false, got %q", key, value)
+		return def
+	}
+	return parsed
+}
+
+func (s *source) int(key string, def int, min int, bits int) int {
+	value := s.string(key, "")
+	if value == "" {
+		return def
+	}
+	parsed, err := strconv.ParseInt(value, 10, bits)
+	if err != nil || int(parsed) < min {
+		s.fail("%s must be a whole number of at least %d, got %q", key, min, value)
+		return def
+	}
+	return int(parsed)
+}
+
+func (s *source) days(key string, def int) time.Duration {
+	return time.Duration(s.int(key, def, 1, 32)) * 24 * time.Hour
+}
+
+// Load reads the configuration from the environment, a .env file in the
+// working directory and the YAML file named by CONFIG_FILE, in that order of
+// precedence. It only reports malformed values; call Validate before serving.
+func Load() (Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, fmt.Errorf("failed to read .env: %v", err)
+	}
+
+	s := &source{file: map[string]string{}}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to read CONFIG_FILE: %v", err)
+		}
+		if err := yaml.Unmarshal(content, &s.file); err != nil {
+			return Config{}, fmt.Errorf("failed to parse CONFIG_FILE %s: %v", path, err)
+		}
+	}
+
+	env := s.string("APP_ENV", EnvProduction)
+	cfg := Config{
+		Env:            env,
+		Port:           s.string("PORT", "12346"),
+		AppURL:         strings.TrimRight(s.string("APP_URL", ""), "/"),
+		APIURL:         strings.TrimRight(s.string("API_URL", ""), "/"),
+		AllowedOrigins: s.string("ALLOWED_ORIGINS", ""),
+		CookieSecure:   s.bool("COOKIE_SECURE", env == EnvProduction),
+		AdminEmails:    s.string("ADMIN_EMAILS", ""),
+		TOTPIssuer:     s.string("TOTP_ISSUER", "blog_post"),
+		MigrationsDir:  s.string("MIGRATIONS_DIR", "migrate/migrations"),
+
+		Database: Database{URL: s.string("DATABASE_URL", "")},
+		Storage: Storage{
+			Bucket: s.string("BUCKET_NAME", ""),
+			Region: s.string("AWS_REGION", "us-east-1"),
+		},
+		Mail: Mail{
+			Transport:    s.string("MAIL_TRANSPORT", "smtp"),
+			From:         s.string("EMAIL", ""),
+			SMTPHost:     s.string("SMTP_HOST", "smtp.gmail.com"),
+			SMTPPort:     s.int("SMTP_PORT", 587, 1, 32),
+			SMTPPassword: s.string("EMAIL_PASSWORD", ""),
+			OutboxDir:    s.string("MAIL_OUTBOX_DIR", ""),
+		},
+		Argon2: Argon2{
+			Memory:      uint32(s.int("ARGON2_MEMORY", 64*1024, 1, 33)),
+			Iterations:  uint32(s.int("ARGON2_ITERATIONS", 3, 1, 33)),
+			Parallelism: uint8(s.int("ARGON2_PARALLELISM", 2, 1, 9)),
+			SaltLength:  uint32(s.int("ARGON2_SALT_LENGTH", 16, 1, 33)),
+			KeyLength:   uint32(s.int("ARGON2_KEY_LENGTH", 32, 1, 33)),
+		},
+		RateLimits: map[string]RateLimit{},
+
+		DeletedRetention:    s.days("DELETED_RETENTION_DAYS", 30),
+		DeletionGracePeriod: s.days("ACCOUNT_DELETION_GRACE_DAYS", 14),
+		ReportHideThreshold: s.int("REPORT_HIDE_THRESHOLD", 5, 0, 32),
+	}
+	cfg.Mail.SMTPUsername = s.string("SMTP_USERNAME", cfg.Mail.From)
+
+	if cfg.Argon2.Memory < 8*uint32(cfg.Argon2.Parallelism) {
+		s.fail("ARGON2_MEMORY must be at least 8 KiB per lane of parallelism")
+	}
+
+	for _, name := range strings.Split(s.string("OIDC_PROVIDERS", ""), ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := OIDCProvider{
+			Name:         name,
+			Issuer:       s.string(prefix+"ISSUER", ""),
+			ClientID:     s.string(prefix+"CLIENT_ID", ""),
+			ClientSecret: s.string(prefix+"CLIENT_SECRET", ""),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			s.fail("OIDC provider %q needs %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+		cfg.OIDCProviders = append(cfg.OIDCProviders, provider)
+	}
+
+	for _, key := range s.keys() {
+		name, found := strings.CutPrefix(key, "RATE_LIMIT_")
+		if !found {
+			continue
+		}
+		value := s.string(key, "")
+		if value == "" {
+			continue
+		}
+		limit, err := parseRateLimit(value)
+		if err != nil {
+			s.fail("%s=%q: %v", key, value, err)
+			continue
+		}
+		cfg.RateLimits[strings.ToLower(name)] = limit
+	}
+
+	return cfg, errors.Join(s.errors...)
+}
+
+func parseRateLimit(value string) (RateLimit, error) {
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return RateLimit{}, errors.New("expected <max>/<window>, e.g. 10/1m")
+	}
+
+	max, err := strconv.Atoi(parts[0])
+	if err != nil || max <= 0 {
+		return RateLimit{}, errors.New("invalid max")
+	}
+
+	window, err := time.ParseDuration(parts[1])
+	if err != nil || window <= 0 {
+		return RateLimit{}, errors.New("invalid window")
+	}
+
+	return RateLimit{Max: max, Window: window}, nil
+}
+
+func checkURL(errs *[]error, key string, value string) {
+	if value == "" {
+		*errs = append(*errs, fmt.Errorf("%s is required", key))
+		return
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		*errs = append(*errs, fmt.Errorf("%s must be an absolute http(s) URL, got %q", key, value))
+	}
+}
+
+// ValidateDatabase checks what commands that only touch the database need.
+func (c Config) ValidateDatabase() error {
+	if c.Database.URL == "" {
+		return errors.New("DATABASE_URL is required")
+	}
+	return nil
+}
+
+// Validate checks that everything the server needs is set, reporting every
+// problem at once.
+func (c Config) Validate() error {
+	errs := []error{}
+	if err := c.ValidateDatabase(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.Storage.Bucket == "" {
+		errs = append(errs, errors.New("BUCKET_NAME is required"))
+	}
+	checkURL(&errs, "APP_URL", c.AppURL)
+	checkURL(&errs, "API_URL", c.APIURL)
+	if c.AllowedOrigins == "" {
+		errs = append(errs, errors.New("ALLOWED_ORIGINS is required"))
+	}
+	if port, err := strconv.Atoi(c.Port); err != nil || port <= 0 || port > 65535 {
+		errs = append(errs, fmt.Errorf("PORT must be a port number, got %q", c.Port))
+	}
+
+	// Accounts are purged with the rest of the deleted content, so a shorter
+	// retention would remove them while they can still be restored.
+	if c.DeletedRetention < c.DeletionGracePeriod {
+		errs = append(errs, fmt.Errorf("DELETED_RETENTION_DAYS (%d) must be at least ACCOUNT_DELETION_GRACE_DAYS (%d)",
+			int(c.DeletedRetention.Hours()/24), int(c.DeletionGracePeriod.Hours()/24)))
+	}
+
+	switch c.Mail.Transport {
+	case "smtp":
+		if c.Mail.From == "" {
+			errs = append(errs, errors.New("EMAIL is required with MAIL_TRANSPORT=smtp"))
+		}
+		if c.Mail.SMTPPassword == "" {
+			errs = append(errs, errors.New("EMAIL_PASSWORD is required with MAIL_TRANSPORT=smtp"))
+		}
+	case "outbox":
+	default:
+		errs = append(errs, fmt.Errorf("MAIL_TRANSPORT must be smtp or outbox, got %q", c.Mail.Transport))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// setValid sets everything Validate requires.
+func setValid(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://localhost/blog")
+	t.Setenv("BUCKET_NAME", "bucket")
+	t.Setenv("APP_URL", "https://blog.example.com")
+	t.Setenv("API_URL", "https://api.blog.example.com")
+	t.Setenv("ALLOWED_ORIGINS", "https://blog.example.com")
+	t.Setenv("MAIL_TRANSPORT", "outbox")
+}
+
+func TestCookieSecureFollowsEnv(t *testing.T) {
+	tests := []struct {
+		env    string
+		secure string
+		want   bool
+	}{
+		{"", "", true},
+		{EnvProduction, "", true},
+		{EnvProduction, "false", false},
+		{EnvDevelopment, "", false},
+		{EnvDevelopment, "true", true},
+		{"staging", "", false},
+	}
+
+	for _, test := range tests {
+		t.Setenv("APP_ENV", test.env)
+		t.Setenv("COOKIE_SECURE", test.secure)
+
+		cfg, err := Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.CookieSecure != test.want {
+			t.Errorf("APP_ENV=%q COOKIE_SECURE=%q: got CookieSecure %v, want %v", test.env, test.secure, cfg.CookieSecure, test.want)
+		}
+	}
+}
+
+func TestValidateRetentionCoversGracePeriod(t *testing.T) {
+	setValid(t)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("defaults rejected: %v", err)
+	}
+
+	t.Setenv("DELETED_RETENTION_DAYS", "7")
+	cfg, err = Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DeletedRetention != 7*24*time.Hour {
+		t.Fatalf("got retention %s", cfg.DeletedRetention)
+	}
+	err = cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "DELETED_RETENTION_DAYS (7) must be at least ACCOUNT_DELETION_GRACE_DAYS (14)") {
+		t.Fatalf("got %v, want the retention to be rejected", err)
+	}
+}
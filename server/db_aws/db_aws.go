@@ -1,19 +1,20 @@
 package db_aws
 
 import (
-	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
 	"log"
-	"mime/multipart"
-	"os"
+	"net/url"
 	"strings"
 	"time"
 
+	appconfig "blog_post/config"
+	"blog_post/migrate"
 	"blog_post/models"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -25,119 +26,212 @@ import (
 	"gorm.io/gorm"
 )
 
-const (
-	memory      = 64 * 1024
-	iterations  = 3
-	parallelism = 2
-	saltLength  = 16
-	keyLength   = 32
-)
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
 
-func GenerateRandomSalt(length int) (string, error) {
+// Hashes written before the PHC format were "salt$hash" and always used these
+// parameters.
+var legacyArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func generateRandomSalt(length uint32) ([]byte, error) {
 	salt := make([]byte, length)
 	if _, err := rand.Read(salt); err != nil {
-		return "", fmt.Errorf("failed to generate random salt: %v", err)
+		return nil, fmt.Errorf("failed to generate random salt: %v", err)
 	}
-	return base64.RawStdEncoding.EncodeToString(salt), nil
+	return salt, nil
 }
 
-func HashPassword(password string) (string, error) {
-	salt, err := GenerateRandomSalt(saltLength)
+// HashPassword hashes password with params, usually the configured ones.
+func HashPassword(password string, params Argon2Params) (string, error) {
+	salt, err := generateRandomSalt(params.SaltLength)
 	if err != nil {
 		return "", err
 	}
 
-	hash := argon2.IDKey([]byte(password), []byte(salt), iterations, memory, uint8(parallelism), keyLength)
+	hash := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
 
-	saltEncoded := base64.RawStdEncoding.EncodeToString([]byte(salt))
-	hashEncoded := base64.RawStdEncoding.EncodeToString(hash)
-
-	return fmt.Sprintf("%s$%s", saltEncoded, hashEncoded), nil
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash),
+	), nil
 }
 
-func VerifyPassword(password string, hashedPassword string) error {
+func decodePasswordHash(hashedPassword string) (Argon2Params, []byte, []byte, error) {
+	params := Argon2Params{}
+
+	if !strings.HasPrefix(hashedPassword, "$") {
+		parts := strings.Split(hashedPassword, "$")
+		if len(parts) != 2 {
+			return params, nil, nil, errors.New("invalid hashed password format")
+		}
+
+		salt, err := base64.RawStdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return params, nil, nil, errors.New("failed to decode salt")
+		}
+
+		hash, err := base64.RawStdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return params, nil, nil, errors.New("failed to decode stored hash")
+		}
+
+		return legacyArgon2Params, salt, hash, nil
+	}
+
 	parts := strings.Split(hashedPassword, "$")
-	if len(parts) != 2 {
-		return errors.New("invalid hashed password format")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errors.New("invalid hashed password format")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errors.New("unsupported argon2 version")
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, errors.New("invalid argon2 parameters")
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errors.New("failed to decode salt")
 	}
 
-	salt, err := base64.RawStdEncoding.DecodeString(parts[0])
+	hash, err := base64.RawStdEncoding.DecodeString(parts[5])
 	if err != nil {
-		return errors.New("failed to decode salt")
+		return params, nil, nil, errors.New("failed to decode stored hash")
 	}
 
-	storedHash, err := base64.RawStdEncoding.DecodeString(parts[1])
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(hash))
+
+	return params, salt, hash, nil
+}
+
+func VerifyPassword(password string, hashedPassword string) error {
+	params, salt, storedHash, err := decodePasswordHash(hashedPassword)
 	if err != nil {
-		return errors.New("failed to decode stored hash")
+		return err
 	}
 
-	computedHash := argon2.IDKey([]byte(password), salt, iterations, memory, uint8(parallelism), keyLength)
+	computedHash := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
 
-	if !bytes.Equal(computedHash, storedHash) {
+	if subtle.ConstantTimeCompare(computedHash, storedHash) != 1 {
 		return errors.New("invalid password")
 	}
 
 	return nil
 }
 
-func NewS3Client() (*s3.Client, error) {
-	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion("us-east-1"))
+// PasswordNeedsRehash reports whether a stored hash is in the legacy format or
+// was made with parameters other than params.
+func PasswordNeedsRehash(hashedPassword string, params Argon2Params) bool {
+	if !strings.HasPrefix(hashedPassword, "$") {
+		return true
+	}
+
+	stored, _, _, err := decodePasswordHash(hashedPassword)
+	if err != nil {
+		return true
+	}
+
+	return stored != params
+}
+
+func NewS3Client(storage appconfig.Storage) (*s3.Client, error) {
+	if storage.Bucket == "" {
+		return nil, fmt.Errorf("no bucket configured")
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(storage.Region))
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %v", err)
 	}
 	return s3.NewFromConfig(cfg), nil
 }
 
-func GetDataFromS3(ctx context.Context, s3Client *s3.Client, key string) (string, error) {
-	bucket := os.Getenv("BUCKET_NAME")
-	if bucket == "" {
-		return "", fmt.Errorf("BUCKET_NAME environment variable is not set")
+// MaxURLExpiry is the longest a presigned URL can stay valid.
+const MaxURLExpiry = 7 * 24 * time.Hour
+
+// S3Storage keeps objects in the configured bucket.
+type S3Storage struct {
+	client *s3.Client
+	bucket string
+}
+
+func NewS3Storage(storage appconfig.Storage) (*S3Storage, error) {
+	client, err := NewS3Client(storage)
+	if err != nil {
+		return nil, err
 	}
+	return &S3Storage{client: client, bucket: storage.Bucket}, nil
+}
 
+func (s *S3Storage) Get(ctx context.Context, key string) ([]byte, error) {
 	input := &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
+		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	}
 
-	result, err := s3Client.GetObject(ctx, input)
+	result, err := s.client.GetObject(ctx, input)
 	if err != nil {
-		return "", fmt.Errorf("Failed to get object: %v", err)
+		return nil, fmt.Errorf("Failed to get object: %v", err)
 	}
 	defer result.Body.Close()
 
 	body, err := io.ReadAll(result.Body)
 	if err != nil {
-		return "", fmt.Errorf("Failed to read object body: %v", err)
+		return nil, fmt.Errorf("Failed to read object body: %v", err)
 	}
 
-	return string(body), nil
+	return body, nil
 }
 
-func StoreDataToS3(ctx context.Context, s3Client *s3.Client, key string, file multipart.File) (string, error) {
-	bucket := os.Getenv("BUCKET_NAME")
-	if bucket == "" {
-		return "", fmt.Errorf("BUCKET_NAME environment variable is not set")
-	}
-
+// Store uploads body and returns a presigned URL that stops working after
+// expires (at most MaxURLExpiry).
+func (s *S3Storage) Store(ctx context.Context, key string, body io.Reader, expires time.Duration) (string, error) {
 	input := &s3.PutObjectInput{
-		Bucket: aws.String(bucket),
+		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
-		Body:   file,
+		Body:   body,
 	}
 
-	_, err := s3Client.PutObject(ctx, input)
+	_, err := s.client.PutObject(ctx, input)
 	if err != nil {
 		return "", fmt.Errorf("Failed to upload object: %v", err)
 	}
 
-	psClient := s3.NewPresignClient(s3Client)
+	psClient := s3.NewPresignClient(s.client)
 	psInput := &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
+		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	}
 
 	psURL, err := psClient.PresignGetObject(ctx, psInput, func(po *s3.PresignOptions) {
-		po.Expires = 7 * 24 * time.Hour
+		po.Expires = expires
 	})
 	if err != nil {
 		return "", fmt.Errorf("Failed to generate presigned URL: %v", err)
@@ -146,18 +240,13 @@ func StoreDataToS3(ctx context.Context, s3Client *s3.Client, key string, file mu
 	return psURL.URL, nil
 }
 
-func DeleteDataFromS3(ctx context.Context, s3Client *s3.Client, key string) error {
-	bucket := os.Getenv("BUCKET_NAME")
-	if bucket == "" {
-		return fmt.Errorf("BUCKET_NAME environment variable is not set")
-	}
-
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
 	input := &s3.DeleteObjectInput{
-		Bucket: aws.String(bucket),
+		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	}
 
-	_, err := s3Client.DeleteObject(ctx, input)
+	_, err := s.client.DeleteObject(ctx, input)
 	if err != nil {
 		return fmt.Errorf("Failed to delete object: %v", err)
 	}
@@ -165,21 +254,46 @@ func DeleteDataFromS3(ctx context.Context, s3Client *s3.Client, key string) erro
 	return nil
 }
 
-func InitDb() *gorm.DB {
-	dsn := os.Getenv("DATABASE_URL")
+// KeyFromURL recovers the object key from a URL returned by Store,
+// for rows saved before keys were stored next to the URL.
+func (s *S3Storage) KeyFromURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	key := strings.TrimPrefix(parsed.Path, "/")
+	if !strings.HasPrefix(parsed.Host, s.bucket+".") {
+		key = strings.TrimPrefix(key, s.bucket+"/")
+	}
+	return key
+}
+
+// Connect opens the database without touching the schema.
+func Connect(dsn string) *gorm.DB {
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
+	return db
+}
+
+// InitDb connects and applies any pending migrations.
+func InitDb(dsn string) *gorm.DB {
+	db := Connect(dsn)
 
-	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\"").Error; err != nil {
-		log.Fatalf("Failed to enable UUID extension: %v", err)
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
-	err = db.AutoMigrate(&models.User{}, &models.Post{}, &models.Comment{}, &models.PostLike{}, &models.CommentLike{}, &models.Code{})
+	applied, err := migrate.Up(context.Background(), sqlDB)
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
+	for _, migration := range applied {
+		log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+	}
 
 	return db
 }
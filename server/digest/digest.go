@@ -0,0 +1,184 @@
+package digest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"blog_post/mailer"
+	"blog_post/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	Daily  = "daily"
+	Weekly = "weekly"
+	Off    = "off"
+)
+
+var digestPeriods = map[string]time.Duration{
+	Daily:  24 * time.Hour,
+	Weekly: 7 * 24 * time.Hour,
+}
+
+type Item struct {
+	Summary   string
+	PostTitle string
+}
+
+type Data struct {
+	FirstName      string
+	Frequency      string
+	Since          time.Time
+	Items          []Item
+	UnsubscribeURL string
+}
+
+func newUnsubscribeToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate unsubscribe token: %v", err)
+	}
+	return hex.EncodeToString(token), nil
+}
+
+func GetOrCreatePreference(db *gorm.DB, userID string) (models.EmailPreference, error) {
+	preference := models.EmailPreference{}
+	if err := db.Where("user_id = ?", userID).Limit(1).Find(&preference).Error; err != nil {
+		return preference, err
+	}
+	if preference.UserID != "" {
+		return preference, nil
+	}
+
+	token, err := newUnsubscribeToken()
+	if err != nil {
+		return preference, err
+	}
+
+	preference = models.EmailPreference{UserID: userID, Digest: Weekly, UnsubscribeToken: token}
+	if err := db.Omit("User").Create(&preference).Error; err != nil {
+		return preference, err
+	}
+
+	return preference, nil
+}
+
+func UnsubscribeURL(apiURL string, token string) string {
+	return fmt.Sprintf("%s/blog_post/unsubscribe/%s", apiURL, token)
+}
+
+func Start(db *gorm.DB, mail mailer.Mailer, apiURL string) {
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := SendDue(db, mail, apiURL, time.Now()); err != nil {
+				log.Printf("Failed to send digests: %v", err)
+			}
+		}
+	}()
+}
+
+func SendDue(db *gorm.DB, mail mailer.Mailer, apiURL string, now time.Time) error {
+	users := []models.User{}
+	return db.Select("id", "first_name", "email").Where("email_verified = ?", true).FindInBatches(&users, 100, func(tx *gorm.DB, batch int) error {
+		for _, user := range users {
+			preference, err := GetOrCreatePreference(db, user.ID)
+			if err != nil {
+				log.Printf("Failed to load email preference for user %s: %v", user.ID, err)
+				continue
+			}
+
+			if err := sendIfDue(db, mail, apiURL, user, preference, now); err != nil {
+				log.Printf("Failed to send digest to user %s: %v", user.ID, err)
+			}
+		}
+		return nil
+	}).Error
+}
+
+func sendIfDue(db *gorm.DB, mail mailer.Mailer, apiURL string, user models.User, preference models.EmailPreference, now time.Time) error {
+	period, ok := digestPeriods[preference.Digest]
+	if !ok {
+		return nil
+	}
+
+	since := now.Add(-period)
+	if preference.LastDigestAt != nil {
+		if now.Sub(*preference.LastDigestAt) < period {
+			return nil
+		}
+		since = *preference.LastDigestAt
+	}
+
+	notifications := []models.Notification{}
+	if err := db.Preload("Post").Preload("Actors", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at DESC").Preload("User")
+	}).Where("user_id = ? AND updated_at > ?", user.ID, since).Order("updated_at DESC").Find(&notifications).Error; err != nil {
+		return err
+	}
+
+	if len(notifications) > 0 {
+		data := Data{
+			FirstName:      user.FirstName,
+			Frequency:      preference.Digest,
+			Since:          since,
+			UnsubscribeURL: UnsubscribeURL(apiURL, preference.UnsubscribeToken),
+		}
+		for _, notification := range notifications {
+			data.Items = append(data.Items, Item{Summary: notification.Summary(), PostTitle: notification.Post.Title})
+		}
+
+		subject := fmt.Sprintf("Your %s activity digest", preference.Digest)
+		msg, err := mailer.NewMessage(user.Email, subject, "digest", data)
+		if err != nil {
+			return err
+		}
+		// Mail clients unsubscribe by POSTing List-Unsubscribe=One-Click to
+		// the List-Unsubscribe URL (RFC 8058). Opening the same URL only asks
+		// for confirmation, so link scanners cannot unsubscribe anyone.
+		msg.Headers = map[string]string{
+			"List-Unsubscribe":      fmt.Sprintf("<%s>", data.UnsubscribeURL),
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		}
+
+		if err := mail.Send(msg); err != nil {
+			return err
+		}
+	}
+
+	return db.Model(&models.EmailPreference{}).Where("user_id = ?", user.ID).Update("last_digest_at", now).Error
+}
+
+// UnsubscribeTokenExists reports whether token belongs to a preference.
+func UnsubscribeTokenExists(db *gorm.DB, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+
+	var count int64
+	err := db.Model(&models.EmailPreference{}).Where("unsubscribe_token = ?", token).Count(&count).Error
+	return count > 0, err
+}
+
+func Unsubscribe(db *gorm.DB, token string) error {
+	if token == "" {
+		return errors.New("missing unsubscribe token")
+	}
+
+	result := db.Model(&models.EmailPreference{}).Where("unsubscribe_token = ?", token).Update("digest", Off)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("invalid unsubscribe token")
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package e2e
+
+import (
+	"net/http"
+	"testing"
+
+	"blog_post/models"
+)
+
+func TestSignUpWithTheEmailOfADeletedAccount(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.signUp("Alice", "alice@example.com", password)
+
+	expectStatus(t, alice.send(http.MethodDelete, "/auth/deleteUser", map[string]string{"password": password}), http.StatusAccepted)
+	app.mail.waitFor(t, alice.email, "scheduled for deletion")
+
+	res := app.newClient().send(http.MethodPost, "/auth/signUp", map[string]string{
+		"firstName": "Alice",
+		"lastName":  "Again",
+		"email":     alice.email,
+		"password":  password,
+	})
+	expectStatus(t, res, http.StatusAccepted)
+
+	// The owner is told instead, with a link that gets the account back.
+	msg := app.mail.waitFor(t, alice.email, "deleted account")
+	match := verifyTokenPattern.FindStringSubmatch(msg.Text)
+	if match == nil {
+		t.Fatalf("no cancel link in %q", msg.Text)
+	}
+	expectStatus(t, app.newClient().send(http.MethodPost, "/auth/cancelDeletion", map[string]string{"token": match[1]}), http.StatusOK)
+	alice.signIn(password)
+
+	var accounts int64
+	app.db.Unscoped().Model(&models.User{}).Where("email = ?", alice.email).Count(&accounts)
+	if accounts != 1 {
+		t.Fatalf("got %d accounts for the email, want 1", accounts)
+	}
+}
@@ -0,0 +1,76 @@
+package e2e
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+
+	"blog_post/models"
+)
+
+func TestConcurrentDemotionsKeepAnAdmin(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.signUp("Alice", "alice@example.com", password)
+	bob := app.signUp("Bob", "bob@example.com", password)
+
+	for round := 0; round < 5; round++ {
+		if err := app.db.Model(&models.User{}).Where("id IN ?", []string{alice.userID, bob.userID}).
+			Update("role", models.RoleAdmin).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		// Each admin demotes the other at the same time.
+		statuses := make([]int, 2)
+		var wg sync.WaitGroup
+		for i, pair := range [][2]*client{{alice, bob}, {bob, alice}} {
+			wg.Add(1)
+			go func(i int, actor *client, target *client) {
+				defer wg.Done()
+				statuses[i] = actor.send(http.MethodPut, "/admin/users/"+target.userID+"/role", map[string]string{"role": "user"}).status
+			}(i, pair[0], pair[1])
+		}
+		wg.Wait()
+
+		var admins int64
+		if err := app.db.Model(&models.User{}).Where("role = ?", models.RoleAdmin).Count(&admins).Error; err != nil {
+			t.Fatal(err)
+		}
+		if admins != 1 {
+			t.Fatalf("round %d: %d admins left, statuses %v", round, admins, statuses)
+		}
+
+		// The second request either lost the race on the lock or was made by
+		// an admin who had just been demoted.
+		sort.Ints(statuses)
+		if statuses[0] != http.StatusOK || (statuses[1] != http.StatusForbidden && statuses[1] != http.StatusConflict) {
+			t.Fatalf("round %d: got statuses %v", round, statuses)
+		}
+	}
+}
+
+func TestModerationActionsOutliveTheirActor(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.signUp("Alice", "alice@example.com", password)
+	bob := app.signUp("Bob", "bob@example.com", password)
+	if err := app.db.Model(&models.User{}).Where("id = ?", alice.userID).Update("role", models.RoleAdmin).Error; err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, alice.send(http.MethodPut, "/admin/users/"+bob.userID+"/role", map[string]string{"role": models.RoleModerator}), http.StatusOK)
+
+	// The purge job removes the row of a deleted account for good.
+	if err := app.db.Unscoped().Delete(&models.User{ID: alice.userID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	res := bob.send(http.MethodGet, "/admin/moderationActions?targetId="+bob.userID, nil)
+	expectStatus(t, res, http.StatusOK)
+	var actions []struct {
+		Action string                 `json:"action"`
+		Actor  map[string]interface{} `json:"actor"`
+	}
+	res.decode(t, &actions)
+	if len(actions) != 1 || actions[0].Actor != nil {
+		t.Fatalf("got moderation actions %+v, want the role change without its actor", actions)
+	}
+}
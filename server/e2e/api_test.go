@@ -0,0 +1,385 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"blog_post/apperror"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const password = "correct horse battery staple"
+
+func TestSignUpAndSignIn(t *testing.T) {
+	app := newTestApp(t)
+
+	alice := app.signUp("Alice", "alice@example.com", password)
+	if alice.userID == "" {
+		t.Fatal("sign-in returned no user ID")
+	}
+
+	res := alice.send(http.MethodGet, "/auth/userInfo/"+alice.userID, nil)
+	expectStatus(t, res, http.StatusOK)
+	var info struct {
+		FirstName     string `json:"firstName"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"emailVerified"`
+	}
+	res.decode(t, &info)
+	if info.FirstName != "Alice" || info.Email != "alice@example.com" || !info.EmailVerified {
+		t.Fatalf("unexpected user info %+v", info)
+	}
+
+	stranger := app.newClient()
+	res = stranger.send(http.MethodPost, "/auth/signIn", map[string]string{"email": "alice@example.com", "password": "wrong"})
+	expectStatus(t, res, http.StatusUnauthorized)
+	expectStatus(t, stranger.send(http.MethodGet, "/posts", nil), http.StatusUnauthorized)
+
+	res = stranger.send(http.MethodPost, "/auth/signUp", map[string]string{
+		"firstName": "Mallory",
+		"lastName":  "Tester",
+		"email":     "alice@example.com",
+		"password":  password,
+	})
+	expectStatus(t, res, http.StatusAccepted)
+	app.mail.waitFor(t, "alice@example.com", "Sign-up attempt")
+
+	expectStatus(t, alice.send(http.MethodPost, "/auth/signOut", nil), http.StatusOK)
+	expectStatus(t, alice.send(http.MethodGet, "/posts", nil), http.StatusUnauthorized)
+
+	alice.signIn(password)
+	expectStatus(t, alice.send(http.MethodGet, "/posts", nil), http.StatusOK)
+}
+
+func TestPostCRUDWithTags(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.signUp("Alice", "alice@example.com", password)
+	bob := app.signUp("Bob", "bob@example.com", password)
+
+	created := alice.addPost("First post", "Hello", "go", "postgres")
+	if got := created.tagNames(); !sameNames(got, "go", "postgres") {
+		t.Fatalf("got tags %v", got)
+	}
+	if created.User.ID != alice.userID || created.ImageURL == "" {
+		t.Fatalf("unexpected post %+v", created)
+	}
+	originalKeys := app.storage.Keys()
+	if len(originalKeys) != 1 {
+		t.Fatalf("got stored objects %v, want the post image", originalKeys)
+	}
+
+	res := alice.send(http.MethodGet, "/tags", nil)
+	expectStatus(t, res, http.StatusOK)
+	tags := []tag{}
+	res.decode(t, &tags)
+	if got := tagNames(tags); !sameNames(got, "go", "postgres") {
+		t.Fatalf("got tags %v", got)
+	}
+
+	update := url.Values{"title": {"Edited post"}, "body": {"Hello again"}, "tags[]": {"postgres", "testing"}}
+	expectStatus(t, bob.sendForm(http.MethodPut, "/posts/"+created.ID, update, ""), http.StatusForbidden)
+	expectStatus(t, alice.sendForm(http.MethodPut, "/posts/"+created.ID, update, "new-cover.png"), http.StatusOK)
+
+	updated := bob.findPostByID(created.ID)
+	if updated.Title != "Edited post" || updated.Body != "Hello again" {
+		t.Fatalf("post not updated: %+v", updated)
+	}
+	if got := updated.tagNames(); !sameNames(got, "postgres", "testing") {
+		t.Fatalf("got tags %v", got)
+	}
+	if keys := app.storage.Keys(); len(keys) != 1 || keys[0] == originalKeys[0] {
+		t.Fatalf("got stored objects %v, want only the new image", keys)
+	}
+
+	expectStatus(t, bob.send(http.MethodDelete, "/posts/"+created.ID, nil), http.StatusForbidden)
+	expectStatus(t, alice.send(http.MethodDelete, "/posts/"+created.ID, nil), http.StatusOK)
+	if posts := bob.posts(); len(posts) != 0 {
+		t.Fatalf("deleted post is still listed: %+v", posts)
+	}
+	expectStatus(t, alice.send(http.MethodDelete, "/posts/"+created.ID, nil), http.StatusNotFound)
+}
+
+func TestCommentThreading(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.signUp("Alice", "alice@example.com", password)
+	bob := app.signUp("Bob", "bob@example.com", password)
+
+	p := alice.addPost("Threads", "Discuss", "go")
+	root := bob.addComment(p.ID, "First!", nil)
+	reply := alice.addComment(p.ID, "Welcome", &root.ID)
+	if reply.ParentID == nil || *reply.ParentID != root.ID {
+		t.Fatalf("reply has parent %v, want %s", reply.ParentID, root.ID)
+	}
+
+	res := alice.send(http.MethodPut, "/posts/"+p.ID+"/comments/"+root.ID, map[string]string{"message": "Edited"})
+	expectStatus(t, res, http.StatusForbidden)
+	res = bob.send(http.MethodPut, "/posts/"+p.ID+"/comments/"+root.ID, map[string]string{"message": "First, edited"})
+	expectStatus(t, res, http.StatusOK)
+
+	expectStatus(t, bob.send(http.MethodDelete, "/posts/"+p.ID+"/comments/"+root.ID, nil), http.StatusOK)
+	comments := alice.findPostByID(p.ID).Comments
+	if len(comments) != 2 {
+		t.Fatalf("got %d comments, want the placeholder and the reply", len(comments))
+	}
+	for _, comment := range comments {
+		switch comment.ID {
+		case root.ID:
+			if !comment.Deleted || comment.Message != "[deleted]" {
+				t.Fatalf("deleted parent is not a placeholder: %+v", comment)
+			}
+		case reply.ID:
+			if comment.Deleted || comment.Message != "Welcome" {
+				t.Fatalf("reply changed: %+v", comment)
+			}
+		default:
+			t.Fatalf("unexpected comment %+v", comment)
+		}
+	}
+
+	expectStatus(t, alice.send(http.MethodDelete, "/posts/"+p.ID+"/comments/"+reply.ID, nil), http.StatusOK)
+	if comments := alice.findPostByID(p.ID).Comments; len(comments) != 0 {
+		t.Fatalf("deleted thread is still listed: %+v", comments)
+	}
+}
+
+func TestLikeToggling(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.signUp("Alice", "alice@example.com", password)
+	bob := app.signUp("Bob", "bob@example.com", password)
+
+	p := alice.addPost("Likeable", "Like me", "go")
+	c := alice.addComment(p.ID, "Like me too", nil)
+
+	expectStatus(t, bob.send(http.MethodPost, "/posts/"+p.ID+"/toggleLike", nil), http.StatusOK)
+	expectStatus(t, bob.send(http.MethodPost, "/posts/"+p.ID+"/comments/"+c.ID+"/toggleLike", nil), http.StatusOK)
+
+	liked := bob.findPostByID(p.ID)
+	if liked.LikeCount != 1 || !liked.LikedByMe {
+		t.Fatalf("post like not recorded: %+v", liked)
+	}
+	if got := liked.Comments[0]; got.LikeCount != 1 || !got.LikedByMe {
+		t.Fatalf("comment like not recorded: %+v", got)
+	}
+	if seen := alice.findPostByID(p.ID); seen.LikeCount != 1 || seen.LikedByMe || seen.Comments[0].LikedByMe {
+		t.Fatalf("likes attributed to the wrong user: %+v", seen)
+	}
+
+	expectStatus(t, bob.send(http.MethodPost, "/posts/"+p.ID+"/toggleLike", nil), http.StatusOK)
+	expectStatus(t, bob.send(http.MethodPost, "/posts/"+p.ID+"/comments/"+c.ID+"/toggleLike", nil), http.StatusOK)
+
+	unliked := bob.findPostByID(p.ID)
+	if unliked.LikeCount != 0 || unliked.LikedByMe || unliked.Comments[0].LikeCount != 0 || unliked.Comments[0].LikedByMe {
+		t.Fatalf("likes not removed: %+v", unliked)
+	}
+}
+
+func TestDoubleClickedLikes(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.signUp("Alice", "alice@example.com", password)
+	bob := app.signUp("Bob", "bob@example.com", password)
+
+	p := alice.addPost("Likeable", "Like me", "go")
+	c := alice.addComment(p.ID, "Like me too", nil)
+
+	// Both clicks may find no like and insert one; neither may fail.
+	for _, path := range []string{"/posts/" + p.ID + "/toggleLike", "/posts/" + p.ID + "/comments/" + c.ID + "/toggleLike"} {
+		statuses := make([]int, 2)
+		var wg sync.WaitGroup
+		for i := range statuses {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				statuses[i] = bob.send(http.MethodPost, path, nil).status
+			}(i)
+		}
+		wg.Wait()
+		if statuses[0] != http.StatusOK || statuses[1] != http.StatusOK {
+			t.Fatalf("%s returned %v", path, statuses)
+		}
+	}
+}
+
+func TestWebSocketEvents(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.signUp("Alice", "alice@example.com", password)
+	bob := app.signUp("Bob", "bob@example.com", password)
+
+	aliceEvents := alice.connect()
+	bobEvents := bob.connect()
+
+	p := alice.addPost("Live", "Watch this", "go")
+	var added struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	}
+	bobEvents.expect("POST_ADDED", &added)
+	if added.ID != p.ID || added.Title != "Live" {
+		t.Fatalf("unexpected POST_ADDED %+v", added)
+	}
+
+	expectStatus(t, bob.send(http.MethodPost, "/posts/"+p.ID+"/toggleLike", nil), http.StatusOK)
+	var like struct {
+		ID      string `json:"id"`
+		AddLike bool   `json:"addLike"`
+		UserID  string `json:"userId"`
+	}
+	aliceEvents.expect("POST_LIKED", &like)
+	if like.ID != p.ID || !like.AddLike || like.UserID != bob.userID {
+		t.Fatalf("unexpected POST_LIKED %+v", like)
+	}
+
+	// Notifications only go to the recipient's own connections.
+	var notification struct {
+		UnreadCount int `json:"unreadCount"`
+	}
+	aliceEvents.expect("NOTIFICATION", &notification)
+	if notification.UnreadCount != 1 {
+		t.Fatalf("got %d unread notifications, want 1", notification.UnreadCount)
+	}
+
+	c := bob.addComment(p.ID, "Nice", nil)
+	var commentAdded struct {
+		PostID  string `json:"postId"`
+		Comment struct {
+			ID string `json:"id"`
+		} `json:"comment"`
+	}
+	aliceEvents.expect("COMMENT_ADDED", &commentAdded)
+	if commentAdded.PostID != p.ID || commentAdded.Comment.ID != c.ID {
+		t.Fatalf("unexpected COMMENT_ADDED %+v", commentAdded)
+	}
+
+	expectStatus(t, alice.send(http.MethodDelete, "/posts/"+p.ID, nil), http.StatusOK)
+	var deleted struct {
+		ID string `json:"id"`
+	}
+	bobEvents.expect("POST_DELETED", &deleted)
+	if deleted.ID != p.ID {
+		t.Fatalf("unexpected POST_DELETED %+v", deleted)
+	}
+	if bobEvents.received("NOTIFICATION") {
+		t.Fatal("Bob received a notification meant for Alice")
+	}
+}
+
+func TestErrorResponses(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.signUp("Alice", "alice@example.com", password)
+	stranger := app.newClient()
+
+	stranger.send(http.MethodGet, "/posts", nil).expectError(t, http.StatusUnauthorized, apperror.CodeUnauthorized)
+	stranger.send(http.MethodGet, "/nowhere", nil).expectError(t, http.StatusNotFound, apperror.CodeNotFound)
+
+	res := stranger.send(http.MethodPost, "/auth/signIn", map[string]string{"email": "alice@example.com", "password": "wrong"})
+	body := res.expectError(t, http.StatusUnauthorized, apperror.CodeInvalidCredentials)
+	if body.Message != "Invalid email or password" {
+		t.Fatalf("got message %q", body.Message)
+	}
+
+	res = alice.do(http.MethodPost, "/auth/signIn", fiber.MIMEApplicationJSON, strings.NewReader("{"))
+	res.expectError(t, http.StatusBadRequest, apperror.CodeInvalidBody)
+
+	res = alice.sendForm(http.MethodPost, "/posts/", url.Values{"title": {"No body"}}, "cover.png")
+	res.expectError(t, http.StatusUnprocessableEntity, apperror.CodeValidationFailed)
+
+	alice.send(http.MethodDelete, "/posts/"+uuid.New().String(), nil).expectError(t, http.StatusNotFound, apperror.CodeNotFound)
+
+	first := alice.send(http.MethodGet, "/nowhere", nil).expectError(t, http.StatusNotFound, apperror.CodeNotFound)
+	second := alice.send(http.MethodGet, "/nowhere", nil).expectError(t, http.StatusNotFound, apperror.CodeNotFound)
+	if first.RequestID == second.RequestID {
+		t.Fatalf("requests share the ID %s", first.RequestID)
+	}
+}
+
+func TestRequestValidation(t *testing.T) {
+	app := newTestApp(t)
+	stranger := app.newClient()
+
+	res := stranger.send(http.MethodPost, "/auth/signUp", map[string]string{
+		"firstName": strings.Repeat("a", 101),
+		"lastName":  "  ",
+		"email":     "not-an-email",
+		"password":  "short",
+	})
+	body := res.expectError(t, http.StatusUnprocessableEntity, apperror.CodeValidationFailed)
+	want := map[string]string{
+		"firstName": "firstName must be at most 100 characters",
+		"lastName":  "lastName is required",
+		"email":     "email must be a valid email address",
+		"password":  "password must be at least 8 characters",
+	}
+	if !reflect.DeepEqual(body.Fields, want) {
+		t.Fatalf("got fields %v, want %v", body.Fields, want)
+	}
+	if body.Message != want["firstName"] {
+		t.Fatalf("got message %q, want the first field error", body.Message)
+	}
+
+	// Emails are trimmed and lowercased, so any casing signs in.
+	alice := app.newClient()
+	res = alice.send(http.MethodPost, "/auth/signUp", map[string]string{
+		"firstName": "  Alice ",
+		"lastName":  "Tester",
+		"email":     " Alice@Example.COM",
+		"password":  password,
+	})
+	expectStatus(t, res, http.StatusAccepted)
+	msg := app.mail.waitFor(t, "alice@example.com", "Verify your email")
+	token := verifyTokenPattern.FindStringSubmatch(msg.Text)[1]
+	expectStatus(t, alice.send(http.MethodPost, "/auth/verifyEmail", map[string]string{"token": token}), http.StatusOK)
+	alice.email = "ALICE@example.com"
+	alice.signIn(password)
+
+	var info struct {
+		FirstName string `json:"firstName"`
+		Email     string `json:"email"`
+	}
+	alice.send(http.MethodGet, "/auth/userInfo/"+alice.userID, nil).decode(t, &info)
+	if info.FirstName != "Alice" || info.Email != "alice@example.com" {
+		t.Fatalf("unexpected user info %+v", info)
+	}
+
+	tooManyTags := make([]string, 11)
+	for i := range tooManyTags {
+		tooManyTags[i] = fmt.Sprintf("tag%d", i)
+	}
+	res = alice.sendForm(http.MethodPost, "/posts/", url.Values{"title": {"Tags"}, "body": {"Body"}, "tags[]": tooManyTags}, "cover.png")
+	body = res.expectError(t, http.StatusUnprocessableEntity, apperror.CodeValidationFailed)
+	if body.Fields["tags"] != "tags must be at most 10 items" {
+		t.Fatalf("got fields %v", body.Fields)
+	}
+
+	res = alice.sendForm(http.MethodPost, "/posts/", url.Values{"title": {"Tags"}, "body": {"Body"}, "tags[]": {"go", " "}}, "cover.png")
+	body = res.expectError(t, http.StatusUnprocessableEntity, apperror.CodeValidationFailed)
+	if body.Fields["tags[1]"] != "tags[1] is required" {
+		t.Fatalf("got fields %v", body.Fields)
+	}
+
+	res = alice.sendForm(http.MethodPost, "/posts/", url.Values{"title": {"  Trimmed  "}, "body": {"Body"}, "tags[]": {" go "}}, "cover.png")
+	expectStatus(t, res, http.StatusCreated)
+	created := alice.findPost("Trimmed")
+	if !sameNames(created.tagNames(), "go") {
+		t.Fatalf("got tags %v", created.tagNames())
+	}
+
+	res = alice.send(http.MethodPost, "/posts/"+created.ID+"/comments", map[string]string{"message": strings.Repeat("x", 5001)})
+	body = res.expectError(t, http.StatusUnprocessableEntity, apperror.CodeValidationFailed)
+	if body.Fields["message"] != "message must be at most 5000 characters" {
+		t.Fatalf("got fields %v", body.Fields)
+	}
+}
+
+func sameNames(got []string, want ...string) bool {
+	got = append([]string{}, got...)
+	sort.Strings(got)
+	sort.Strings(want)
+	return reflect.DeepEqual(got, want)
+}
@@ -0,0 +1,36 @@
+package e2e
+
+import (
+	"testing"
+
+	"blog_post/models"
+
+	"gorm.io/gorm"
+)
+
+func TestAuditEventsCannotBeChanged(t *testing.T) {
+	app := newTestApp(t)
+
+	event := models.AuditEvent{Action: "test.event", TargetType: "user", TargetID: "someone"}
+	if err := app.db.Create(&event).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	raw := app.db.Session(&gorm.Session{SkipHooks: true})
+	attempts := map[string]error{
+		"raw update":            app.db.Exec("UPDATE audit_events SET action = 'forged' WHERE id = ?", event.ID).Error,
+		"raw delete":            app.db.Exec("DELETE FROM audit_events WHERE id = ?", event.ID).Error,
+		"update skipping hooks": raw.Model(&event).Update("action", "forged").Error,
+		"delete skipping hooks": raw.Delete(&event).Error,
+	}
+	for name, err := range attempts {
+		if err == nil {
+			t.Errorf("%s succeeded", name)
+		}
+	}
+
+	stored := models.AuditEvent{}
+	if err := app.db.Where("id = ?", event.ID).First(&stored).Error; err != nil || stored.Action != "test.event" {
+		t.Fatalf("event changed: %+v, %v", stored, err)
+	}
+}
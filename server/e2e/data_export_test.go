@@ -0,0 +1,33 @@
+package e2e
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"blog_post/models"
+	"blog_post/purge"
+)
+
+func TestStaleDataExportIsFailed(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.signUp("Alice", "alice@example.com", password)
+
+	// An export the server was building when it stopped.
+	stale := models.DataExport{UserID: alice.userID, Status: models.DataExportPending, RequestedAt: time.Now().Add(-2 * time.Hour)}
+	if err := app.db.Omit("User").Create(&stale).Error; err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, alice.send(http.MethodPost, "/auth/exportData", nil), http.StatusTooManyRequests)
+
+	if err := purge.Run(context.Background(), app.db, app.storage, app.mail, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.db.Where("id = ?", stale.ID).First(&stale).Error; err != nil || stale.Status != models.DataExportFailed {
+		t.Fatalf("got export %+v, %v; want it failed", stale, err)
+	}
+
+	expectStatus(t, alice.send(http.MethodPost, "/auth/exportData", nil), http.StatusAccepted)
+	app.mail.waitFor(t, alice.email, "data export is ready")
+}
@@ -0,0 +1,108 @@
+package e2e
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"blog_post/migrate"
+	"blog_post/models"
+)
+
+// schemaQueries describe a schema in comparable rows: columns, constraints
+// and indexes, each identified by name rather than by position or OID.
+var schemaQueries = []string{
+	`SELECT table_name, column_name, data_type, coalesce(character_maximum_length, 0), is_nullable, coalesce(column_default, '')
+	 FROM information_schema.columns WHERE table_schema = 'public' ORDER BY 1, 2`,
+	`SELECT conrelid::regclass::text, conname, pg_get_constraintdef(oid)
+	 FROM pg_constraint WHERE connamespace = 'public'::regnamespace ORDER BY 1, 2`,
+	`SELECT tablename, indexname, indexdef FROM pg_indexes WHERE schemaname = 'public' ORDER BY 1, 2`,
+}
+
+func describeSchema(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+
+	rows := []string{}
+	for _, query := range schemaQueries {
+		result, err := db.Query(query)
+		if err != nil {
+			t.Fatalf("describe schema: %v", err)
+		}
+		columns, _ := result.Columns()
+		for result.Next() {
+			values := make([]string, len(columns))
+			targets := make([]interface{}, len(columns))
+			for i := range values {
+				targets[i] = &values[i]
+			}
+			if err := result.Scan(targets...); err != nil {
+				t.Fatalf("describe schema: %v", err)
+			}
+			rows = append(rows, strings.Join(values, " | "))
+		}
+		result.Close()
+	}
+	return rows
+}
+
+// TestUpgradeFromAutoMigrateSchema migrates a database AutoMigrate created,
+// with data in it, and expects the same schema a fresh database gets.
+func TestUpgradeFromAutoMigrateSchema(t *testing.T) {
+	skipWithoutDatabase(t)
+
+	baseline, err := os.ReadFile("testdata/baseline.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := createDatabase(t)
+	sqlDB, _ := db.DB()
+	if _, err := sqlDB.Exec(string(baseline)); err != nil {
+		t.Fatalf("load baseline schema: %v", err)
+	}
+	if _, err := migrate.Up(context.Background(), sqlDB); err != nil {
+		t.Fatalf("migrate baseline database: %v", err)
+	}
+
+	fresh, _ := newDatabase(t).DB()
+	upgraded, want := describeSchema(t, sqlDB), describeSchema(t, fresh)
+	if !reflect.DeepEqual(upgraded, want) {
+		t.Errorf("upgraded schema differs from a fresh one")
+		for _, row := range difference(upgraded, want) {
+			t.Logf("only upgraded: %s", row)
+		}
+		for _, row := range difference(want, upgraded) {
+			t.Logf("only fresh:    %s", row)
+		}
+	}
+
+	user := models.User{}
+	if err := db.Where("id = ?", "00000000-0000-0000-0000-000000000001").First(&user).Error; err != nil {
+		t.Fatalf("load existing user: %v", err)
+	}
+	if user.Email != "old.timer@example.com" || !user.EmailVerified || user.Role != models.RoleUser {
+		t.Fatalf("existing user not upgraded: %+v", user)
+	}
+
+	var visible int64
+	if err := db.Model(&models.Post{}).Where("hidden = false").Count(&visible).Error; err != nil || visible != 1 {
+		t.Fatalf("existing post: %d visible, %v", visible, err)
+	}
+}
+
+func difference(rows []string, other []string) []string {
+	seen := map[string]bool{}
+	for _, row := range other {
+		seen[row] = true
+	}
+	missing := []string{}
+	for _, row := range rows {
+		if !seen[row] {
+			missing = append(missing, row)
+		}
+	}
+	return missing
+}
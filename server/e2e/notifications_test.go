@@ -0,0 +1,48 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentLikesShareOneNotification(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.signUp("Alice", "alice@example.com", password)
+	p := alice.addPost("Popular", "Everyone likes this")
+
+	likers := make([]*client, 5)
+	for i := range likers {
+		likers[i] = app.signUp(fmt.Sprintf("Fan%d", i), fmt.Sprintf("fan%d@example.com", i), password)
+	}
+
+	statuses := make([]int, len(likers))
+	var wg sync.WaitGroup
+	for i, liker := range likers {
+		wg.Add(1)
+		go func(i int, liker *client) {
+			defer wg.Done()
+			statuses[i] = liker.send(http.MethodPost, "/posts/"+p.ID+"/toggleLike", nil).status
+		}(i, liker)
+	}
+	wg.Wait()
+	for i, status := range statuses {
+		if status != http.StatusOK {
+			t.Fatalf("like %d returned %d", i, status)
+		}
+	}
+
+	var notifications []struct {
+		ID string
+	}
+	app.db.Table("notifications").Select("id").Where("user_id = ? AND type = ?", alice.userID, "POST_LIKE").Scan(&notifications)
+	if len(notifications) != 1 {
+		t.Fatalf("got %d like notifications, want 1", len(notifications))
+	}
+	var actors int64
+	app.db.Table("notification_actors").Where("notification_id = ?", notifications[0].ID).Count(&actors)
+	if actors != int64(len(likers)) {
+		t.Fatalf("got %d actors, want %d", actors, len(likers))
+	}
+}
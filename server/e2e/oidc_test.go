@@ -0,0 +1,167 @@
+package e2e
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"blog_post/config"
+	"blog_post/oidc/oidctest"
+)
+
+// newOIDCApp starts the API with the mock provider configured as "mock".
+func newOIDCApp(t *testing.T) (*testApp, *oidctest.Server) {
+	t.Helper()
+	skipWithoutDatabase(t)
+
+	provider := oidctest.NewServer("blog", "secret")
+	t.Cleanup(provider.Close)
+
+	app := newTestApp(t, func(cfg *config.Config) {
+		cfg.OIDCProviders = []config.OIDCProvider{{
+			Name:         "mock",
+			Issuer:       provider.Issuer(),
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+		}}
+	})
+	return app, provider
+}
+
+// oidcSignIn runs the authorization code flow in c's browser and returns
+// where the app sends the user at the end.
+func (c *client) oidcSignIn(provider *oidctest.Server) *url.URL {
+	t := c.app.t
+	t.Helper()
+
+	authURL := c.follow(c.app.baseURL + "/blog_post/auth/oidc/mock/login")
+	callback, err := provider.Authorize(authURL.String())
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	return c.follow(callback.String())
+}
+
+func expectRedirect(t *testing.T, location *url.URL, path string, query url.Values) {
+	t.Helper()
+	if location.Path != path {
+		t.Fatalf("redirected to %s, want %s", location, path)
+	}
+	for name := range query {
+		if location.Query().Get(name) != query.Get(name) {
+			t.Fatalf("redirected to %s, want %s=%s", location, name, query.Get(name))
+		}
+	}
+}
+
+func TestOIDCSignInCreatesAccount(t *testing.T) {
+	app, provider := newOIDCApp(t)
+	provider.SetUser(oidctest.User{Subject: "new-user", Email: "New.User@Example.com", EmailVerified: true, GivenName: "New"})
+
+	browser := app.newClient()
+	expectRedirect(t, browser.oidcSignIn(provider), "/", nil)
+
+	res := browser.send(http.MethodGet, "/auth/identities", nil)
+	expectStatus(t, res, http.StatusOK)
+	var identities []struct {
+		Provider string `json:"provider"`
+	}
+	res.decode(t, &identities)
+	if len(identities) != 1 || identities[0].Provider != "mock" {
+		t.Fatalf("unexpected identities %+v", identities)
+	}
+
+	// Signing in again finds the same identity instead of a new account.
+	again := app.newClient()
+	expectRedirect(t, again.oidcSignIn(provider), "/", nil)
+
+	var users int64
+	app.db.Table("users").Where("email = ?", "new.user@example.com").Count(&users)
+	if users != 1 {
+		t.Fatalf("got %d accounts for the provider email, want 1", users)
+	}
+}
+
+func TestOIDCLinksOnlyVerifiedAccounts(t *testing.T) {
+	app, provider := newOIDCApp(t)
+
+	alice := app.signUp("Alice", "alice@example.com", password)
+	provider.SetUser(oidctest.User{Subject: "alice", Email: "alice@example.com", EmailVerified: true})
+
+	browser := app.newClient()
+	expectRedirect(t, browser.oidcSignIn(provider), "/", nil)
+	var identity struct {
+		UserID string
+	}
+	app.db.Table("identities").Select("user_id").Where("subject = ?", "alice").Scan(&identity)
+	if identity.UserID != alice.userID {
+		t.Fatalf("identity linked to %q, want alice's account %q", identity.UserID, alice.userID)
+	}
+
+	// Someone signs up with bob's address and never verifies it; bob's
+	// provider login must not hand them his account.
+	squatter := app.newClient()
+	res := squatter.send(http.MethodPost, "/auth/signUp", map[string]string{
+		"firstName": "Mallory",
+		"lastName":  "Tester",
+		"email":     "bob@example.com",
+		"password":  password,
+	})
+	expectStatus(t, res, http.StatusAccepted)
+
+	provider.SetUser(oidctest.User{Subject: "bob", Email: "bob@example.com", EmailVerified: true})
+	expectRedirect(t, app.newClient().oidcSignIn(provider), "/signIn", url.Values{"error": {"link_required"}})
+
+	var identities int64
+	app.db.Table("identities").Where("subject = ?", "bob").Count(&identities)
+	if identities != 0 {
+		t.Fatal("identity was linked to the unverified account")
+	}
+}
+
+func TestOIDCCallbackRejectsBadState(t *testing.T) {
+	app, provider := newOIDCApp(t)
+	browser := app.newClient()
+
+	authURL := browser.follow(app.baseURL + "/blog_post/auth/oidc/mock/login")
+	callback, err := provider.Authorize(authURL.String())
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	forged := *callback
+	query := forged.Query()
+	query.Set("state", "forged")
+	forged.RawQuery = query.Encode()
+	expectRedirect(t, browser.follow(forged.String()), "/signIn", url.Values{"error": {"invalid_state"}})
+
+	expectRedirect(t, browser.follow(callback.String()), "/", nil)
+
+	// The state is single use, so replaying the callback fails.
+	expectRedirect(t, browser.follow(callback.String()), "/signIn", url.Values{"error": {"invalid_state"}})
+
+	expectRedirect(t, browser.follow(app.baseURL+"/blog_post/auth/oidc/mock/callback?error=access_denied"), "/signIn", url.Values{"error": {"provider_error"}})
+}
+
+func TestOIDCCallbackNeedsTheBrowserThatStartedIt(t *testing.T) {
+	app, provider := newOIDCApp(t)
+	provider.SetUser(oidctest.User{Subject: "attacker", Email: "attacker@example.com", EmailVerified: true})
+
+	attacker := app.newClient()
+	authURL := attacker.follow(app.baseURL + "/blog_post/auth/oidc/mock/login")
+	callback, err := provider.Authorize(authURL.String())
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+
+	// The attacker gets the victim to open their callback, while the victim
+	// has no login under way and while they have one of their own.
+	victim := app.newClient()
+	expectRedirect(t, victim.follow(callback.String()), "/signIn", url.Values{"error": {"invalid_state"}})
+	victim.follow(app.baseURL + "/blog_post/auth/oidc/mock/login")
+	expectRedirect(t, victim.follow(callback.String()), "/signIn", url.Values{"error": {"invalid_state"}})
+	expectStatus(t, victim.send(http.MethodGet, "/auth/identities", nil), http.StatusUnauthorized)
+
+	// The callback still works in the attacker's own browser.
+	expectRedirect(t, attacker.follow(callback.String()), "/", nil)
+}
@@ -0,0 +1,48 @@
+package e2e
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"blog_post/apperror"
+	"blog_post/models"
+)
+
+func TestResetCodeAttemptsAreLimited(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.signUp("Alice", "alice@example.com", password)
+
+	code := models.Code{UserID: alice.userID, Code: "ABCDEFGH", ExpireAt: time.Now().Add(time.Minute)}
+	if err := app.db.Omit("User").Create(&code).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	reset := func(code string) response {
+		return app.newClient().send(http.MethodPost, "/auth/resetPassword", map[string]string{
+			"email":       alice.email,
+			"code":        code,
+			"newPassword": "new-password",
+		})
+	}
+
+	// Guesses sent at once still use up the code after five tries, so the
+	// right one is refused afterwards.
+	guesses := make([]response, 8)
+	var wg sync.WaitGroup
+	for i := range guesses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			guesses[i] = reset("WRONGONE")
+		}(i)
+	}
+	wg.Wait()
+	for _, res := range guesses {
+		res.expectError(t, http.StatusBadRequest, apperror.CodeBadRequest)
+	}
+
+	reset("ABCDEFGH").expectError(t, http.StatusBadRequest, apperror.CodeBadRequest)
+	alice.signIn(password)
+}
@@ -0,0 +1,99 @@
+-- The schema AutoMigrate created for the models before versioned
+-- migrations, as production databases still have it.
+
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+CREATE TABLE "users" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "first_name" varchar(100) NOT NULL,
+    "last_name" varchar(100) NOT NULL,
+    "email" varchar(100) NOT NULL,
+    "hash_password" varchar(100) NOT NULL,
+    "image" text,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "uni_users_email" UNIQUE ("email")
+);
+
+CREATE TABLE "posts" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "title" varchar(255) NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    "updated_at" timestamptz NOT NULL DEFAULT now(),
+    "body" text NOT NULL,
+    "user_id" uuid NOT NULL,
+    "image" text,
+    "image_key" text,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_users_posts" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX "idx_posts_user_id" ON "posts" ("user_id");
+
+CREATE TABLE "comments" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "message" text NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    "updated_at" timestamptz NOT NULL DEFAULT now(),
+    "user_id" uuid NOT NULL,
+    "post_id" uuid NOT NULL,
+    "parent_id" uuid,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_users_comments" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_posts_comments" FOREIGN KEY ("post_id") REFERENCES "posts"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_comments_children" FOREIGN KEY ("parent_id") REFERENCES "comments"("id") ON DELETE CASCADE
+);
+CREATE INDEX "idx_comments_parent_id" ON "comments" ("parent_id");
+CREATE INDEX "idx_comments_post_id" ON "comments" ("post_id");
+CREATE INDEX "idx_comments_user_id" ON "comments" ("user_id");
+
+CREATE TABLE "tags" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "name" varchar(255) NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "uni_tags_name" UNIQUE ("name")
+);
+
+CREATE TABLE "post_tags" (
+    "post_id" uuid,
+    "tag_id" uuid,
+    PRIMARY KEY ("post_id","tag_id"),
+    CONSTRAINT "fk_post_tags_post" FOREIGN KEY ("post_id") REFERENCES "posts"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_post_tags_tag" FOREIGN KEY ("tag_id") REFERENCES "tags"("id") ON DELETE CASCADE
+);
+
+CREATE TABLE "post_likes" (
+    "user_id" uuid,
+    "post_id" uuid,
+    PRIMARY KEY ("user_id","post_id"),
+    CONSTRAINT "fk_posts_likes" FOREIGN KEY ("post_id") REFERENCES "posts"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_users_post_likes" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+
+CREATE TABLE "comment_likes" (
+    "user_id" uuid,
+    "comment_id" uuid,
+    PRIMARY KEY ("user_id","comment_id"),
+    CONSTRAINT "fk_comments_likes" FOREIGN KEY ("comment_id") REFERENCES "comments"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_users_comment_likes" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+
+CREATE TABLE "codes" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid NOT NULL,
+    "code" text NOT NULL,
+    "expire_at" timestamptz NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_codes_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX "idx_codes_user_id" ON "codes" ("user_id");
+
+INSERT INTO "users" ("id", "first_name", "last_name", "email", "hash_password")
+VALUES ('00000000-0000-0000-0000-000000000001', 'Old', 'Timer', ' Old.Timer@Example.com', 'baseline-hash');
+
+INSERT INTO "posts" ("id", "title", "body", "user_id")
+VALUES ('00000000-0000-0000-0000-000000000002', 'Before migrations', 'Body', '00000000-0000-0000-0000-000000000001');
+
+INSERT INTO "comments" ("message", "user_id", "post_id")
+VALUES ('First', '00000000-0000-0000-0000-000000000001', '00000000-0000-0000-0000-000000000002');
+
+INSERT INTO "codes" ("user_id", "code", "expire_at")
+VALUES ('00000000-0000-0000-0000-000000000001', '123456', now() + interval '10 minutes');
@@ -0,0 +1,129 @@
+package e2e
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"blog_post/apperror"
+	"blog_post/totp"
+)
+
+// startTwoFactorSignIn signs in with the password and returns the challenge.
+func (c *client) startTwoFactorSignIn(password string) string {
+	t := c.app.t
+	t.Helper()
+
+	res := c.send(http.MethodPost, "/auth/signIn", map[string]string{"email": c.email, "password": password})
+	expectStatus(t, res, http.StatusOK)
+
+	var challenge struct {
+		TwoFactorRequired bool   `json:"twoFactorRequired"`
+		ChallengeToken    string `json:"challengeToken"`
+	}
+	res.decode(t, &challenge)
+	if !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+		t.Fatalf("no two-factor challenge in %s", res.body)
+	}
+	return challenge.ChallengeToken
+}
+
+func TestTwoFactorCodesAreSingleUse(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.signUp("Alice", "alice@example.com", password)
+
+	res := alice.send(http.MethodPost, "/auth/2fa/enroll", nil)
+	expectStatus(t, res, http.StatusOK)
+	var enrollment struct {
+		Secret string `json:"secret"`
+	}
+	res.decode(t, &enrollment)
+
+	codeAt := func(step int64) string {
+		code, err := totp.CodeAt(enrollment.Secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	// The codes below rely on the window around the current step, so do not
+	// start right before it ends.
+	if remaining := totp.Period - time.Now().Unix()%totp.Period; remaining < 5 {
+		time.Sleep(time.Duration(remaining) * time.Second)
+	}
+
+	// Confirming with the previous step's code, still inside the window,
+	// records it as the last step used.
+	step := totp.Step(time.Now())
+	expectStatus(t, alice.send(http.MethodPost, "/auth/2fa/confirm", map[string]string{"code": codeAt(step - 1)}), http.StatusOK)
+	expectStatus(t, alice.send(http.MethodPost, "/auth/signOut", nil), http.StatusOK)
+
+	challenge := alice.startTwoFactorSignIn(password)
+	alice.send(http.MethodPost, "/auth/signIn/2fa", map[string]string{"challengeToken": challenge, "code": codeAt(step - 1)}).
+		expectError(t, http.StatusUnauthorized, apperror.CodeUnauthorized)
+
+	res = alice.send(http.MethodPost, "/auth/signIn/2fa", map[string]string{"challengeToken": challenge, "code": codeAt(step + 1)})
+	expectStatus(t, res, http.StatusOK)
+	expectStatus(t, alice.send(http.MethodPost, "/auth/signOut", nil), http.StatusOK)
+
+	// The code that signed in cannot sign in again, nor can the current
+	// step's code now that a later step has been used.
+	challenge = alice.startTwoFactorSignIn(password)
+	for _, code := range []string{codeAt(step + 1), codeAt(step)} {
+		alice.send(http.MethodPost, "/auth/signIn/2fa", map[string]string{"challengeToken": challenge, "code": code}).
+			expectError(t, http.StatusUnauthorized, apperror.CodeUnauthorized)
+	}
+}
+
+func TestTwoFactorAttemptsAreLimited(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.signUp("Alice", "alice@example.com", password)
+
+	res := alice.send(http.MethodPost, "/auth/2fa/enroll", nil)
+	expectStatus(t, res, http.StatusOK)
+	var enrollment struct {
+		Secret string `json:"secret"`
+	}
+	res.decode(t, &enrollment)
+	code, err := totp.CodeAt(enrollment.Secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, alice.send(http.MethodPost, "/auth/2fa/confirm", map[string]string{"code": code}), http.StatusOK)
+	expectStatus(t, alice.send(http.MethodPost, "/auth/signOut", nil), http.StatusOK)
+
+	// Guesses sent at once still only get the five tries a challenge allows.
+	challenge := alice.startTwoFactorSignIn(password)
+	bodies := make([]apperror.Body, 3*5)
+	var wg sync.WaitGroup
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res := alice.send(http.MethodPost, "/auth/signIn/2fa", map[string]string{"challengeToken": challenge, "recoveryCode": "wrong-guess"})
+			json.Unmarshal(res.body, &bodies[i])
+		}(i)
+	}
+	wg.Wait()
+
+	checked := 0
+	for _, body := range bodies {
+		switch body.Code {
+		case apperror.CodeUnauthorized:
+			checked++
+		case apperror.CodeSessionExpired:
+		default:
+			t.Fatalf("unexpected error %+v", body)
+		}
+	}
+	if checked != 5 {
+		t.Fatalf("%d guesses were checked, want 5", checked)
+	}
+
+	// Those failures locked the account, even for the right password.
+	alice.send(http.MethodPost, "/auth/signIn", map[string]string{"email": alice.email, "password": password}).
+		expectError(t, http.StatusUnauthorized, apperror.CodeInvalidCredentials)
+}
@@ -0,0 +1,59 @@
+package e2e
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"blog_post/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUnsubscribeNeedsPost(t *testing.T) {
+	app := newTestApp(t)
+	alice := app.signUp("Alice", "alice@example.com", password)
+
+	digestSetting := func() string {
+		t.Helper()
+		var preferences struct {
+			Digest string `json:"digest"`
+		}
+		res := alice.send(http.MethodGet, "/auth/emailPreferences", nil)
+		expectStatus(t, res, http.StatusOK)
+		res.decode(t, &preferences)
+		return preferences.Digest
+	}
+
+	if got := digestSetting(); got != "weekly" {
+		t.Fatalf("got digest %q", got)
+	}
+	preference := models.EmailPreference{}
+	if err := app.db.Where("user_id = ?", alice.userID).First(&preference).Error; err != nil {
+		t.Fatal(err)
+	}
+	path := "/unsubscribe/" + preference.UnsubscribeToken
+
+	// Opening the link, as a link scanner would, only shows a confirmation.
+	stranger := app.newClient()
+	res := stranger.do(http.MethodGet, path, "", nil)
+	expectStatus(t, res, http.StatusOK)
+	if !strings.Contains(string(res.body), `<form method="post"`) {
+		t.Fatalf("no confirmation form in %s", res.body)
+	}
+	if got := digestSetting(); got != "weekly" {
+		t.Fatalf("GET unsubscribed: digest is %q", got)
+	}
+
+	expectStatus(t, stranger.do(http.MethodGet, "/unsubscribe/unknown", "", nil), http.StatusNotFound)
+	expectStatus(t, stranger.do(http.MethodPost, "/unsubscribe/unknown", "", nil), http.StatusNotFound)
+
+	// The one-click request of RFC 8058.
+	oneClick := url.Values{"List-Unsubscribe": {"One-Click"}}.Encode()
+	res = stranger.do(http.MethodPost, path, fiber.MIMEApplicationForm, strings.NewReader(oneClick))
+	expectStatus(t, res, http.StatusOK)
+	if got := digestSetting(); got != "off" {
+		t.Fatalf("POST did not unsubscribe: digest is %q", got)
+	}
+}
@@ -0,0 +1,237 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"path"
+	"time"
+
+	"blog_post/models"
+	"blog_post/storage"
+
+	"gorm.io/gorm"
+)
+
+//go:embed index.html
+var indexSource string
+
+var indexTemplate = htmltemplate.Must(htmltemplate.New("index").Parse(indexSource))
+
+type Profile struct {
+	ID            string `json:"id"`
+	FirstName     string `json:"firstName"`
+	LastName      string `json:"lastName"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"emailVerified"`
+	Role          string `json:"role"`
+	TwoFactor     bool   `json:"twoFactorEnabled"`
+	Image         string `json:"image,omitempty"`
+}
+
+type Post struct {
+	ID        string     `json:"id"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	Tags      []string   `json:"tags"`
+	Image     string     `json:"image,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+type Comment struct {
+	ID        string     `json:"id"`
+	PostID    string     `json:"postId"`
+	ParentID  *string    `json:"parentId"`
+	Message   string     `json:"message"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+type Likes struct {
+	Posts    []string `json:"posts"`
+	Comments []string `json:"comments"`
+}
+
+type Data struct {
+	GeneratedAt time.Time
+	Profile     Profile
+	Posts       []Post
+	Comments    []Comment
+	Likes       Likes
+	Media       []string
+}
+
+func deletedAt(value gorm.DeletedAt) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Time
+}
+
+// collect gathers everything stored about a user, including posts and
+// comments that are deleted but not yet purged. It also returns the S3 keys
+// of the post images by post ID.
+func collect(db *gorm.DB, userID string) (Data, models.User, map[string]string, error) {
+	data := Data{GeneratedAt: time.Now().UTC()}
+	imageKeys := map[string]string{}
+
+	user := models.User{}
+	if err := db.Where("id = ?", userID).Limit(1).Find(&user).Error; err != nil {
+		return data, user, imageKeys, err
+	}
+	if user.ID == "" {
+		return data, user, imageKeys, fmt.Errorf("user %s not found", userID)
+	}
+
+	data.Profile = Profile{
+		ID:            user.ID,
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Role:          user.Role,
+		TwoFactor:     user.TOTPEnabled,
+	}
+
+	posts := []models.Post{}
+	if err := db.Unscoped().Preload("Tags").Where("user_id = ?", user.ID).Order("created_at").Find(&posts).Error; err != nil {
+		return data, user, imageKeys, err
+	}
+	for _, post := range posts {
+		tags := []string{}
+		for _, tag := range post.Tags {
+			tags = append(tags, tag.Name)
+		}
+		data.Posts = append(data.Posts, Post{
+			ID:        post.ID,
+			Title:     post.Title,
+			Body:      post.Body,
+			Tags:      tags,
+			CreatedAt: post.CreatedAt,
+			UpdatedAt: post.UpdatedAt,
+			DeletedAt: deletedAt(post.DeletedAt),
+		})
+		if post.ImageKey != "" {
+			imageKeys[post.ID] = post.ImageKey
+		}
+	}
+
+	comments := []models.Comment{}
+	if err := db.Unscoped().Where("user_id = ?", user.ID).Order("created_at").Find(&comments).Error; err != nil {
+		return data, user, imageKeys, err
+	}
+	for _, comment := range comments {
+		data.Comments = append(data.Comments, Comment{
+			ID:        comment.ID,
+			PostID:    comment.PostID,
+			ParentID:  comment.ParentID,
+			Message:   comment.Message,
+			CreatedAt: comment.CreatedAt,
+			UpdatedAt: comment.UpdatedAt,
+			DeletedAt: deletedAt(comment.DeletedAt),
+		})
+	}
+
+	data.Likes = Likes{Posts: []string{}, Comments: []string{}}
+	if err := db.Model(&models.PostLike{}).Where("user_id = ?", user.ID).Pluck("post_id", &data.Likes.Posts).Error; err != nil {
+		return data, user, imageKeys, err
+	}
+	if err := db.Model(&models.CommentLike{}).Where("user_id = ?", user.ID).Pluck("comment_id", &data.Likes.Comments).Error; err != nil {
+		return data, user, imageKeys, err
+	}
+
+	return data, user, imageKeys, nil
+}
+
+// Build assembles the export ZIP: one JSON file per kind of data, the uploaded
+// media, and an index.html that presents it all in a browser. Media that
+// cannot be fetched is logged and left out.
+func Build(ctx context.Context, db *gorm.DB, store storage.Storage, userID string) ([]byte, error) {
+	data, user, imageKeys, err := collect(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := &bytes.Buffer{}
+	archive := zip.NewWriter(buffer)
+
+	addMedia := func(key string, name string) string {
+		if key == "" {
+			return ""
+		}
+		content, err := store.Get(ctx, key)
+		if err != nil {
+			log.Printf("Failed to export media %s of user %s: %v", key, user.ID, err)
+			return ""
+		}
+		name = "media/" + name + path.Ext(key)
+		if err := writeFile(archive, name, content); err != nil {
+			log.Printf("Failed to export media %s of user %s: %v", key, user.ID, err)
+			return ""
+		}
+		data.Media = append(data.Media, name)
+		return name
+	}
+
+	profileKey := user.ImageKey
+	if profileKey == "" && user.Image != "" {
+		profileKey = store.KeyFromURL(user.Image)
+	}
+	data.Profile.Image = addMedia(profileKey, "profile")
+
+	for i := range data.Posts {
+		data.Posts[i].Image = addMedia(imageKeys[data.Posts[i].ID], "posts/"+data.Posts[i].ID)
+	}
+
+	for name, value := range map[string]interface{}{
+		"profile.json":  data.Profile,
+		"posts.json":    nonNil(data.Posts),
+		"comments.json": nonNil(data.Comments),
+		"likes.json":    data.Likes,
+	} {
+		content, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFile(archive, name, content); err != nil {
+			return nil, err
+		}
+	}
+
+	index := &bytes.Buffer{}
+	if err := indexTemplate.Execute(index, data); err != nil {
+		return nil, err
+	}
+	if err := writeFile(archive, "index.html", index.Bytes()); err != nil {
+		return nil, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
+
+func writeFile(archive *zip.Writer, name string, content []byte) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(content)
+	return err
+}
@@ -0,0 +1,346 @@
+package generate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"math/rand"
+	"strings"
+	"time"
+
+	"blog_post/db_aws"
+	"blog_post/models"
+	"blog_post/storage"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Options struct {
+	Users        int
+	Posts        int
+	Comments     int
+	Tags         int
+	PostLikes    int
+	CommentLikes int
+	// MaxDepth limits how deeply comment threads nest.
+	MaxDepth int
+	// Seed makes runs reproducible: the same seed always produces the same
+	// data.
+	Seed      int64
+	BatchSize int
+	Password  string
+	// PasswordParams are the Argon2 parameters Password is hashed with.
+	PasswordParams db_aws.Argon2Params
+	// ImageRatio is the share of posts that get a placeholder image uploaded
+	// to S3. Images are only written when Storage is set.
+	ImageRatio float64
+	Storage    storage.Storage
+}
+
+type Summary struct {
+	Users        int
+	Tags         int
+	Posts        int
+	Comments     int
+	PostLikes    int
+	CommentLikes int
+	Images       int
+}
+
+var words = strings.Fields(`lorem ipsum dolor sit amet consectetur adipiscing elit sed do eiusmod tempor
+incididunt ut labore et dolore magna aliqua enim ad minim veniam quis nostrud exercitation ullamco
+laboris nisi aliquip ex ea commodo consequat duis aute irure in reprehenderit voluptate velit esse
+cillum fugiat nulla pariatur excepteur sint occaecat cupidatat non proident sunt culpa qui officia
+deserunt mollit anim id est laborum`)
+
+var firstNames = strings.Fields("Ada Alan Grace Linus Ken Barbara Edsger Margaret Donald Frances John Radia Tim Hedy Dennis Katherine")
+var lastNames = strings.Fields("LOVELACE TURING HOPPER TORVALDS THOMPSON LISKOV DIJKSTRA HAMILTON KNUTH ALLEN BACKUS PERLMAN BERNERS-LEE LAMARR RITCHIE JOHNSON")
+
+type generator struct {
+	rng *rand.Rand
+	now time.Time
+}
+
+// newID derives UUIDs from the seeded source so that parents and children
+// can be linked before anything is inserted.
+func (g *generator) newID() string {
+	b := make([]byte, 16)
+	g.rng.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func (g *generator) sentence(min int, max int) string {
+	count := min + g.rng.Intn(max-min+1)
+	parts := make([]string, count)
+	for i := range parts {
+		parts[i] = words[g.rng.Intn(len(words))]
+	}
+	text := strings.Join(parts, " ")
+	return strings.ToUpper(text[:1]) + text[1:]
+}
+
+func (g *generator) paragraph() string {
+	sentences := make([]string, 2+g.rng.Intn(5))
+	for i := range sentences {
+		sentences[i] = g.sentence(6, 16) + "."
+	}
+	return strings.Join(sentences, " ")
+}
+
+// popular returns a picker over n items where a few items are chosen far
+// more often than the rest, like real post popularity. The popular items are
+// spread randomly rather than being the first ones.
+func (g *generator) popular(n int) func() int {
+	order := g.rng.Perm(n)
+	if n == 1 {
+		return func() int { return order[0] }
+	}
+	zipf := rand.NewZipf(g.rng, 1.2, 1, uint64(n-1))
+	return func() int { return order[zipf.Uint64()] }
+}
+
+func (g *generator) pastTime(after time.Time) time.Time {
+	span := g.now.Sub(after)
+	if span <= 0 {
+		return g.now
+	}
+	return after.Add(time.Duration(g.rng.Int63n(int64(span))))
+}
+
+func placeholderImage(fill color.Color) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, 640, 360))
+	for y := 0; y < 360; y++ {
+		for x := 0; x < 640; x++ {
+			img.Set(x, y, fill)
+		}
+	}
+	buffer := &bytes.Buffer{}
+	err := png.Encode(buffer, img)
+	return buffer.Bytes(), err
+}
+
+// Run inserts a synthetic data set. Users get the same password and
+// addresses under @example.test that include the seed, so running twice with
+// one seed is refused rather than duplicating anything.
+func Run(ctx context.Context, db *gorm.DB, opts Options) (Summary, error) {
+	summary := Summary{}
+	if opts.Users <= 0 {
+		return summary, fmt.Errorf("at least one user is required")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = 1
+	}
+
+	g := &generator{rng: rand.New(rand.NewSource(opts.Seed)), now: time.Now()}
+	insert := func(records interface{}) error {
+		return db.Omit(clause.Associations).CreateInBatches(records, opts.BatchSize).Error
+	}
+	insertIgnoringDuplicates := func(records interface{}) error {
+		return db.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).CreateInBatches(records, opts.BatchSize).Error
+	}
+
+	emailFormat := fmt.Sprintf("gen-%d-%%06d@example.test", opts.Seed)
+	var existing int64
+	if err := db.Unscoped().Model(&models.User{}).Where("email = ?", fmt.Sprintf(emailFormat, 0)).Count(&existing).Error; err != nil {
+		return summary, err
+	}
+	if existing > 0 {
+		return summary, fmt.Errorf("data for seed %d was already generated; pick another seed", opts.Seed)
+	}
+
+	hash, err := db_aws.HashPassword(opts.Password, opts.PasswordParams)
+	if err != nil {
+		return summary, err
+	}
+
+	since := g.now.AddDate(0, 0, -90)
+
+	users := make([]models.User, opts.Users)
+	for i := range users {
+		users[i] = models.User{
+			ID:            g.newID(),
+			FirstName:     firstNames[g.rng.Intn(len(firstNames))],
+			LastName:      lastNames[g.rng.Intn(len(lastNames))],
+			Email:         fmt.Sprintf(emailFormat, i),
+			HashPassword:  hash,
+			EmailVerified: true,
+			Role:          models.RoleUser,
+		}
+	}
+	if err := insert(&users); err != nil {
+		return summary, fmt.Errorf("failed to insert users: %v", err)
+	}
+	summary.Users = len(users)
+	log.Printf("Generated %d users", summary.Users)
+
+	tagIDs := []string{}
+	if opts.Tags > 0 {
+		tags := make([]models.Tag, opts.Tags)
+		names := make([]string, opts.Tags)
+		for i := range tags {
+			names[i] = fmt.Sprintf("%s-%d", words[g.rng.Intn(len(words))], i)
+			tags[i] = models.Tag{ID: g.newID(), Name: names[i]}
+		}
+		if err := insertIgnoringDuplicates(&tags); err != nil {
+			return summary, fmt.Errorf("failed to insert tags: %v", err)
+		}
+		// Tags are shared between runs, so read back the IDs of names that
+		// already existed.
+		if err := db.Model(&models.Tag{}).Where("name IN ?", names).Order("name").Pluck("id", &tagIDs).Error; err != nil {
+			return summary, err
+		}
+		summary.Tags = len(tagIDs)
+		log.Printf("Generated %d tags", summary.Tags)
+	}
+
+	pickUser := g.popular(len(users))
+	posts := make([]models.Post, opts.Posts)
+	postTags := []models.PostTag{}
+	for i := range posts {
+		createdAt := g.pastTime(since)
+		posts[i] = models.Post{
+			ID:        g.newID(),
+			UserID:    users[pickUser()].ID,
+			Title:     g.sentence(3, 8),
+			Body:      g.paragraph(),
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+		}
+
+		if len(tagIDs) > 0 {
+			for _, index := range g.rng.Perm(len(tagIDs))[:g.rng.Intn(min(4, len(tagIDs)+1))] {
+				postTags = append(postTags, models.PostTag{PostID: posts[i].ID, TagID: tagIDs[index]})
+			}
+		}
+
+		// Draw these even without S3 so that the rest of the data does not
+		// depend on whether images are uploaded.
+		withImage := g.rng.Float64() < opts.ImageRatio
+		fill := color.RGBA{uint8(g.rng.Intn(256)), uint8(g.rng.Intn(256)), uint8(g.rng.Intn(256)), 255}
+		if withImage && opts.Storage != nil {
+			data, err := placeholderImage(fill)
+			if err != nil {
+				return summary, err
+			}
+			key := fmt.Sprintf("generated/%d/%s.png", opts.Seed, posts[i].ID)
+			url, err := opts.Storage.Store(ctx, key, bytes.NewReader(data), db_aws.MaxURLExpiry)
+			if err != nil {
+				return summary, fmt.Errorf("failed to upload placeholder image: %v", err)
+			}
+			posts[i].Image = url
+			posts[i].ImageKey = key
+			summary.Images++
+		}
+	}
+	if err := insert(&posts); err != nil {
+		return summary, fmt.Errorf("failed to insert posts: %v", err)
+	}
+	if len(postTags) > 0 {
+		if err := insert(&postTags); err != nil {
+			return summary, fmt.Errorf("failed to insert post tags: %v", err)
+		}
+	}
+	summary.Posts = len(posts)
+	log.Printf("Generated %d posts (%d with images)", summary.Posts, summary.Images)
+
+	if len(posts) == 0 {
+		return summary, nil
+	}
+	pickPost := g.popular(len(posts))
+
+	// Comments are generated in order, so a reply always comes after its
+	// parent and batches never reference rows that are not inserted yet.
+	// Replies mostly continue the latest branch of a thread, which is what
+	// produces the deep chains.
+	type threadComment struct {
+		id        string
+		depth     int
+		createdAt time.Time
+	}
+	threads := map[string][]threadComment{}
+	comments := make([]models.Comment, 0, opts.Comments)
+	for i := 0; i < opts.Comments; i++ {
+		post := posts[pickPost()]
+		comment := models.Comment{
+			ID:      g.newID(),
+			UserID:  users[pickUser()].ID,
+			PostID:  post.ID,
+			Message: g.sentence(3, 30),
+		}
+
+		depth := 0
+		after := post.CreatedAt
+		thread := threads[post.ID]
+		if len(thread) > 0 && g.rng.Float64() < 0.7 {
+			parent := thread[len(thread)-1]
+			if g.rng.Float64() < 0.3 {
+				parent = thread[g.rng.Intn(len(thread))]
+			}
+			if parent.depth+1 < opts.MaxDepth {
+				comment.ParentID = &parent.id
+				depth = parent.depth + 1
+				after = parent.createdAt
+			}
+		}
+
+		comment.CreatedAt = g.pastTime(after)
+		comment.UpdatedAt = comment.CreatedAt
+		threads[post.ID] = append(thread, threadComment{id: comment.ID, depth: depth, createdAt: comment.CreatedAt})
+		comments = append(comments, comment)
+	}
+	if err := insert(&comments); err != nil {
+		return summary, fmt.Errorf("failed to insert comments: %v", err)
+	}
+	summary.Comments = len(comments)
+	log.Printf("Generated %d comments", summary.Comments)
+
+	postLikes := []models.PostLike{}
+	seen := map[[2]int]bool{}
+	for attempts := 0; len(postLikes) < opts.PostLikes && attempts < opts.PostLikes*3; attempts++ {
+		key := [2]int{g.rng.Intn(len(users)), pickPost()}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		postLikes = append(postLikes, models.PostLike{UserID: users[key[0]].ID, PostID: posts[key[1]].ID})
+	}
+	if len(postLikes) > 0 {
+		if err := insert(&postLikes); err != nil {
+			return summary, fmt.Errorf("failed to insert post likes: %v", err)
+		}
+	}
+	summary.PostLikes = len(postLikes)
+
+	commentLikes := []models.CommentLike{}
+	if len(comments) > 0 {
+		pickComment := g.popular(len(comments))
+		seen = map[[2]int]bool{}
+		for attempts := 0; len(commentLikes) < opts.CommentLikes && attempts < opts.CommentLikes*3; attempts++ {
+			key := [2]int{g.rng.Intn(len(users)), pickComment()}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			commentLikes = append(commentLikes, models.CommentLike{UserID: users[key[0]].ID, CommentID: comments[key[1]].ID})
+		}
+		if len(commentLikes) > 0 {
+			if err := insert(&commentLikes); err != nil {
+				return summary, fmt.Errorf("failed to insert comment likes: %v", err)
+			}
+		}
+	}
+	summary.CommentLikes = len(commentLikes)
+	log.Printf("Generated %d post likes and %d comment likes", summary.PostLikes, summary.CommentLikes)
+
+	return summary, nil
+}
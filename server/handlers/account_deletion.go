@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"blog_post/apperror"
+	"blog_post/db_aws"
+	"blog_post/mailer"
+	"blog_post/models"
+
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"net/url"
+	"time"
+)
+
+func (s *Server) sendDeletionScheduledEmail(user models.User, token string, scheduledFor time.Time) error {
+	msg, err := mailer.NewMessage(user.Email, "Your account is scheduled for deletion", "deletion_scheduled", fiber.Map{
+		"FirstName": user.FirstName,
+		"DeleteOn":  scheduledFor.UTC().Format("January 2, 2006"),
+		"CancelURL": fmt.Sprintf("%s/cancelDeletion?token=%s", s.config.AppURL, url.QueryEscape(token)),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mail.Send(msg)
+}
+
+// sendPendingDeletionEmail tells the owner of an account scheduled for
+// deletion that someone tried to sign up with its email. Only the hash of the
+// cancel token is stored, so the email carries a new one, which replaces the
+// token sent when the deletion was requested.
+func (s *Server) sendPendingDeletionEmail(user models.User) error {
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	deletion := models.AccountDeletion{}
+	if err := s.db.Where("user_id = ?", user.ID).Limit(1).Find(&deletion).Error; err != nil {
+		return err
+	}
+	if deletion.ID == "" {
+		return fmt.Errorf("no deletion is scheduled")
+	}
+	if err := s.db.Model(&deletion).Update("token_hash", hashToken(token)).Error; err != nil {
+		return err
+	}
+
+	msg, err := mailer.NewMessage(user.Email, "Sign-up attempt with the email of your deleted account", "account_pending_deletion", fiber.Map{
+		"FirstName": user.FirstName,
+		"DeleteOn":  deletion.ScheduledFor.UTC().Format("January 2, 2006"),
+		"CancelURL": fmt.Sprintf("%s/cancelDeletion?token=%s", s.config.AppURL, url.QueryEscape(token)),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mail.Send(msg)
+}
+
+func (s *Server) HandleDeleteUser(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	var body struct {
+		Password string `json:"password" validate:"required"`
+	}
+
+	if err := parseBody(ctx, &body); err != nil {
+		return err
+	}
+
+	user := models.User{}
+	if err := s.db.Where("id = ?", userID).Limit(1).Find(&user).Error; err != nil || user.ID == "" {
+		return apperror.Internal("Failed to retrieve user", err)
+	}
+
+	if user.HashPassword == "" {
+		return apperror.Conflict("Set a password before deleting your account")
+	}
+	if err := db_aws.VerifyPassword(body.Password, user.HashPassword); err != nil {
+		return apperror.Unauthorized("Invalid password")
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return apperror.Internal("Failed to delete user", err)
+	}
+
+	deletion := models.AccountDeletion{
+		UserID:       user.ID,
+		TokenHash:    hashToken(token),
+		RequestedAt:  time.Now(),
+		ScheduledFor: time.Now().Add(s.config.DeletionGracePeriod),
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := softDeleteUser(tx, user.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.AccountDeletion{}).Error; err != nil {
+			return err
+		}
+		return tx.Omit("User").Create(&deletion).Error
+	})
+	if err != nil {
+		return apperror.Internal("Failed to delete user", err)
+	}
+
+	RecordAudit(ctx, s.db, user.ID, AuditDeletionRequested, "user", user.ID, fiber.Map{"scheduledFor": deletion.ScheduledFor})
+
+	go func() {
+		if err := s.sendDeletionScheduledEmail(user, token, deletion.ScheduledFor); err != nil {
+			log.Printf("Failed to send deletion email to user %s: %v", user.ID, err)
+		}
+	}()
+
+	clearSessionCookies(ctx)
+	return ctx.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message":      "Your account will be deleted. Use the link sent to your email to cancel.",
+		"scheduledFor": deletion.ScheduledFor,
+	})
+}
+
+func (s *Server) HandleCancelDeletion(ctx *fiber.Ctx) error {
+	var body struct {
+		Token string `json:"token" validate:"trim,required"`
+	}
+
+	if err := parseBody(ctx, &body); err != nil {
+		return err
+	}
+
+	deletion := models.AccountDeletion{}
+	if err := s.db.Where("token_hash = ? AND scheduled_for > ?", hashToken(body.Token), time.Now()).Limit(1).Find(&deletion).Error; err != nil {
+		return apperror.Internal("Failed to cancel deletion", err)
+	}
+	if deletion.ID == "" {
+		return apperror.BadRequest("Invalid or expired link")
+	}
+
+	user := models.User{}
+	if err := s.db.Unscoped().Where("id = ?", deletion.UserID).Limit(1).Find(&user).Error; err != nil || user.ID == "" {
+		return apperror.Internal("Failed to cancel deletion", err)
+	}
+
+	if err := restoreDeletedUser(s.db, user); err != nil {
+		return apperror.Internal("Failed to cancel deletion", err)
+	}
+
+	RecordAudit(ctx, s.db, user.ID, AuditDeletionCanceled, "user", user.ID, nil)
+
+	return ctx.JSON(fiber.Map{"message": "Account deletion canceled. You can sign in again."})
+}
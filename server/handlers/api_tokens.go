@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"blog_post/apperror"
+	"blog_post/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeRead               = "read"
+	ScopeWritePosts         = "write:posts"
+	ScopeWriteComments      = "write:comments"
+	ScopeWriteNotifications = "write:notifications"
+
+	apiTokenPrefix         = "bp_"
+	apiTokenDisplayLength  = 10
+	defaultAPITokenTTLDays = 90
+	maxAPITokenTTLDays     = 365
+	apiTokenTouchInterval  = time.Minute
+)
+
+func currentTokenScopes(ctx *fiber.Ctx) ([]string, bool) {
+	scopes, ok := ctx.Locals("tokenScopes").([]string)
+	return scopes, ok
+}
+
+// APITokenMiddleware authenticates requests carrying an
+// "Authorization: Bearer <token>" header. A bad token is rejected outright
+// rather than falling back to the session cookie.
+func APITokenMiddleware(db *gorm.DB) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		header := ctx.Get(fiber.HeaderAuthorization)
+		if header == "" {
+			return ctx.Next()
+		}
+
+		raw, found := strings.CutPrefix(header, "Bearer ")
+		if !found || !strings.HasPrefix(raw, apiTokenPrefix) {
+			return apperror.Unauthorized("Invalid authorization header")
+		}
+
+		token := models.APIToken{}
+		if err := db.Where("token_hash = ?", hashToken(raw)).Limit(1).Find(&token).Error; err != nil {
+			return apperror.Internal("Failed to retrieve token", err)
+		}
+
+		now := time.Now()
+		if token.ID == "" || now.After(token.ExpiresAt) {
+			return apperror.Unauthorized("Invalid or expired token")
+		}
+
+		if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > apiTokenTouchInterval {
+			if err := db.Model(&token).Update("last_used_at", now).Error; err != nil {
+				log.Println("Failed to update token last use:", err)
+			}
+		}
+
+		ctx.Locals("userId", token.UserID)
+		ctx.Locals("apiTokenId", token.ID)
+		ctx.Locals("tokenScopes", strings.Fields(token.Scopes))
+		return ctx.Next()
+	}
+}
+
+// RequireScope only restricts token-authenticated requests; browser sessions
+// carry every scope.
+func RequireScope(scope string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		scopes, isToken := currentTokenScopes(ctx)
+		if !isToken {
+			return ctx.Next()
+		}
+
+		for _, granted := range scopes {
+			if granted == scope {
+				return ctx.Next()
+			}
+		}
+
+		return apperror.Forbidden("Token is missing the " + scope + " scope")
+	}
+}
+
+// RejectAPITokens keeps account management (passwords, sessions, tokens
+// themselves) reachable only from a signed-in browser session.
+func RejectAPITokens(ctx *fiber.Ctx) error {
+	if _, isToken := currentTokenScopes(ctx); isToken {
+		return apperror.Forbidden("This endpoint cannot be used with an API token")
+	}
+	return ctx.Next()
+}
+
+func apiTokenToMap(token models.APIToken) fiber.Map {
+	return fiber.Map{
+		"id":         token.ID,
+		"name":       token.Name,
+		"prefix":     token.Prefix,
+		"scopes":     strings.Fields(token.Scopes),
+		"expiresAt":  token.ExpiresAt,
+		"lastUsedAt": token.LastUsedAt,
+		"createdAt":  token.CreatedAt,
+	}
+}
+
+func (s *Server) HandleCreateAPIToken(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	var body struct {
+		Name          string   `json:"name" validate:"trim,required,max=100"`
+		Scopes        []string `json:"scopes" validate:"required" each:"trim,oneof=read write:posts write:comments write:notifications"`
+		ExpiresInDays int      `json:"expiresInDays"`
+	}
+
+	if err := parseBody(ctx, &body); err != nil {
+		return err
+	}
+
+	scopes := []string{}
+	seen := map[string]bool{}
+	for _, scope := range body.Scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+
+	days := body.ExpiresInDays
+	if days == 0 {
+		days = defaultAPITokenTTLDays
+	}
+	if days < 0 || days > maxAPITokenTTLDays {
+		return apperror.InvalidField("expiresInDays", "expiresInDays must be between 1 and 365")
+	}
+
+	secret, err := newToken()
+	if err != nil {
+		return apperror.Internal("Failed to generate token", err)
+	}
+	raw := apiTokenPrefix + secret
+
+	token := models.APIToken{
+		UserID:    userID,
+		Name:      body.Name,
+		Prefix:    raw[:apiTokenDisplayLength],
+		TokenHash: hashToken(raw),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: time.Now().Add(time.Duration(days) * 24 * time.Hour),
+		CreatedAt: time.Now(),
+	}
+	if err := s.db.Omit("User").Create(&token).Error; err != nil {
+		return apperror.Internal("Failed to create token", err)
+	}
+
+	RecordAudit(ctx, s.db, userID, AuditTokenCreated, "api_token", token.ID, fiber.Map{"name": token.Name, "scopes": scopes})
+
+	result := apiTokenToMap(token)
+	result["token"] = raw
+
+	return ctx.Status(fiber.StatusCreated).JSON(result)
+}
+
+func (s *Server) HandleGetAPITokens(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	tokens := []models.APIToken{}
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return apperror.Internal("Failed to retrieve tokens", err)
+	}
+
+	result := []fiber.Map{}
+	for _, token := range tokens {
+		result = append(result, apiTokenToMap(token))
+	}
+
+	return ctx.JSON(result)
+}
+
+func (s *Server) HandleRevokeAPIToken(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	result := s.db.Where("id = ? AND user_id = ?", ctx.Params("id"), userID).Delete(&models.APIToken{})
+	if result.Error != nil {
+		return apperror.Internal("Failed to revoke token", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return apperror.NotFound("Token not found")
+	}
+
+	RecordAudit(ctx, s.db, userID, AuditTokenRevoked, "api_token", ctx.Params("id"), nil)
+
+	return ctx.JSON(fiber.Map{"message": "Token revoked"})
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"blog_post/apperror"
+	"blog_post/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRouteScopes(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.addUser("Alice", models.RoleUser, true)
+
+	tests := []struct {
+		method string
+		path   string
+		scope  string
+	}{
+		{http.MethodGet, "/notifications", ScopeRead},
+		{http.MethodPut, "/notifications/readAll", ScopeWriteNotifications},
+		{http.MethodPut, "/notifications/00000000-0000-0000-0000-000000000000/read", ScopeWriteNotifications},
+		{http.MethodPost, "/posts/00000000-0000-0000-0000-000000000000/toggleLike", ScopeWritePosts},
+	}
+
+	allScopes := []string{ScopeRead, ScopeWritePosts, ScopeWriteComments, ScopeWriteNotifications}
+	for _, test := range tests {
+		for _, scope := range allScopes {
+			req := httptest.NewRequest(test.method, "/blog_post"+test.path, nil)
+			req.Header.Set("X-Test-User", alice.ID)
+			req.Header.Set("X-Test-Scopes", scope)
+			res, err := ts.app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if forbidden := res.StatusCode == http.StatusForbidden; forbidden != (scope != test.scope) {
+				t.Errorf("%s %s with %s: got status %d", test.method, test.path, scope, res.StatusCode)
+			}
+		}
+	}
+
+}
+
+func TestCreateAPITokenScopes(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.addUser("Alice", models.RoleUser, true)
+
+	ts.json(alice.ID, http.MethodPost, "/auth/tokens", fiber.Map{"name": "script", "scopes": []string{"read", "write:notifications"}}).
+		expect(t, http.StatusCreated)
+
+	body := ts.json(alice.ID, http.MethodPost, "/auth/tokens", fiber.Map{"name": "script", "scopes": []string{"read", "write:everything"}}).
+		expectError(t, http.StatusUnprocessableEntity, apperror.CodeValidationFailed)
+	if body.Fields["scopes[1]"] != "scopes[1] must be one of read, write:posts, write:comments or write:notifications" {
+		t.Fatalf("got fields %v", body.Fields)
+	}
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"blog_post/apperror"
+	"blog_post/models"
+
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	AuditSignIn                  = "auth.sign_in"
+	AuditSignInFailed            = "auth.sign_in_failed"
+	AuditAccountLocked           = "auth.account_locked"
+	AuditSignOut                 = "auth.sign_out"
+	AuditSignUp                  = "auth.sign_up"
+	AuditSessionRevoked          = "auth.session_revoked"
+	AuditOtherSessionsRevoked    = "auth.other_sessions_revoked"
+	AuditPasswordChanged         = "auth.password_changed"
+	AuditPasswordResetRequested  = "auth.password_reset_requested"
+	AuditPasswordReset           = "auth.password_reset"
+	AuditEmailChangeRequested    = "auth.email_change_requested"
+	AuditEmailVerified           = "auth.email_verified"
+	AuditTwoFactorEnabled        = "auth.2fa_enabled"
+	AuditTwoFactorDisabled       = "auth.2fa_disabled"
+	AuditTwoFactorFailed         = "auth.2fa_failed"
+	AuditRecoveryCodesRegenerate = "auth.recovery_codes_regenerated"
+	AuditTokenCreated            = "auth.token_created"
+	AuditTokenRevoked            = "auth.token_revoked"
+	AuditIdentityLinked          = "auth.identity_linked"
+	AuditIdentityUnlinked        = "auth.identity_unlinked"
+	AuditDeletionRequested       = "user.deletion_requested"
+	AuditDeletionCanceled        = "user.deletion_canceled"
+	AuditDataExportRequested     = "user.data_export_requested"
+
+	auditUserAgentLimit = 512
+	auditExportBatch    = 500
+)
+
+// RecordAudit appends an event to the audit log. Failures are logged rather
+// than returned so that auditing never blocks the action itself.
+func RecordAudit(ctx *fiber.Ctx, db *gorm.DB, actorID string, action string, targetType string, targetID string, metadata fiber.Map) {
+	saveAuditEvent(db, newAuditEvent(ctx, actorID, action, targetType, targetID, metadata))
+}
+
+// newAuditEvent builds an event without saving it. It copies everything it
+// needs out of ctx, so the event can be saved after the request has ended.
+func newAuditEvent(ctx *fiber.Ctx, actorID string, action string, targetType string, targetID string, metadata fiber.Map) models.AuditEvent {
+	event := models.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		CreatedAt:  time.Now(),
+	}
+	if actorID != "" {
+		event.ActorID = &actorID
+	}
+	if ctx != nil {
+		event.IP = ctx.IP()
+		event.UserAgent = strings.Clone(ctx.Get(fiber.HeaderUserAgent))
+		if len(event.UserAgent) > auditUserAgentLimit {
+			event.UserAgent = event.UserAgent[:auditUserAgentLimit]
+		}
+	}
+	if len(metadata) > 0 {
+		if data, err := json.Marshal(metadata); err == nil {
+			event.Metadata = string(data)
+		}
+	}
+	return event
+}
+
+func saveAuditEvent(db *gorm.DB, event models.AuditEvent) {
+	if err := db.Create(&event).Error; err != nil {
+		log.Printf("Failed to record audit event %s: %v", event.Action, err)
+	}
+}
+
+// auditQuery applies the filters shared by the audit listing and the CSV
+// export. An action ending in ".*" matches every action with that prefix.
+func auditQuery(ctx *fiber.Ctx, db *gorm.DB) (*gorm.DB, error) {
+	query := db.Model(&models.AuditEvent{})
+
+	if actorID := ctx.Query("actorId"); actorID != "" {
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if action := ctx.Query("action"); action != "" {
+		if prefix, found := strings.CutSuffix(action, ".*"); found {
+			query = query.Where("action LIKE ?", prefix+".%")
+		} else {
+			query = query.Where("action = ?", action)
+		}
+	}
+	if targetType := ctx.Query("targetType"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if targetID := ctx.Query("targetId"); targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+	if ip := ctx.Query("ip"); ip != "" {
+		query = query.Where("ip = ?", ip)
+	}
+	if from := ctx.Query("from"); from != "" {
+		since, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("created_at >= ?", since)
+	}
+	if to := ctx.Query("to"); to != "" {
+		until, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("created_at < ?", until)
+	}
+
+	return query.Session(&gorm.Session{}), nil
+}
+
+func auditEventToMap(event models.AuditEvent) fiber.Map {
+	return fiber.Map{
+		"id":         event.ID,
+		"actorId":    event.ActorID,
+		"action":     event.Action,
+		"targetType": event.TargetType,
+		"targetId":   event.TargetID,
+		"ip":         event.IP,
+		"userAgent":  event.UserAgent,
+		"metadata":   json.RawMessage(nullIfEmpty(event.Metadata)),
+		"createdAt":  event.CreatedAt,
+	}
+}
+
+// csvSafe stops spreadsheet applications from evaluating client-supplied
+// values such as user agents as formulas.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (s *Server) HandleGetAuditEvents(ctx *fiber.Ctx) error {
+	query, err := auditQuery(ctx, s.db)
+	if err != nil {
+		return apperror.Unprocessable("from and to must be RFC 3339 timestamps")
+	}
+
+	limit := ctx.QueryInt("limit", 100)
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	events := []models.AuditEvent{}
+	if err := query.Order("created_at DESC").Limit(limit).Offset(ctx.QueryInt("offset", 0)).Find(&events).Error; err != nil {
+		return apperror.Internal("Failed to retrieve audit events", err)
+	}
+
+	result := []fiber.Map{}
+	for _, event := range events {
+		result = append(result, auditEventToMap(event))
+	}
+
+	return ctx.JSON(result)
+}
+
+// HandleExportAuditEvents streams the matching events as CSV. The first batch
+// is loaded before anything is sent, so a failing query still gets a proper
+// error response. A batch failing later cannot change the status any more, so
+// the connection is closed before the end of the response: the client sees an
+// aborted download rather than a file that looks complete.
+func (s *Server) HandleExportAuditEvents(ctx *fiber.Ctx) error {
+	query, err := auditQuery(ctx, s.db)
+	if err != nil {
+		return apperror.Unprocessable("from and to must be RFC 3339 timestamps")
+	}
+
+	batch := func(offset int) ([]models.AuditEvent, error) {
+		events := []models.AuditEvent{}
+		err := query.Order("created_at, id").Limit(auditExportBatch).Offset(offset).Find(&events).Error
+		return events, err
+	}
+
+	first, err := batch(0)
+	if err != nil {
+		return apperror.Internal("Failed to export audit events", err)
+	}
+
+	ctx.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	ctx.Set(fiber.HeaderContentDisposition, `attachment; filename="audit-`+time.Now().UTC().Format("20060102-150405")+`.csv"`)
+
+	conn := ctx.Context().Conn()
+	ctx.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := writeAuditCSV(w, first, batch); err != nil {
+			log.Println("Audit export aborted:", err)
+			conn.Close()
+		}
+	})
+	return nil
+}
+
+// writeAuditCSV writes first and the batches after it until one comes back
+// short.
+func writeAuditCSV(w io.Writer, first []models.AuditEvent, batch func(offset int) ([]models.AuditEvent, error)) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"id", "created_at", "actor_id", "action", "target_type", "target_id", "ip", "user_agent", "metadata"})
+
+	events := first
+	for offset := 0; ; {
+		for _, event := range events {
+			actorID := ""
+			if event.ActorID != nil {
+				actorID = *event.ActorID
+			}
+			writer.Write([]string{
+				event.ID,
+				event.CreatedAt.UTC().Format(time.RFC3339),
+				actorID,
+				event.Action,
+				event.TargetType,
+				event.TargetID,
+				event.IP,
+				csvSafe(event.UserAgent),
+				csvSafe(event.Metadata),
+			})
+		}
+
+		if len(events) < auditExportBatch {
+			break
+		}
+
+		offset += auditExportBatch
+		next, err := batch(offset)
+		if err != nil {
+			return err
+		}
+		events = next
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
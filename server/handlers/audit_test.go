@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"blog_post/apperror"
+	"blog_post/models"
+
+	"gorm.io/gorm"
+)
+
+// fakeAuditBatches answers the export's queries from batches instead of the
+// dry-run connection, which finds nothing. A nil batch fails the query.
+func (ts *testServer) fakeAuditBatches(batches ...[]models.AuditEvent) {
+	ts.t.Helper()
+
+	calls := 0
+	err := ts.db.Callback().Query().After("gorm:query").Register("test:audit_batches", func(tx *gorm.DB) {
+		events, ok := tx.Statement.Dest.(*[]models.AuditEvent)
+		if !ok {
+			return
+		}
+		if calls >= len(batches) || batches[calls] == nil {
+			tx.AddError(errors.New("connection lost"))
+			return
+		}
+		*events = batches[calls]
+		calls++
+	})
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+func auditBatch(from int, count int) []models.AuditEvent {
+	events := []models.AuditEvent{}
+	for i := from; i < from+count; i++ {
+		events = append(events, models.AuditEvent{
+			ID:        fmt.Sprintf("event-%d", i),
+			Action:    AuditSignIn,
+			UserAgent: "=cmd()",
+			CreatedAt: time.Unix(int64(i), 0),
+		})
+	}
+	return events
+}
+
+// serve listens on a real port: an aborted stream only shows on a real
+// connection.
+func (ts *testServer) serve() string {
+	ts.t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	go ts.app.Listener(listener)
+	ts.t.Cleanup(func() { ts.app.Shutdown() })
+	return "http://" + listener.Addr().String()
+}
+
+func (ts *testServer) export(baseURL string, userID string) (*http.Response, []byte, error) {
+	ts.t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, baseURL+"/blog_post/admin/audit/export", nil)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	req.Header.Set("X-Test-User", userID)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	return res, body, err
+}
+
+func TestExportAuditEvents(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.addUser("Admin", models.RoleAdmin, true)
+	ts.fakeAuditBatches(auditBatch(0, auditExportBatch), auditBatch(auditExportBatch, 2))
+
+	res, body, err := ts.export(ts.serve(), admin.ID)
+	if err != nil {
+		t.Fatalf("read export: %v", err)
+	}
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/csv") {
+		t.Fatalf("got status %d, content type %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+	if len(lines) != auditExportBatch+3 {
+		t.Fatalf("got %d lines, want a header and %d events", len(lines), auditExportBatch+2)
+	}
+	if !strings.HasPrefix(lines[0], "id,created_at,") || !strings.HasPrefix(lines[len(lines)-1], fmt.Sprintf("event-%d,", auditExportBatch+1)) {
+		t.Fatalf("unexpected export:\n%s\n...\n%s", lines[0], lines[len(lines)-1])
+	}
+	if !strings.Contains(lines[1], ",'=cmd(),") {
+		t.Fatalf("user agent not defused: %s", lines[1])
+	}
+}
+
+func TestExportAuditEventsFailingFirstBatch(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.addUser("Admin", models.RoleAdmin, true)
+	ts.fakeAuditBatches(nil)
+
+	ts.json(admin.ID, http.MethodGet, "/admin/audit/export", nil).expectError(t, http.StatusInternalServerError, apperror.CodeInternal)
+}
+
+func TestExportAuditEventsAbortsOnLaterFailure(t *testing.T) {
+	ts := newTestServer(t)
+	admin := ts.addUser("Admin", models.RoleAdmin, true)
+	ts.fakeAuditBatches(auditBatch(0, auditExportBatch), nil)
+
+	res, body, err := ts.export(ts.serve(), admin.ID)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d", res.StatusCode)
+	}
+	if err == nil {
+		t.Fatalf("export read completely (%d bytes) although a batch failed", len(body))
+	}
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"blog_post/apperror"
+	"blog_post/validate"
+
+	"errors"
+	"github.com/gofiber/fiber/v2"
+)
+
+// parseBody parses the request body into body, then normalizes and checks it
+// against its validate tags. Invalid fields are answered with a 422 listing
+// each of them. Length limits in those tags match the column sizes in models;
+// text columns get a limit of their own.
+func parseBody(ctx *fiber.Ctx, body interface{}) error {
+	if err := ctx.BodyParser(body); err != nil {
+		return apperror.InvalidBody()
+	}
+
+	if err := validate.Struct(body); err != nil {
+		var fieldErrs validate.Errors
+		if errors.As(err, &fieldErrs) {
+			return apperror.Unprocessable(fieldErrs[0].Message).WithFields(fieldErrs.Map())
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"blog_post/apperror"
+	"blog_post/export"
+	"blog_post/mailer"
+	"blog_post/models"
+
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"time"
+)
+
+const (
+	// Presigned S3 URLs cannot outlive seven days.
+	dataExportTTL = 3 * 24 * time.Hour
+	// dataExportCooldown limits how often a user can start a new export.
+	dataExportCooldown = 24 * time.Hour
+)
+
+func dataExportToMap(dataExport models.DataExport) fiber.Map {
+	return fiber.Map{
+		"id":          dataExport.ID,
+		"status":      dataExport.Status,
+		"requestedAt": dataExport.RequestedAt,
+		"completedAt": dataExport.CompletedAt,
+		"expiresAt":   dataExport.ExpiresAt,
+	}
+}
+
+func (s *Server) HandleRequestDataExport(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	recent := models.DataExport{}
+	if err := s.db.Where("user_id = ? AND status <> ? AND requested_at > ?", userID, models.DataExportFailed, time.Now().Add(-dataExportCooldown)).
+		Order("requested_at DESC").Limit(1).Find(&recent).Error; err != nil {
+		return apperror.Internal("Failed to request data export", err)
+	}
+	if recent.ID != "" {
+		retryAfter := recent.RequestedAt.Add(dataExportCooldown)
+		ctx.Set(fiber.HeaderRetryAfter, fmt.Sprint(int(time.Until(retryAfter).Seconds())+1))
+		return apperror.TooManyRequests("You already requested an export in the last 24 hours").WithDetails(fiber.Map{
+			"export": dataExportToMap(recent),
+		})
+	}
+
+	dataExport := models.DataExport{
+		UserID:      userID,
+		Status:      models.DataExportPending,
+		RequestedAt: time.Now(),
+	}
+	if err := s.db.Omit("User").Create(&dataExport).Error; err != nil {
+		return apperror.Internal("Failed to request data export", err)
+	}
+
+	RecordAudit(ctx, s.db, userID, AuditDataExportRequested, "user", userID, fiber.Map{"exportId": dataExport.ID})
+
+	go func() {
+		if err := s.buildDataExport(dataExport); err != nil {
+			log.Printf("Failed to build data export %s: %v", dataExport.ID, err)
+			s.db.Model(&models.DataExport{}).Where("id = ?", dataExport.ID).Update("status", models.DataExportFailed)
+		}
+	}()
+
+	return ctx.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Your export is being prepared. We will email you a download link.",
+		"export":  dataExportToMap(dataExport),
+	})
+}
+
+func (s *Server) HandleGetDataExports(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	exports := []models.DataExport{}
+	if err := s.db.Where("user_id = ?", userID).Order("requested_at DESC").Limit(10).Find(&exports).Error; err != nil {
+		return apperror.Internal("Failed to retrieve data exports", err)
+	}
+
+	result := []fiber.Map{}
+	for _, dataExport := range exports {
+		result = append(result, dataExportToMap(dataExport))
+	}
+
+	return ctx.JSON(result)
+}
+
+// buildDataExport assembles the archive, uploads it next to the user's other
+// media and emails a presigned link to it. The link itself is never stored.
+func (s *Server) buildDataExport(dataExport models.DataExport) error {
+	background := context.Background()
+
+	archive, err := export.Build(background, s.db, s.storage, dataExport.UserID)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("exports/%s/%s.zip", dataExport.UserID, dataExport.ID)
+	downloadURL, err := s.storage.Store(background, key, bytes.NewReader(archive), dataExportTTL)
+	if err != nil {
+		return err
+	}
+
+	completedAt := time.Now()
+	expiresAt := completedAt.Add(dataExportTTL)
+	if err := s.db.Model(&models.DataExport{}).Where("id = ?", dataExport.ID).Updates(map[string]interface{}{
+		"status":       models.DataExportReady,
+		"object_key":   key,
+		"completed_at": completedAt,
+		"expires_at":   expiresAt,
+	}).Error; err != nil {
+		return err
+	}
+
+	user := models.User{}
+	if err := s.db.Where("id = ?", dataExport.UserID).Limit(1).Find(&user).Error; err != nil || user.ID == "" {
+		return fmt.Errorf("failed to retrieve user %s", dataExport.UserID)
+	}
+
+	msg, err := mailer.NewMessage(user.Email, "Your data export is ready", "data_export_ready", fiber.Map{
+		"FirstName":   user.FirstName,
+		"DownloadURL": downloadURL,
+		"ExpiresOn":   expiresAt.UTC().Format("January 2, 2006 15:04 MST"),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mail.Send(msg)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"blog_post/apperror"
+	"blog_post/digest"
+	"blog_post/models"
+
+	"bytes"
+	"github.com/gofiber/fiber/v2"
+	"html/template"
+	"log"
+)
+
+func (s *Server) HandleGetEmailPreferences(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	preference, err := digest.GetOrCreatePreference(s.db, userID)
+	if err != nil {
+		return apperror.Internal("Failed to retrieve email preferences", err)
+	}
+
+	return ctx.JSON(fiber.Map{
+		"digest":       preference.Digest,
+		"lastDigestAt": preference.LastDigestAt,
+	})
+}
+
+func (s *Server) HandleUpdateEmailPreferences(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	var body struct {
+		Digest string `json:"digest" validate:"trim,lower,required,oneof=daily weekly off"`
+	}
+
+	if err := parseBody(ctx, &body); err != nil {
+		return err
+	}
+
+	if _, err := digest.GetOrCreatePreference(s.db, userID); err != nil {
+		return apperror.Internal("Failed to retrieve email preferences", err)
+	}
+
+	if err := s.db.Model(&models.EmailPreference{}).Where("user_id = ?", userID).Update("digest", body.Digest).Error; err != nil {
+		return apperror.Internal("Failed to update email preferences", err)
+	}
+
+	return ctx.JSON(fiber.Map{"message": "Email preferences updated", "digest": body.Digest})
+}
+
+// unsubscribePage asks for confirmation and posts the same form field a mail
+// client sends for a one-click unsubscribe.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body>
+<p>Stop receiving digest emails?</p>
+<form method="post" action="{{.}}">
+<input type="hidden" name="List-Unsubscribe" value="One-Click">
+<button type="submit">Unsubscribe</button>
+</form>
+</body>
+</html>
+`))
+
+// HandleUnsubscribePage only shows a confirmation: link scanners and
+// prefetching open the URL of every email, so GET must not change anything.
+func (s *Server) HandleUnsubscribePage(ctx *fiber.Ctx) error {
+	token := ctx.Params("token")
+	exists, err := digest.UnsubscribeTokenExists(s.db, token)
+	if err != nil {
+		return apperror.Internal("Failed to retrieve email preferences", err)
+	}
+	if !exists {
+		return ctx.Status(fiber.StatusNotFound).SendString("This unsubscribe link is invalid.")
+	}
+
+	var page bytes.Buffer
+	if err := unsubscribePage.Execute(&page, digest.UnsubscribeURL(s.config.APIURL, token)); err != nil {
+		return apperror.Internal("Failed to render page", err)
+	}
+
+	ctx.Type("html", "utf-8")
+	return ctx.Send(page.Bytes())
+}
+
+// HandleUnsubscribe turns the digest off. It answers both the confirmation
+// page and one-click requests from mail clients (RFC 8058).
+func (s *Server) HandleUnsubscribe(ctx *fiber.Ctx) error {
+	if err := digest.Unsubscribe(s.db, ctx.Params("token")); err != nil {
+		log.Println("Unsubscribe failed:", err)
+		return ctx.Status(fiber.StatusNotFound).SendString("This unsubscribe link is invalid.")
+	}
+
+	return ctx.SendString("You have been unsubscribed from digest emails.")
+}
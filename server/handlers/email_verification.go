@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"blog_post/apperror"
+	"blog_post/mailer"
+	"blog_post/models"
+
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"net/url"
+	"time"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+var errEmailNotVerified = errors.New("email not verified")
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newToken() (string, error) {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return hex.EncodeToString(token), nil
+}
+
+func (s *Server) SendEmailVerification(user models.User, email string) error {
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.Where("user_id = ?", user.ID).Delete(&models.EmailVerification{}).Error; err != nil {
+		return err
+	}
+
+	verification := models.EmailVerification{
+		UserID:    user.ID,
+		Email:     email,
+		TokenHash: hashToken(token),
+		ExpireAt:  time.Now().Add(emailVerificationTTL),
+	}
+	if err := s.db.Omit("User").Create(&verification).Error; err != nil {
+		return err
+	}
+
+	msg, err := mailer.NewMessage(email, "Verify your email address", "verify_email", fiber.Map{
+		"FirstName": user.FirstName,
+		"VerifyURL": fmt.Sprintf("%s/verifyEmail?token=%s", s.config.AppURL, url.QueryEscape(token)),
+		"ExpiresIn": "24 hours",
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mail.Send(msg)
+}
+
+func (s *Server) requireVerifiedUser(userID string) (models.User, error) {
+	user, err := s.repos.Users.Get(userID)
+	if err != nil {
+		return user, err
+	}
+
+	if !user.EmailVerified {
+		return user, errEmailNotVerified
+	}
+
+	return user, nil
+}
+
+func (s *Server) HandleVerifyEmail(ctx *fiber.Ctx) error {
+	var body struct {
+		Token string `json:"token" validate:"trim,required"`
+	}
+
+	if err := parseBody(ctx, &body); err != nil {
+		return err
+	}
+
+	verification := models.EmailVerification{}
+	if err := s.db.Where("token_hash = ?", hashToken(body.Token)).Limit(1).Find(&verification).Error; err != nil {
+		return apperror.Internal("Failed to retrieve verification", err)
+	}
+
+	if verification.ID == "" || time.Now().After(verification.ExpireAt) {
+		return apperror.BadRequest("Invalid or expired verification link")
+	}
+
+	var emailTaken int64
+	if err := s.db.Model(&models.User{}).Where("email = ? AND id <> ?", verification.Email, verification.UserID).Count(&emailTaken).Error; err != nil {
+		return apperror.Internal("Failed to verify email", err)
+	}
+	if emailTaken > 0 {
+		return apperror.Conflict("Email is already in use")
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", verification.UserID).Updates(map[string]interface{}{
+			"email":          verification.Email,
+			"email_verified": true,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", verification.UserID).Delete(&models.EmailVerification{}).Error
+	})
+	if err != nil {
+		return apperror.Internal("Failed to verify email", err)
+	}
+
+	RecordAudit(ctx, s.db, verification.UserID, AuditEmailVerified, "user", verification.UserID, fiber.Map{"email": verification.Email})
+
+	return ctx.JSON(fiber.Map{"message": "Email verified successfully", "email": verification.Email})
+}
+
+func (s *Server) HandleResendVerification(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	user := models.User{}
+	if err := s.db.Where("id = ?", userID).Find(&user).Error; err != nil || user.ID == "" {
+		return apperror.Internal("Failed to retrieve user", err)
+	}
+
+	pending := models.EmailVerification{}
+	if err := s.db.Where("user_id = ?", userID).Limit(1).Find(&pending).Error; err != nil {
+		return apperror.Internal("Failed to retrieve verification", err)
+	}
+
+	email := user.Email
+	if pending.ID != "" {
+		email = pending.Email
+	} else if user.EmailVerified {
+		return apperror.Conflict("Email is already verified")
+	}
+
+	if err := s.SendEmailVerification(user, email); err != nil {
+		return apperror.Internal("Failed to send verification email", err)
+	}
+
+	return ctx.JSON(fiber.Map{"message": "Verification email sent"})
+}
+
+func (s *Server) SendAccountExistsEmail(user models.User) error {
+	msg, err := mailer.NewMessage(user.Email, "Sign-up attempt with your email address", "account_exists", fiber.Map{
+		"FirstName": user.FirstName,
+		"SignInURL": fmt.Sprintf("%s/signIn", s.config.AppURL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mail.Send(msg)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"log"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+)
+
+// EventHub pushes realtime events to websocket clients.
+type EventHub interface {
+	// Serve keeps conn subscribed until it disconnects.
+	Serve(conn *websocket.Conn)
+	Broadcast(message interface{})
+	SendToUser(message interface{}, userID string)
+}
+
+// Hub is the in-process EventHub used by the server.
+type Hub struct {
+	mu      sync.Mutex
+	clients map[*websocket.Conn]bool
+}
+
+func NewHub() *Hub {
+	return &Hub{clients: map[*websocket.Conn]bool{}}
+}
+
+func HandleWebSocket(c *fiber.Ctx) error {
+	if websocket.IsWebSocketUpgrade(c) {
+		c.Locals("allowed", true)
+		return c.Next()
+	}
+	return fiber.ErrUpgradeRequired
+}
+
+func (h *Hub) Serve(c *websocket.Conn) {
+	log.Println("WebSocket client connected")
+	h.mu.Lock()
+	h.clients[c] = true
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.clients, c)
+		h.mu.Unlock()
+		log.Println("WebSocket client disconnected")
+		c.Close()
+	}()
+
+	for {
+		var message interface{}
+		err := c.ReadJSON(&message)
+		if err != nil {
+			log.Println("WebSocket read error:", err)
+			break
+		}
+	}
+}
+
+func (h *Hub) Broadcast(message interface{}) {
+	h.send(message, func(*websocket.Conn) bool { return true })
+}
+
+func (h *Hub) SendToUser(message interface{}, userID string) {
+	h.send(message, func(client *websocket.Conn) bool {
+		connUserID, _ := client.Locals("userId").(string)
+		return connUserID == userID
+	})
+}
+
+func (h *Hub) send(message interface{}, include func(*websocket.Conn) bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.clients {
+		if !include(client) {
+			continue
+		}
+
+		err := client.WriteJSON(message)
+		if err != nil {
+			log.Println("WebSocket write error:", err)
+
+			delete(h.clients, client)
+		}
+	}
+}
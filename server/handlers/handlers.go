@@ -1,56 +1,85 @@
 package handlers
 
 import (
+	"blog_post/apperror"
 	"blog_post/db_aws"
+	"blog_post/mailer"
 	"blog_post/models"
+	"blog_post/repo"
 
-	"fmt"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/websocket/v2"
 	"github.com/google/uuid"
-	gomail "gopkg.in/gomail.v2"
-	"gorm.io/gorm"
 	"log"
-	"os"
 	"time"
 )
 
-func HandleUserInfo(ctx *fiber.Ctx, db *gorm.DB) error {
+func (s *Server) HandleUserInfo(ctx *fiber.Ctx) error {
 	userID := ctx.Params("userId")
 
-	user := models.User{}
-	if err := db.Where("id = ?", userID).Find(&user).Error; err != nil {
-		return ctx.JSON(fiber.Map{"message": "Failed to retrieve user"})
+	user, err := s.repos.Users.Get(userID)
+	if err == repo.ErrNotFound {
+		return apperror.NotFound("User not found")
+	}
+	if err != nil {
+		return apperror.Internal("Failed to retrieve user", err)
 	}
 
 	return ctx.JSON(fiber.Map{
-		"firstName": user.FirstName,
-		"lastName":  user.LastName,
-		"email":     user.Email,
-		"imageUrl":  user.Image,
+		"firstName":     user.FirstName,
+		"lastName":      user.LastName,
+		"email":         user.Email,
+		"emailVerified": user.EmailVerified,
+		"role":          user.Role,
+		"imageUrl":      user.Image,
 	})
 }
 
-func HandlePasswordForgotten(ctx *fiber.Ctx, db *gorm.DB) error {
+func (s *Server) HandlePasswordForgotten(ctx *fiber.Ctx) error {
 	var Body struct {
-		Email string `json:"email"`
+		Email string `json:"email" validate:"trim,lower,required"`
 	}
 
-	if err := ctx.BodyParser(&Body); err != nil {
-		return ctx.JSON(fiber.Map{"error": "Invalid request body"})
+	if err := parseBody(ctx, &Body); err != nil {
+		return err
 	}
 
-	user := models.User{}
-	if err := db.Where("email = ?", Body.Email).Find(&user).Error; err != nil {
-		return ctx.JSON(fiber.Map{"error": "Failed to retrieve user"})
+	accepted := fiber.Map{"message": "If an account exists for this email, a reset code has been sent"}
+
+	user, err := s.repos.Users.GetByEmail(Body.Email)
+	if err != nil && err != repo.ErrNotFound {
+		return apperror.Internal("Failed to retrieve user", err)
 	}
 
 	if user.ID == "" {
-		return ctx.JSON(fiber.Map{"error": "Invalid email"})
+		log.Printf("Password reset requested for unknown email %q", Body.Email)
+		return ctx.JSON(accepted)
+	}
+
+	// Everything past the lookup happens in the background, so that known
+	// and unknown emails take the same time to answer.
+	event := newAuditEvent(ctx, "", AuditPasswordResetRequested, "user", user.ID, nil)
+	go func() {
+		if err := s.sendResetCode(user); err != nil {
+			log.Printf("Failed to send password reset code to user %s: %v", user.ID, err)
+			return
+		}
+		saveAuditEvent(s.db, event)
+	}()
+
+	return ctx.JSON(accepted)
+}
+
+// sendResetCode replaces any previous reset code of user with a new one and
+// emails it.
+func (s *Server) sendResetCode(user models.User) error {
+	code, err := generateResetCode()
+	if err != nil {
+		return err
 	}
 
-	code := uuid.New().String()[:6]
+	if err := s.db.Where("user_id = ?", user.ID).Delete(&models.Code{}).Error; err != nil {
+		return err
+	}
 
 	codeData := models.Code{
 		ID:       uuid.New().String(),
@@ -58,262 +87,344 @@ func HandlePasswordForgotten(ctx *fiber.Ctx, db *gorm.DB) error {
 		Code:     code,
 		ExpireAt: time.Now().Add(105 * time.Second),
 	}
-
-	if err := db.Create(&codeData).Error; err != nil {
-		return ctx.JSON(fiber.Map{"error": "Failed to create code"})
-	}
-
-	err := SendEmail(Body.Email, code)
-	if err != nil {
-		return ctx.JSON(fiber.Map{"error": "Failed to send email"})
+	if err := s.db.Create(&codeData).Error; err != nil {
+		return err
 	}
 
-	return ctx.JSON(fiber.Map{"message": "Email sent"})
+	return SendEmail(s.mail, user.Email, code)
 }
 
-func HandleUpdateUserInfo(ctx *fiber.Ctx, db *gorm.DB, s3Client *s3.Client) error {
-	var Body struct {
-		FirstName string `json:"firstName"`
-		LastName  string `json:"lastName"`
-		Email     string `json:"email"`
+func (s *Server) HandleUpdateUserInfo(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
 	}
 
-	if err := ctx.BodyParser(&Body); err != nil {
-		return ctx.JSON(fiber.Map{"message": "Invalid request body"})
+	var Body struct {
+		FirstName string `json:"firstName" validate:"trim,required,max=100"`
+		LastName  string `json:"lastName" validate:"trim,required,max=100"`
+		Email     string `json:"email" validate:"trim,lower,omitempty,email,max=100"`
 	}
 
-	userID := ctx.Cookies("userId")
-	if userID == "" {
-		return ctx.JSON(fiber.Map{"message": "User not authenticated"})
+	if err := parseBody(ctx, &Body); err != nil {
+		return err
 	}
 
-	user := models.User{}
-	if err := db.Where("id = ?", userID).Find(&user).Error; err != nil {
-		return ctx.JSON(fiber.Map{"message": "Failed to retrieve user"})
+	user, err := s.repos.Users.Get(userID)
+	if err != nil {
+		return apperror.Internal("Failed to retrieve user", err)
 	}
 
 	user.FirstName = Body.FirstName
 	user.LastName = Body.LastName
-	user.Email = Body.Email
+
+	emailChanged := Body.Email != "" && Body.Email != user.Email
+	if emailChanged {
+		emailTaken, err := s.repos.Users.EmailTaken(Body.Email)
+		if err != nil {
+			return apperror.Internal("Failed to retrieve user", err)
+		}
+		if emailTaken {
+			return apperror.Conflict("Email is already in use")
+		}
+	}
 
 	if file, err := ctx.FormFile("image"); err == nil && file != nil {
 		imageKey := uuid.New().String() + file.Filename
 		fileContent, err := file.Open()
 		if err != nil {
-			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to open file"})
+			return apperror.Internal("Failed to open file", err)
 		}
 		defer fileContent.Close()
 
-		if user.Image != "" {
-			if err := db_aws.DeleteDataFromS3(ctx.Context(), s3Client, user.Image); err != nil {
-				return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to delete old image"})
+		oldImageKey := user.ImageKey
+		if oldImageKey == "" && user.Image != "" {
+			oldImageKey = s.storage.KeyFromURL(user.Image)
+		}
+		if oldImageKey != "" {
+			if err := s.storage.Delete(ctx.Context(), oldImageKey); err != nil {
+				return apperror.Internal("Failed to delete old image", err)
 			}
 		}
 
-		imageUrl, err := db_aws.StoreDataToS3(ctx.Context(), s3Client, imageKey, fileContent)
+		imageUrl, err := s.storage.Store(ctx.Context(), imageKey, fileContent, db_aws.MaxURLExpiry)
 		if err != nil {
-			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to upload image"})
+			return apperror.Internal("Failed to upload image", err)
 		}
 
 		user.Image = imageUrl
+		user.ImageKey = imageKey
 	}
 
-	if err := db.Save(&user).Error; err != nil {
-		return ctx.JSON(fiber.Map{"message": "Failed to update user"})
+	if err := s.repos.Users.Save(&user); err != nil {
+		return apperror.Internal("Failed to update user", err)
+	}
+
+	if emailChanged {
+		RecordAudit(ctx, s.db, user.ID, AuditEmailChangeRequested, "user", user.ID, fiber.Map{"from": user.Email, "to": Body.Email})
+
+		if err := s.SendEmailVerification(user, Body.Email); err != nil {
+			return apperror.Internal("Failed to send verification email", err)
+		}
+
+		return ctx.JSON(fiber.Map{"message": "User Info updated successfully. Check your new email address to confirm the change"})
 	}
 
 	return ctx.JSON(fiber.Map{"message": "User Info updated successfully"})
 }
 
-func HandleUpdatePassword(ctx *fiber.Ctx, db *gorm.DB) error {
-	var Body struct {
-		NewPassword string `json:"newPassword"`
+func (s *Server) HandleUpdatePassword(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
 	}
 
-	if err := ctx.BodyParser(&Body); err != nil {
-		return ctx.JSON(fiber.Map{"message": "Invalid request body"})
+	var Body struct {
+		NewPassword string `json:"newPassword" validate:"required,min=8,max=128"`
 	}
 
-	userID := ctx.Cookies("userId")
-	if userID == "" {
-		return ctx.JSON(fiber.Map{"message": "User not authenticated"})
+	if err := parseBody(ctx, &Body); err != nil {
+		return err
 	}
 
-	user := models.User{}
-	if err := db.Where("id = ?", userID).Find(&user).Error; err != nil {
-		return ctx.JSON(fiber.Map{"message": "Failed to retrieve user"})
+	user, err := s.repos.Users.Get(userID)
+	if err != nil {
+		return apperror.Internal("Failed to retrieve user", err)
 	}
 
-	hashedPassword, err := db_aws.HashPassword(Body.NewPassword)
+	hashedPassword, err := db_aws.HashPassword(Body.NewPassword, s.passwordParams)
 	if err != nil {
-		return ctx.JSON(fiber.Map{"message": "Failed to hash password"})
+		return apperror.Internal("Failed to hash password", err)
 	}
 
-	user.HashPassword = hashedPassword
+	if err := s.repos.Users.SetPasswordHash(user.ID, hashedPassword); err != nil {
+		return apperror.Internal("Failed to update user", err)
+	}
 
-	if err := db.Save(&user).Error; err != nil {
-		return ctx.JSON(fiber.Map{"message": "Failed to update user"})
+	if err := RevokeUserSessions(s.db, user.ID, currentSessionID(ctx)); err != nil {
+		log.Printf("Failed to revoke other sessions for user %s: %v", user.ID, err)
 	}
 
+	RecordAudit(ctx, s.db, user.ID, AuditPasswordChanged, "user", user.ID, nil)
+
 	return ctx.JSON(fiber.Map{"message": "Password updated successfully"})
 }
 
-func HandleSignIn(ctx *fiber.Ctx, db *gorm.DB) error {
+func (s *Server) HandleSignIn(ctx *fiber.Ctx) error {
 	var Body struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email    string `json:"email" validate:"trim,lower,required"`
+		Password string `json:"password" validate:"required"`
 	}
 
-	if err := ctx.BodyParser(&Body); err != nil {
-		return ctx.JSON(fiber.Map{"message": "Invalid request body"})
+	if err := parseBody(ctx, &Body); err != nil {
+		return err
 	}
 
-	user := models.User{}
-	if err := db.Where("email = ?", Body.Email).Find(&user).Error; err != nil {
-		return ctx.JSON(fiber.Map{"message": "Failed to retrieve user"})
+	user, err := s.repos.Users.GetByEmail(Body.Email)
+	if err != nil && err != repo.ErrNotFound {
+		return apperror.Internal("Failed to retrieve user", err)
 	}
 
 	if user.ID == "" {
-		return ctx.JSON(fiber.Map{"message": "Invalid email"})
+		s.verifyDummyPassword(Body.Password)
+		log.Printf("Sign-in failed for unknown email %q", Body.Email)
+		RecordAudit(ctx, s.db, "", AuditSignInFailed, "", "", fiber.Map{"email": Body.Email, "reason": "unknown_email"})
+		return invalidCredentials(ctx)
 	}
 
-	if err := db_aws.VerifyPassword(Body.Password, user.HashPassword); err != nil {
-		return ctx.JSON(fiber.Map{"message": "Invalid password"})
+	if remaining := lockedFor(user); remaining > 0 {
+		s.verifyDummyPassword(Body.Password)
+		log.Printf("Sign-in failed for user %s: account locked for another %s", user.ID, remaining.Round(time.Second))
+		RecordAudit(ctx, s.db, "", AuditSignInFailed, "user", user.ID, fiber.Map{"reason": "locked"})
+		return invalidCredentials(ctx)
 	}
 
-	ctx.Cookie(&fiber.Cookie{
-		Name:    "userId",
-		Value:   user.ID,
-		Expires: time.Now().Add(24 * time.Hour),
-	})
-
-	newUser := fiber.Map{
-		"id":        user.ID,
-		"firstName": user.FirstName,
-		"lastName":  user.LastName,
-		"email":     user.Email,
-	}
-
-	return ctx.JSON(newUser)
-}
-
-func HandleSignUp(ctx *fiber.Ctx, db *gorm.DB) error {
-	var Body struct {
-		FirstName string `json:"firstName"`
-		LastName  string `json:"lastName"`
-		Email     string `json:"email"`
-		Password  string `json:"password"`
+	if err := db_aws.VerifyPassword(Body.Password, user.HashPassword); err != nil {
+		if err := registerFailedLogin(s.db, &user); err != nil {
+			log.Println("Failed to record failed sign-in:", err)
+		}
+		log.Printf("Sign-in failed for user %s: %v", user.ID, err)
+		RecordAudit(ctx, s.db, "", AuditSignInFailed, "user", user.ID, fiber.Map{"reason": "invalid_password", "failedLogins": user.FailedLogins})
+		if lockedFor(user) > 0 {
+			RecordAudit(ctx, s.db, "", AuditAccountLocked, "user", user.ID, fiber.Map{"lockedUntil": user.LockedUntil})
+		}
+		return invalidCredentials(ctx)
 	}
 
-	if err := ctx.BodyParser(&Body); err != nil {
-		return ctx.JSON(fiber.Map{"message": "Invalid request body"})
+	if db_aws.PasswordNeedsRehash(user.HashPassword, s.passwordParams) {
+		if hashedPassword, err := db_aws.HashPassword(Body.Password, s.passwordParams); err != nil {
+			log.Printf("Failed to rehash password for user %s: %v", user.ID, err)
+		} else if err := s.repos.Users.SetPasswordHash(user.ID, hashedPassword); err != nil {
+			log.Printf("Failed to store rehashed password for user %s: %v", user.ID, err)
+		}
 	}
 
-	existingUser := models.User{}
-	if err := db.Where("email = ?", Body.Email).Find(&existingUser).Error; err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Failed to retrieve user"})
-	}
+	if user.TOTPEnabled {
+		challengeToken, err := createTwoFactorChallenge(s.db, user.ID)
+		if err != nil {
+			return apperror.Internal("Failed to start two-factor challenge", err)
+		}
 
-	if existingUser.ID != "" {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "User already exists"})
+		return ctx.JSON(fiber.Map{
+			"twoFactorRequired": true,
+			"challengeToken":    challengeToken,
+		})
 	}
 
-	hashedPassword, err := db_aws.HashPassword(Body.Password)
-	if err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Failed to hash password"})
-	}
+	return s.completeSignIn(ctx, user)
+}
 
-	user := models.User{
-		ID:           uuid.New().String(),
-		FirstName:    Body.FirstName,
-		LastName:     Body.LastName,
-		Email:        Body.Email,
-		HashPassword: hashedPassword,
+// completeSignIn starts the session once every factor has been checked. Only
+// then are earlier failures forgotten, so a known password does not reset the
+// count of failed second factors.
+func (s *Server) completeSignIn(ctx *fiber.Ctx, user models.User) error {
+	if err := resetFailedLogins(s.db, &user); err != nil {
+		log.Println("Failed to reset failed sign-ins:", err)
 	}
 
-	if err := db.Create(&user).Error; err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Failed to create user"})
+	if err := s.createSession(ctx, user.ID); err != nil {
+		return apperror.Internal("Failed to create session", err)
 	}
 
-	ctx.Cookie(&fiber.Cookie{
-		Name:    "userId",
-		Value:   user.ID,
-		Expires: time.Now().Add(24 * time.Hour),
-	})
-
 	newUser := fiber.Map{
-		"id":        user.ID,
-		"firstName": user.FirstName,
-		"lastName":  user.LastName,
-		"email":     user.Email,
+		"id":            user.ID,
+		"firstName":     user.FirstName,
+		"lastName":      user.LastName,
+		"email":         user.Email,
+		"emailVerified": user.EmailVerified,
+		"role":          user.Role,
 	}
 
 	return ctx.JSON(newUser)
 }
 
-func HandleDeleteUser(ctx *fiber.Ctx, db *gorm.DB, s3Client *s3.Client) error {
-	userID := ctx.Cookies("userId")
-	if userID == "" {
-		return ctx.JSON(fiber.Map{"message": "User not authenticated"})
+func (s *Server) HandleSignUp(ctx *fiber.Ctx) error {
+	var Body struct {
+		FirstName string `json:"firstName" validate:"trim,required,max=100"`
+		LastName  string `json:"lastName" validate:"trim,required,max=100"`
+		Email     string `json:"email" validate:"trim,lower,required,email,max=100"`
+		Password  string `json:"password" validate:"required,min=8,max=128"`
+	}
+
+	if err := parseBody(ctx, &Body); err != nil {
+		return err
 	}
 
-	user := models.User{}
-	if err := db.Where("id = ?", userID).Find(&user).Error; err != nil {
-		return ctx.JSON(fiber.Map{"message": "Failed to retrieve user"})
+	accepted := fiber.Map{"message": "Check your email to finish signing up"}
+
+	existingUser, err := s.repos.Users.GetByEmailWithDeleted(Body.Email)
+	if err != nil && err != repo.ErrNotFound {
+		return apperror.Internal("Failed to retrieve user", err)
 	}
 
-	if err := db_aws.DeleteDataFromS3(ctx.Context(), s3Client, user.Image); err != nil {
-		return ctx.JSON(fiber.Map{"message": "Failed to delete user image"})
+	// Hash before looking at the result, so that the Argon2 cost does not
+	// reveal whether the email is taken.
+	hashedPassword, err := db_aws.HashPassword(Body.Password, s.passwordParams)
+	if err != nil {
+		return apperror.Internal("Failed to hash password", err)
 	}
 
-	if err := db.Where("post_id IN (SELECT id FROM posts WHERE user_id = ?)", userID).Delete(&models.PostTag{}).Error; err != nil {
-		return ctx.JSON(fiber.Map{"message": "Failed to delete post tags"})
+	if existingUser.ID == "" {
+		user := models.User{
+			ID:           uuid.New().String(),
+			FirstName:    Body.FirstName,
+			LastName:     Body.LastName,
+			Email:        Body.Email,
+			HashPassword: hashedPassword,
+		}
+
+		err := s.repos.Users.Create(&user)
+		if err == nil {
+			RecordAudit(ctx, s.db, user.ID, AuditSignUp, "user", user.ID, nil)
+			go func() {
+				if err := s.SendEmailVerification(user, user.Email); err != nil {
+					log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
+				}
+			}()
+			return ctx.Status(fiber.StatusAccepted).JSON(accepted)
+		}
+		if err != repo.ErrEmailTaken {
+			return apperror.Internal("Failed to create user", err)
+		}
+
+		// Another sign-up took the email after it was looked up.
+		existingUser, err = s.repos.Users.GetByEmailWithDeleted(Body.Email)
+		if err != nil {
+			return apperror.Internal("Failed to retrieve user", err)
+		}
 	}
 
-	if err := db.Delete(&user).Error; err != nil {
-		return ctx.JSON(fiber.Map{"message": "Failed to delete user"})
+	// The email stays taken until a deleted account is purged, so its owner
+	// is told, with a way to get the account back.
+	if existingUser.DeletedAt.Valid {
+		log.Printf("Sign-up attempted with the email of deleted user %s", existingUser.ID)
+		go func() {
+			if err := s.sendPendingDeletionEmail(existingUser); err != nil {
+				log.Printf("Failed to send pending deletion email to user %s: %v", existingUser.ID, err)
+			}
+		}()
+		return ctx.Status(fiber.StatusAccepted).JSON(accepted)
 	}
 
-	return ctx.JSON(fiber.Map{"message": "User deleted successfully"})
+	log.Printf("Sign-up attempted with existing email for user %s", existingUser.ID)
+	go func() {
+		if err := s.SendAccountExistsEmail(existingUser); err != nil {
+			log.Printf("Failed to send account exists email to user %s: %v", existingUser.ID, err)
+		}
+	}()
+	return ctx.Status(fiber.StatusAccepted).JSON(accepted)
 }
 
-func HandleGetTags(ctx *fiber.Ctx, db *gorm.DB) error {
-	tags := []models.Tag{}
-	if err := db.Find(&tags).Error; err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to retrieve tags"})
+func (s *Server) HandleGetTags(ctx *fiber.Ctx) error {
+	tags, err := s.repos.Tags.List()
+	if err != nil {
+		return apperror.Internal("Failed to retrieve tags", err)
 	}
 	return ctx.JSON(tags)
 }
 
-func HandleGetPosts(ctx *fiber.Ctx, db *gorm.DB) error {
-	posts := []models.Post{}
-	if err := db.Preload("Comments", func(db *gorm.DB) *gorm.DB {
-		return db.Order("created_at DESC").Preload("User").Preload("Likes")
-	}).Preload("Likes").Preload("Tags").Find(&posts).Error; err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to retrieve posts"})
+func (s *Server) HandleGetPosts(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
 	}
 
-	userID := ctx.Cookies("userId")
-	if userID == "" {
-		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "User not authenticated"})
+	// Hidden content stays visible to its author and to moderators.
+	posts, err := s.repos.Posts.List(userID, s.userHasPermission(userID, PermissionModerate))
+	if err != nil {
+		return apperror.Internal("Failed to retrieve posts", err)
+	}
+
+	likedComments, err := s.repos.Likes.LikedCommentIDs(userID)
+	if err != nil {
+		return apperror.Internal("Failed to retrieve user comment likes", err)
+	}
+
+	likedPosts, err := s.repos.Likes.LikedPostIDs(userID)
+	if err != nil {
+		return apperror.Internal("Failed to retrieve user post likes", err)
 	}
 
 	var result []fiber.Map
 	for _, post := range posts {
-		userCommentLikes := []models.CommentLike{}
-		if err := db.Where("user_id = ?", userID).Find(&userCommentLikes).Error; err != nil {
-			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to retrieve user comment likes"})
-		}
-
 		comments := []fiber.Map{}
-		for _, comment := range post.Comments {
-			likedByMe := false
-			for _, like := range userCommentLikes {
-				if like.CommentID == comment.ID {
-					likedByMe = true
-					break
-				}
+		for _, comment := range threadComments(post.Comments) {
+			if comment.DeletedAt.Valid {
+				comments = append(comments, fiber.Map{
+					"id":        comment.ID,
+					"message":   "[deleted]",
+					"parentId":  comment.ParentID,
+					"createdAt": comment.CreatedAt,
+					"updatedAt": comment.UpdatedAt,
+					"user":      nil,
+					"likeCount": 0,
+					"likedByMe": false,
+					"hidden":    false,
+					"deleted":   true,
+				})
+				continue
 			}
+
 			comments = append(comments, fiber.Map{
 				"id":        comment.ID,
 				"message":   comment.Message,
@@ -325,22 +436,11 @@ func HandleGetPosts(ctx *fiber.Ctx, db *gorm.DB) error {
 					"name": comment.User.FirstName,
 				},
 				"likeCount": len(comment.Likes),
-				"likedByMe": likedByMe,
+				"likedByMe": likedComments[comment.ID],
+				"hidden":    comment.Hidden,
 			})
 		}
 
-		userPostLikes := []models.PostLike{}
-		if err := db.Where("user_id = ?", userID).Find(&userPostLikes).Error; err != nil {
-			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to retrieve user post likes"})
-		}
-		likedByMe := false
-		for _, like := range userPostLikes {
-			if like.PostID == post.ID {
-				likedByMe = true
-				break
-			}
-		}
-
 		newPost := fiber.Map{
 			"id": post.ID,
 			"user": fiber.Map{
@@ -351,11 +451,12 @@ func HandleGetPosts(ctx *fiber.Ctx, db *gorm.DB) error {
 			"body":      post.Body,
 			"imageUrl":  post.Image,
 			"likeCount": len(post.Likes),
-			"likedByMe": likedByMe,
+			"likedByMe": likedPosts[post.ID],
 			"createdAt": post.CreatedAt,
 			"updatedAt": post.UpdatedAt,
 			"comments":  comments,
 			"tags":      post.Tags,
+			"hidden":    post.Hidden,
 		}
 
 		result = append(result, newPost)
@@ -364,57 +465,88 @@ func HandleGetPosts(ctx *fiber.Ctx, db *gorm.DB) error {
 	return ctx.JSON(result)
 }
 
-func HandleAddPost(ctx *fiber.Ctx, db *gorm.DB, s3Client *s3.Client, clients map[*websocket.Conn]bool) error {
+// threadComments drops deleted comments unless one of their replies is still
+// shown, in which case they stay as placeholders to hold the thread together.
+func threadComments(comments []models.Comment) []models.Comment {
+	children := map[string][]models.Comment{}
+	for _, comment := range comments {
+		if comment.ParentID != nil {
+			children[*comment.ParentID] = append(children[*comment.ParentID], comment)
+		}
+	}
+
+	kept := map[string]bool{}
+	var keep func(comment models.Comment) bool
+	keep = func(comment models.Comment) bool {
+		if result, seen := kept[comment.ID]; seen {
+			return result
+		}
+		kept[comment.ID] = false
+
+		result := !comment.DeletedAt.Valid
+		for _, child := range children[comment.ID] {
+			if keep(child) {
+				result = true
+			}
+		}
+		kept[comment.ID] = result
+		return result
+	}
+
+	thread := []models.Comment{}
+	for _, comment := range comments {
+		if keep(comment) {
+			thread = append(thread, comment)
+		}
+	}
+	return thread
+}
+
+func (s *Server) HandleAddPost(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
 	var body struct {
-		UserId string   `json:"userId"`
-		Title  string   `json:"title"`
-		Body   string   `json:"body"`
-		Tags   []string `json:"tags"`
+		Title string   `json:"title" validate:"trim,required,max=255"`
+		Body  string   `json:"body" validate:"trim,required,max=20000"`
+		Tags  []string `json:"tags" validate:"max=10" each:"trim,required,max=50"`
 	}
 
-	if err := ctx.BodyParser(&body); err != nil || body.UserId == "" || body.Title == "" || body.Body == "" {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Title, body, and UserId are required"})
+	if err := parseBody(ctx, &body); err != nil {
+		return err
 	}
 
-	tx := db.Begin()
+	if _, err := s.requireVerifiedUser(userID); err != nil {
+		return apperror.Forbidden("Verify your email address before posting").WithCode(apperror.CodeEmailNotVerified)
+	}
 
-	tags := []models.Tag{}
-	for _, tagName := range body.Tags {
-		tag := models.Tag{}
-		if err := tx.Where("name = ?", tagName).First(&tag).Error; err != nil {
-			if err := tx.Create(&models.Tag{Name: tagName}).Error; err != nil {
-				tx.Rollback()
-				return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to create tag"})
-			}
-			tx.Where("name = ?", tagName).First(&tag)
-		}
-		tags = append(tags, tag)
+	file, err := ctx.FormFile("image")
+	if err != nil || file == nil {
+		return apperror.Unprocessable("Image is required")
 	}
 
-	var imageUrl string
-	var imageKey string
-	if file, err := ctx.FormFile("image"); err == nil && file != nil {
-		imageKey = uuid.New().String() + file.Filename
+	tags, err := s.repos.Tags.FindOrCreate(body.Tags)
+	if err != nil {
+		return apperror.Internal("Failed to create tag", err)
+	}
 
-		fileContent, err := file.Open()
-		if err != nil {
-			tx.Rollback()
-			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to open file"})
-		}
-		defer fileContent.Close()
+	imageKey := uuid.New().String() + file.Filename
 
-		imageUrl, err = db_aws.StoreDataToS3(ctx.Context(), s3Client, imageKey, fileContent)
-		if err != nil {
-			tx.Rollback()
-			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to upload image to S3"})
-		}
-	} else {
-		tx.Rollback()
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Image is required"})
+	fileContent, err := file.Open()
+	if err != nil {
+		return apperror.Internal("Failed to open file", err)
+	}
+	defer fileContent.Close()
+
+	imageUrl, err := s.storage.Store(ctx.Context(), imageKey, fileContent, db_aws.MaxURLExpiry)
+	if err != nil {
+		return apperror.Internal("Failed to upload image to S3", err)
 	}
 
 	post := models.Post{
-		UserID:    body.UserId,
+		UserID:    userID,
 		Title:     body.Title,
 		Body:      body.Body,
 		Likes:     []models.PostLike{},
@@ -425,13 +557,8 @@ func HandleAddPost(ctx *fiber.Ctx, db *gorm.DB, s3Client *s3.Client, clients map
 		Tags:      tags,
 	}
 
-	if err := tx.Create(&post).Error; err != nil {
-		tx.Rollback()
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to add post"})
-	}
-
-	if err := tx.Commit().Error; err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to commit transaction"})
+	if err := s.repos.Posts.Create(&post); err != nil {
+		return apperror.Internal("Failed to add post", err)
 	}
 
 	newPost := fiber.Map{
@@ -453,29 +580,45 @@ func HandleAddPost(ctx *fiber.Ctx, db *gorm.DB, s3Client *s3.Client, clients map
 		},
 	}
 
-	BroadcastMessage(newPost, clients)
+	s.events.Broadcast(newPost)
 
 	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Post added successfully"})
 }
 
-func HandleUpdatePost(ctx *fiber.Ctx, db *gorm.DB, s3Client *s3.Client, clients map[*websocket.Conn]bool) error {
+func (s *Server) HandleUpdatePost(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
 	postID := ctx.Params("id")
 	var body struct {
-		Title string   `json:"title"`
-		Body  string   `json:"body"`
-		Tags  []string `json:"tags"`
+		Title string   `json:"title" validate:"trim,required,max=255"`
+		Body  string   `json:"body" validate:"trim,required,max=20000"`
+		Tags  []string `json:"tags" validate:"max=10" each:"trim,required,max=50"`
+	}
+
+	if err := parseBody(ctx, &body); err != nil {
+		return err
 	}
 
-	if err := ctx.BodyParser(&body); err != nil || body.Title == "" || body.Body == "" {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Title and body are required"})
+	post, err := s.repos.Posts.Get(postID)
+	if err == repo.ErrNotFound {
+		return apperror.NotFound("Post not found")
+	}
+	if err != nil {
+		return apperror.Internal("Failed to retrieve post", err)
 	}
 
-	post := models.Post{}
-	if err := db.First(&post, "id = ?", postID).Error; err != nil {
-		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Post not found"})
+	allowed, privileged := s.authorizeOwnerOr(userID, post.UserID, PermissionEditAnyPost)
+	if !allowed {
+		return apperror.Forbidden("You do not have permission to edit this post")
 	}
 
-	tx := db.Begin()
+	tags, err := s.repos.Tags.FindOrCreate(body.Tags)
+	if err != nil {
+		return apperror.Internal("Failed to create tag", err)
+	}
 
 	post.Title = body.Title
 	post.Body = body.Body
@@ -486,54 +629,28 @@ func HandleUpdatePost(ctx *fiber.Ctx, db *gorm.DB, s3Client *s3.Client, clients
 
 		fileContent, err := file.Open()
 		if err != nil {
-			tx.Rollback()
-			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to open file"})
+			return apperror.Internal("Failed to open file", err)
 		}
 		defer fileContent.Close()
 
 		if post.ImageKey != "" && post.ImageKey != imageKey {
-			if err := db_aws.DeleteDataFromS3(ctx.Context(), s3Client, post.ImageKey); err != nil {
-				tx.Rollback()
-				log.Println("Error deleting image from S3:", err)
-				return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to delete image on S3"})
+			if err := s.storage.Delete(ctx.Context(), post.ImageKey); err != nil {
+				return apperror.Internal("Failed to delete image on S3", err)
 			}
 		}
 
-		imageUrl, err := db_aws.StoreDataToS3(ctx.Context(), s3Client, imageKey, fileContent)
+		imageUrl, err := s.storage.Store(ctx.Context(), imageKey, fileContent, db_aws.MaxURLExpiry)
 		if err != nil {
-			tx.Rollback()
-			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to upload image"})
+			return apperror.Internal("Failed to upload image", err)
 		}
 
 		post.Image = imageUrl
 		post.ImageKey = imageKey
 	}
 
-	tags := []models.Tag{}
-	for _, tagName := range body.Tags {
-		tag := models.Tag{}
-		if err := tx.Where("name = ?", tagName).First(&tag).Error; err != nil {
-			if err := tx.Create(&models.Tag{Name: tagName}).Error; err != nil {
-				tx.Rollback()
-				return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to create tag"})
-			}
-			tx.Where("name = ?", tagName).First(&tag)
-		}
-		tags = append(tags, tag)
-	}
-
-	if err := tx.Save(&post).Error; err != nil {
-		tx.Rollback()
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to update post"})
-	}
-
-	if err := tx.Model(&post).Association("Tags").Replace(tags); err != nil {
-		tx.Rollback()
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to update post tags"})
-	}
-
-	if err := tx.Commit().Error; err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Transaction failed"})
+	post.Tags = tags
+	if err := s.repos.Posts.Update(&post); err != nil {
+		return apperror.Internal("Failed to update post", err)
 	}
 
 	updatedPost := (fiber.Map{
@@ -548,29 +665,51 @@ func HandleUpdatePost(ctx *fiber.Ctx, db *gorm.DB, s3Client *s3.Client, clients
 		},
 	})
 
-	BroadcastMessage(updatedPost, clients)
+	s.events.Broadcast(updatedPost)
+
+	if privileged {
+		RecordModerationAction(ctx, s.db, userID, "post.edited", "post", post.ID, fiber.Map{"ownerId": post.UserID, "reason": ctx.Query("reason")})
+	}
 
-	return ctx.Status(fiber.StatusOK).JSON("message", "Post updated")
+	return ctx.JSON(fiber.Map{"message": "Post updated"})
 }
 
-func HandleDeletePost(ctx *fiber.Ctx, db *gorm.DB, s3Client *s3.Client, clients map[*websocket.Conn]bool) error {
+func (s *Server) HandleDeletePost(ctx *fiber.Ctx) error {
 	postID := ctx.Params("id")
-	post := models.Post{}
-	if err := db.First(&post, "id = ?", postID).Error; err != nil {
-		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Post not found"})
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
 	}
 
-	err := db_aws.DeleteDataFromS3(ctx.Context(), s3Client, post.ImageKey)
+	post, err := s.repos.Posts.Get(postID)
+	if err == repo.ErrNotFound {
+		return apperror.NotFound("Post not found")
+	}
 	if err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to delete image on S3"})
+		return apperror.Internal("Failed to retrieve post", err)
+	}
+
+	allowed, privileged := s.authorizeOwnerOr(userID, post.UserID, PermissionDeleteAnyPost)
+	if !allowed {
+		return apperror.Forbidden("You do not have permission to delete this post")
+	}
+
+	if err := s.removePost(post, userID); err != nil {
+		return apperror.Internal("Failed to delete post", err)
 	}
 
-	if err := db.Where("post_id = ?", postID).Delete(&models.PostTag{}).Error; err != nil {
-		return ctx.JSON(fiber.Map{"message": "Failed to delete post tags"})
+	if privileged {
+		RecordModerationAction(ctx, s.db, userID, "post.deleted", "post", post.ID, fiber.Map{"ownerId": post.UserID, "title": post.Title, "reason": ctx.Query("reason")})
 	}
 
-	if err := db.Delete(&post).Error; err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to delete post"})
+	return ctx.JSON(fiber.Map{"message": "Post deleted"})
+}
+
+// removePost soft-deletes the post. Its media stays on S3 until the purge job
+// removes the post for good, so the owner can still restore it.
+func (s *Server) removePost(post models.Post, deletedBy string) error {
+	if err := s.repos.Posts.Delete(post.ID, deletedBy); err != nil {
+		return err
 	}
 
 	deletedPost := (fiber.Map{
@@ -580,24 +719,31 @@ func HandleDeletePost(ctx *fiber.Ctx, db *gorm.DB, s3Client *s3.Client, clients
 		},
 	})
 
-	BroadcastMessage(deletedPost, clients)
-
-	return ctx.Status(fiber.StatusOK).JSON("message", "Post deleted")
+	s.events.Broadcast(deletedPost)
+	return nil
 }
 
-func HandleToggleLikePost(ctx *fiber.Ctx, db *gorm.DB, clients map[*websocket.Conn]bool) error {
+func (s *Server) HandleToggleLikePost(ctx *fiber.Ctx) error {
 	postID := ctx.Params("postId")
-	userID := ctx.Cookies("userId")
+	userID := currentUserID(ctx)
 	if userID == "" {
-		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "User not authenticated"})
+		return apperror.Unauthorized("User not authenticated")
 	}
 
-	like := models.PostLike{}
-	if err := db.Where("user_id = ? AND post_id = ?", userID, postID).First(&like).Error; err == nil {
-		if err := db.Delete(&like).Error; err != nil {
-			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to remove like"})
-		}
+	postOwnerID, err := s.repos.Posts.OwnerID(postID)
+	if err == repo.ErrNotFound {
+		return apperror.NotFound("Post not found")
+	}
+	if err != nil {
+		return apperror.Internal("Failed to retrieve post", err)
+	}
+
+	liked, err := s.repos.Likes.TogglePostLike(userID, postID)
+	if err != nil {
+		return apperror.Internal("Failed to toggle like", err)
+	}
 
+	if !liked {
 		postUnliked := (fiber.Map{
 			"type": "POST_LIKED",
 			"data": fiber.Map{
@@ -607,14 +753,11 @@ func HandleToggleLikePost(ctx *fiber.Ctx, db *gorm.DB, clients map[*websocket.Co
 				"userId":  userID,
 			}})
 
-		BroadcastMessage(postUnliked, clients)
+		s.events.Broadcast(postUnliked)
+		RetractNotification(s.db, s.events, postOwnerID, userID, models.NotificationPostLike, postID, nil)
 
-		return ctx.Status(fiber.StatusOK).JSON("message", "Post Unliked")
+		return ctx.JSON(fiber.Map{"message": "Post Unliked"})
 	} else {
-		newLike := models.PostLike{UserID: userID, PostID: postID}
-		if err := db.Create(&newLike).Error; err != nil {
-			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to add like"})
-		}
 		postLiked := (fiber.Map{
 			"type": "POST_LIKED",
 			"data": fiber.Map{
@@ -624,27 +767,52 @@ func HandleToggleLikePost(ctx *fiber.Ctx, db *gorm.DB, clients map[*websocket.Co
 				"userId":  userID,
 			}})
 
-		BroadcastMessage(postLiked, clients)
+		s.events.Broadcast(postLiked)
+		Notify(s.db, s.events, postOwnerID, userID, models.NotificationPostLike, postID, nil)
 
-		return ctx.Status(fiber.StatusOK).JSON("message", "Post Liked")
+		return ctx.JSON(fiber.Map{"message": "Post Liked"})
 	}
 }
 
-func HandleAddComment(ctx *fiber.Ctx, db *gorm.DB, clients map[*websocket.Conn]bool) error {
+func (s *Server) HandleAddComment(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
 	var body struct {
-		Message  string  `json:"message"`
-		ParentID *string `json:"parentId"`
+		Message  string  `json:"message" validate:"trim,required,max=5000"`
+		ParentID *string `json:"parentId" validate:"uuid"`
 	}
-	if err := ctx.BodyParser(&body); err != nil || body.Message == "" {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Message is required"})
+	if err := parseBody(ctx, &body); err != nil {
+		return err
 	}
 
-	userID := ctx.Cookies("userId")
-	if userID == "" {
-		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "User not authenticated"})
+	if _, err := s.requireVerifiedUser(userID); err != nil {
+		return apperror.Forbidden("Verify your email address before commenting").WithCode(apperror.CodeEmailNotVerified)
 	}
 
 	postID := ctx.Params("id")
+	postOwnerID, err := s.repos.Posts.OwnerID(postID)
+	if err == repo.ErrNotFound {
+		return apperror.NotFound("Post not found")
+	}
+	if err != nil {
+		return apperror.Internal("Failed to retrieve post", err)
+	}
+
+	var parentOwnerID string
+	if body.ParentID != nil {
+		parent, err := s.repos.Comments.Get(*body.ParentID)
+		if err == repo.ErrNotFound || (err == nil && parent.PostID != postID) {
+			return apperror.NotFound("Parent comment not found")
+		}
+		if err != nil {
+			return apperror.Internal("Failed to retrieve parent comment", err)
+		}
+		parentOwnerID = parent.UserID
+	}
+
 	comment := models.Comment{
 		Message:   body.Message,
 		UserID:    userID,
@@ -654,12 +822,13 @@ func HandleAddComment(ctx *fiber.Ctx, db *gorm.DB, clients map[*websocket.Conn]b
 		UpdatedAt: time.Now(),
 	}
 
-	if err := db.Create(&comment).Error; err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to add comment"})
+	if err := s.repos.Comments.Create(&comment); err != nil {
+		return apperror.Internal("Failed to add comment", err)
 	}
 
-	if err := db.Preload("User").First(&comment, "id = ?", comment.ID).Error; err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to retrieve comment details"})
+	comment, err = s.repos.Comments.Get(comment.ID)
+	if err != nil {
+		return apperror.Internal("Failed to retrieve comment details", err)
 	}
 
 	newComment := fiber.Map(fiber.Map{
@@ -682,34 +851,49 @@ func HandleAddComment(ctx *fiber.Ctx, db *gorm.DB, clients map[*websocket.Conn]b
 		},
 	})
 
-	BroadcastMessage(newComment, clients)
+	s.events.Broadcast(newComment)
+
+	if comment.ParentID != nil {
+		Notify(s.db, s.events, parentOwnerID, userID, models.NotificationCommentReply, postID, &comment.ID)
+	}
+	if postOwnerID != parentOwnerID {
+		Notify(s.db, s.events, postOwnerID, userID, models.NotificationPostComment, postID, &comment.ID)
+	}
 
 	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Comment added successfully"})
 }
 
-func HandleUpdateComment(ctx *fiber.Ctx, db *gorm.DB, clients map[*websocket.Conn]bool) error {
+func (s *Server) HandleUpdateComment(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
 	commentID := ctx.Params("commentId")
 	var body struct {
-		Message string `json:"message"`
+		Message string `json:"message" validate:"trim,required,max=5000"`
 	}
-	if err := ctx.BodyParser(&body); err != nil || body.Message == "" {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Message is required"})
+	if err := parseBody(ctx, &body); err != nil {
+		return err
 	}
 
-	comment := models.Comment{}
-	if err := db.First(&comment, "id = ?", commentID).Error; err != nil {
-		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Comment not found"})
+	comment, err := s.repos.Comments.Get(commentID)
+	if err == repo.ErrNotFound {
+		return apperror.NotFound("Comment not found")
+	}
+	if err != nil {
+		return apperror.Internal("Failed to retrieve comment", err)
 	}
 
-	userID := ctx.Cookies("userId")
-	if comment.UserID != userID {
-		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "You do not have permission to edit this comment"})
+	allowed, privileged := s.authorizeOwnerOr(userID, comment.UserID, PermissionEditAnyComment)
+	if !allowed {
+		return apperror.Forbidden("You do not have permission to edit this comment")
 	}
 
 	comment.Message = body.Message
 	comment.UpdatedAt = time.Now()
-	if err := db.Save(&comment).Error; err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to update comment"})
+	if err := s.repos.Comments.Update(&comment); err != nil {
+		return apperror.Internal("Failed to update comment", err)
 	}
 
 	updatedComment := fiber.Map(fiber.Map{
@@ -722,56 +906,90 @@ func HandleUpdateComment(ctx *fiber.Ctx, db *gorm.DB, clients map[*websocket.Con
 		},
 	})
 
-	BroadcastMessage(updatedComment, clients)
+	s.events.Broadcast(updatedComment)
+
+	if privileged {
+		RecordModerationAction(ctx, s.db, userID, "comment.edited", "comment", comment.ID, fiber.Map{"ownerId": comment.UserID, "postId": comment.PostID, "reason": ctx.Query("reason")})
+	}
 
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Comment updated successfully"})
 }
 
-func HandleDeleteComment(ctx *fiber.Ctx, db *gorm.DB, clients map[*websocket.Conn]bool) error {
+func (s *Server) HandleDeleteComment(ctx *fiber.Ctx) error {
 	commentID := ctx.Params("commentId")
-	comment := models.Comment{}
-	if err := db.First(&comment, "id = ?", commentID).Error; err != nil {
-		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Comment not found"})
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	comment, err := s.repos.Comments.Get(commentID)
+	if err == repo.ErrNotFound {
+		return apperror.NotFound("Comment not found")
+	}
+	if err != nil {
+		return apperror.Internal("Failed to retrieve comment", err)
+	}
+
+	allowed, privileged := s.authorizeOwnerOr(userID, comment.UserID, PermissionDeleteAnyComment)
+	if !allowed {
+		return apperror.Forbidden("You do not have permission to delete this comment")
 	}
 
-	userID := ctx.Cookies("userId")
-	if comment.UserID != userID {
-		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "You do not have permission to delete this comment"})
+	if err := s.removeComment(comment, userID); err != nil {
+		return apperror.Internal("Failed to delete comment", err)
 	}
 
-	if err := db.Delete(&comment).Error; err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to delete comment"})
+	if privileged {
+		RecordModerationAction(ctx, s.db, userID, "comment.deleted", "comment", comment.ID, fiber.Map{"ownerId": comment.UserID, "postId": comment.PostID, "message": comment.Message, "reason": ctx.Query("reason")})
 	}
 
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Comment deleted successfully"})
+}
+
+// removeComment soft-deletes the comment. Replies are left untouched and the
+// comment is shown as a "[deleted]" placeholder while any of them remain.
+func (s *Server) removeComment(comment models.Comment, deletedBy string) error {
+	if err := s.repos.Comments.Delete(comment.ID, deletedBy); err != nil {
+		return err
+	}
+
+	replies, _ := s.repos.Comments.CountReplies(comment.ID)
+
 	deletedComment := fiber.Map(fiber.Map{
 		"type": "COMMENT_DELETED",
 		"data": fiber.Map{
-			"postId":    comment.PostID,
-			"commentId": commentID,
+			"postId":     comment.PostID,
+			"commentId":  comment.ID,
+			"hasReplies": replies > 0,
 		},
 	})
 
-	BroadcastMessage(deletedComment, clients)
-
-	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Comment deleted successfully"})
+	s.events.Broadcast(deletedComment)
+	return nil
 }
 
-func HandleToggleCommentLike(ctx *fiber.Ctx, db *gorm.DB, clients map[*websocket.Conn]bool) error {
+func (s *Server) HandleToggleCommentLike(ctx *fiber.Ctx) error {
 	commentID := ctx.Params("commentId")
-	userID := ctx.Cookies("userId")
+	userID := currentUserID(ctx)
 	if userID == "" {
-		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "User not authenticated"})
+		return apperror.Unauthorized("User not authenticated")
 	}
 
-	var postID string
-	db.Model(&models.Comment{}).Where("id = ?", commentID).Pluck("post_id", &postID)
+	likedComment, err := s.repos.Comments.Get(commentID)
+	if err == repo.ErrNotFound {
+		return apperror.NotFound("Comment not found")
+	}
+	if err != nil {
+		return apperror.Internal("Failed to retrieve comment", err)
+	}
+	postID := likedComment.PostID
 
-	like := models.CommentLike{}
-	if err := db.Where("user_id = ? AND comment_id = ?", userID, commentID).First(&like).Error; err == nil {
-		if err := db.Delete(&like).Error; err != nil {
-			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to remove like"})
-		}
+	liked, err := s.repos.Likes.ToggleCommentLike(userID, commentID)
+	if err != nil {
+		return apperror.Internal("Failed to toggle like", err)
+	}
 
+	if !liked {
 		commentUnliked := fiber.Map{
 			"type": "COMMENT_LIKED",
 			"data": fiber.Map{
@@ -782,14 +1000,10 @@ func HandleToggleCommentLike(ctx *fiber.Ctx, db *gorm.DB, clients map[*websocket
 			},
 		}
 
-		BroadcastMessage(commentUnliked, clients)
+		s.events.Broadcast(commentUnliked)
+		RetractNotification(s.db, s.events, likedComment.UserID, userID, models.NotificationCommentLike, postID, &commentID)
 		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Comment Unliked"})
 	} else {
-		newLike := models.CommentLike{UserID: userID, CommentID: commentID}
-		if err := db.Create(&newLike).Error; err != nil {
-			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Failed to add like"})
-		}
-
 		commentLiked := fiber.Map{
 			"type": "COMMENT_LIKED",
 			"data": fiber.Map{
@@ -800,61 +1014,22 @@ func HandleToggleCommentLike(ctx *fiber.Ctx, db *gorm.DB, clients map[*websocket
 			},
 		}
 
-		BroadcastMessage(commentLiked, clients)
+		s.events.Broadcast(commentLiked)
+		Notify(s.db, s.events, likedComment.UserID, userID, models.NotificationCommentLike, postID, &commentID)
 		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Comment Liked"})
 	}
 }
 
-func HandleWebSocket(c *fiber.Ctx) error {
-	if websocket.IsWebSocketUpgrade(c) {
-		c.Locals("allowed", true)
-		return c.Next()
-	}
-	return fiber.ErrUpgradeRequired
-}
-
-func WebSocketHandler(c *websocket.Conn, clients map[*websocket.Conn]bool) {
-	log.Println("WebSocket client connected")
-	clients[c] = true
-	defer func() {
-		delete(clients, c)
-		log.Println("WebSocket client disconnected")
-		c.Close()
-	}()
-
-	for {
-		var message interface{}
-		err := c.ReadJSON(&message)
-		if err != nil {
-			log.Println("WebSocket read error:", err)
-			break
-		}
-	}
-}
-
-func BroadcastMessage(message interface{}, clients map[*websocket.Conn]bool) {
-	for client := range clients {
-		err := client.WriteJSON(message)
-		if err != nil {
-			log.Println("WebSocket write error:", err)
-
-			delete(clients, client)
-		}
+func SendEmail(mail mailer.Mailer, recipientEmail string, code string) error {
+	msg, err := mailer.NewMessage(recipientEmail, "Password Reset Code", "password_reset", fiber.Map{
+		"Code":      code,
+		"ExpiresIn": "1 minute and 45 seconds",
+	})
+	if err != nil {
+		return err
 	}
-}
-
-func SendEmail(recipientEmail string, code string) error {
-	emailBody := fmt.Sprintf("Your password reset code is: %s. It will expire in 1 minute and 45 seconds.", code)
-
-	msg := gomail.NewMessage()
-	msg.SetHeader("From", os.Getenv("EMAIL"))
-	msg.SetHeader("To", recipientEmail)
-	msg.SetHeader("Subject", "Password Reset Code")
-	msg.SetBody("text/plain", emailBody)
-
-	dialer := gomail.NewDialer("smtp.gmail.com", 587, os.Getenv("EMAIL"), os.Getenv("EMAIL_PASSWORD"))
 
-	if err := dialer.DialAndSend(msg); err != nil {
+	if err := mail.Send(msg); err != nil {
 		log.Println("Failed to send email:", err)
 		return err
 	}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"blog_post/apperror"
+	"blog_post/db_aws"
+	"blog_post/models"
+
+	"crypto/rand"
+	"crypto/subtle"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	lockoutThreshold     = 5
+	baseLockout          = time.Minute
+	maxLockout           = time.Hour
+	maxResetCodeAttempts = 5
+	resetCodeLength      = 8
+	resetCodeAlphabet    = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// verifyDummyPassword burns the same Argon2 work as a real check so that
+// unknown or locked accounts cannot be told apart by response time.
+func (s *Server) verifyDummyPassword(password string) {
+	s.dummyHashOnce.Do(func() {
+		hash, err := db_aws.HashPassword("dummy-password-for-timing", s.passwordParams)
+		if err != nil {
+			log.Println("Failed to create dummy password hash:", err)
+		}
+		s.dummyHash = hash
+	})
+
+	_ = db_aws.VerifyPassword(password, s.dummyHash)
+}
+
+func invalidCredentials(ctx *fiber.Ctx) error {
+	return apperror.Unauthorized("Invalid email or password").WithCode(apperror.CodeInvalidCredentials)
+}
+
+// Every failure past the threshold doubles the lockout, capped at maxLockout.
+func lockoutDuration(failedLogins int) time.Duration {
+	if failedLogins < lockoutThreshold {
+		return 0
+	}
+
+	exponent := failedLogins - lockoutThreshold
+	if exponent > 10 {
+		return maxLockout
+	}
+
+	duration := baseLockout * time.Duration(math.Pow(2, float64(exponent)))
+	if duration > maxLockout {
+		return maxLockout
+	}
+	return duration
+}
+
+func lockedFor(user models.User) time.Duration {
+	if user.LockedUntil == nil {
+		return 0
+	}
+	return time.Until(*user.LockedUntil)
+}
+
+// registerFailedLogin counts the failure in the database, so failures made at
+// the same time are all counted, and locks the account past the threshold.
+func registerFailedLogin(db *gorm.DB, user *models.User) error {
+	if err := db.Raw("UPDATE users SET failed_logins = failed_logins + 1 WHERE id = ? RETURNING failed_logins", user.ID).
+		Scan(&user.FailedLogins).Error; err != nil {
+		return err
+	}
+
+	duration := lockoutDuration(user.FailedLogins)
+	if duration == 0 {
+		return nil
+	}
+
+	lockedUntil := time.Now().Add(duration)
+	user.LockedUntil = &lockedUntil
+	return db.Model(&models.User{}).Where("id = ?", user.ID).Update("locked_until", lockedUntil).Error
+}
+
+func resetFailedLogins(db *gorm.DB, user *models.User) error {
+	if user.FailedLogins == 0 && user.LockedUntil == nil {
+		return nil
+	}
+
+	user.FailedLogins = 0
+	user.LockedUntil = nil
+	return db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"failed_logins": 0,
+		"locked_until":  nil,
+	}).Error
+}
+
+func generateResetCode() (string, error) {
+	code := make([]byte, resetCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(resetCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = resetCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+func (s *Server) HandleResetPassword(ctx *fiber.Ctx) error {
+	var body struct {
+		Email       string `json:"email" validate:"trim,lower,required"`
+		Code        string `json:"code" validate:"trim,required"`
+		NewPassword string `json:"newPassword" validate:"required,min=8,max=128"`
+	}
+
+	if err := parseBody(ctx, &body); err != nil {
+		return err
+	}
+
+	user := models.User{}
+	if err := s.db.Where("email = ?", body.Email).Find(&user).Error; err != nil {
+		return apperror.Internal("Failed to retrieve user", err)
+	}
+
+	code := models.Code{}
+	if user.ID != "" {
+		if err := s.db.Where("user_id = ? AND expire_at > ?", user.ID, time.Now()).Order("expire_at DESC").Limit(1).Find(&code).Error; err != nil {
+			return apperror.Internal("Failed to retrieve code", err)
+		}
+	}
+
+	if code.ID == "" {
+		return apperror.BadRequest("Invalid or expired code")
+	}
+
+	// The attempt is taken before the code is compared, in one statement, so
+	// guesses sent in parallel cannot all pass the limit.
+	result := s.db.Model(&models.Code{}).
+		Where("id = ? AND attempts < ?", code.ID, maxResetCodeAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return apperror.Internal("Failed to record attempt", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		if err := s.db.Where("user_id = ?", user.ID).Delete(&models.Code{}).Error; err != nil {
+			return apperror.Internal("Failed to delete code", err)
+		}
+		log.Printf("Password reset for user %s rejected: too many attempts", user.ID)
+		return apperror.BadRequest("Invalid or expired code")
+	}
+
+	submitted := strings.ToUpper(body.Code)
+	if subtle.ConstantTimeCompare([]byte(submitted), []byte(code.Code)) != 1 {
+		if code.Attempts+1 >= maxResetCodeAttempts {
+			if err := s.db.Where("user_id = ?", user.ID).Delete(&models.Code{}).Error; err != nil {
+				return apperror.Internal("Failed to delete code", err)
+			}
+		}
+		return apperror.BadRequest("Invalid or expired code")
+	}
+
+	hashedPassword, err := db_aws.HashPassword(body.NewPassword, s.passwordParams)
+	if err != nil {
+		return apperror.Internal("Failed to hash password", err)
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"hash_password": hashedPassword,
+			"failed_logins": 0,
+			"locked_until":  nil,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.Code{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", user.ID).Delete(&models.Session{}).Error
+	})
+	if err != nil {
+		return apperror.Internal("Failed to reset password", err)
+	}
+
+	RecordAudit(ctx, s.db, user.ID, AuditPasswordReset, "user", user.ID, nil)
+
+	return ctx.JSON(fiber.Map{"message": "Password reset successfully"})
+}
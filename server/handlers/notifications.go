@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"blog_post/apperror"
+	"blog_post/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"time"
+)
+
+// Likes on the same target collapse into a single unread notification with
+// several actors instead of one entry per like.
+func isCoalescedNotification(notificationType string) bool {
+	return notificationType == models.NotificationPostLike || notificationType == models.NotificationCommentLike
+}
+
+func Notify(db *gorm.DB, events EventHub, recipientID string, actorID string, notificationType string, postID string, commentID *string) {
+	if recipientID == "" || recipientID == actorID {
+		return
+	}
+
+	notification := models.Notification{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if isCoalescedNotification(notificationType) {
+			// idx_notifications_unread_likes allows one unread notification per
+			// target, so concurrent likes all end up on the same row.
+			if err := tx.Raw(`INSERT INTO notifications (user_id, type, post_id, comment_id) VALUES (?, ?, ?, ?)
+				ON CONFLICT (user_id, type, post_id, (coalesce(comment_id, '00000000-0000-0000-0000-000000000000')))
+				WHERE NOT read AND type IN ('POST_LIKE', 'COMMENT_LIKE')
+				DO UPDATE SET updated_at = now()
+				RETURNING id`, recipientID, notificationType, postID, commentID).Scan(&notification).Error; err != nil {
+				return err
+			}
+		} else {
+			notification = models.Notification{
+				UserID:    recipientID,
+				Type:      notificationType,
+				PostID:    postID,
+				CommentID: commentID,
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+			}
+			if err := tx.Omit("Actors").Create(&notification).Error; err != nil {
+				return err
+			}
+		}
+
+		actor := models.NotificationActor{NotificationID: notification.ID, UserID: actorID, CreatedAt: time.Now()}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("Notification", "User").Create(&actor).Error
+	})
+	if err != nil {
+		log.Println("Failed to create notification:", err)
+		return
+	}
+
+	pushNotification(db, events, notification.ID)
+}
+
+func RetractNotification(db *gorm.DB, events EventHub, recipientID string, actorID string, notificationType string, postID string, commentID *string) {
+	if recipientID == "" || recipientID == actorID {
+		return
+	}
+
+	notification := models.Notification{}
+	query := db.Where("user_id = ? AND type = ? AND post_id = ? AND read = ?", recipientID, notificationType, postID, false)
+	if commentID != nil {
+		query = query.Where("comment_id = ?", *commentID)
+	} else {
+		query = query.Where("comment_id IS NULL")
+	}
+	if query.Limit(1).Find(&notification).RowsAffected == 0 {
+		return
+	}
+
+	if err := db.Where("notification_id = ? AND user_id = ?", notification.ID, actorID).Delete(&models.NotificationActor{}).Error; err != nil {
+		log.Println("Failed to retract notification:", err)
+		return
+	}
+
+	var remaining int64
+	db.Model(&models.NotificationActor{}).Where("notification_id = ?", notification.ID).Count(&remaining)
+	if remaining > 0 {
+		pushNotification(db, events, notification.ID)
+		return
+	}
+
+	if err := db.Delete(&notification).Error; err != nil {
+		log.Println("Failed to delete notification:", err)
+		return
+	}
+
+	events.SendToUser(fiber.Map{
+		"type": "NOTIFICATION_REMOVED",
+		"data": fiber.Map{
+			"id":          notification.ID,
+			"unreadCount": unreadNotificationCount(db, recipientID),
+		},
+	}, recipientID)
+}
+
+func pushNotification(db *gorm.DB, events EventHub, notificationID string) {
+	notification := models.Notification{}
+	if err := preloadNotificationActors(db).First(&notification, "id = ?", notificationID).Error; err != nil {
+		log.Println("Failed to load notification:", err)
+		return
+	}
+
+	events.SendToUser(fiber.Map{
+		"type": "NOTIFICATION",
+		"data": fiber.Map{
+			"notification": notificationToMap(notification),
+			"unreadCount":  unreadNotificationCount(db, notification.UserID),
+		},
+	}, notification.UserID)
+}
+
+func preloadNotificationActors(db *gorm.DB) *gorm.DB {
+	return db.Preload("Actors", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at DESC").Preload("User")
+	})
+}
+
+func unreadNotificationCount(db *gorm.DB, userID string) int64 {
+	var count int64
+	db.Model(&models.Notification{}).Where("user_id = ? AND read = ?", userID, false).Count(&count)
+	return count
+}
+
+func notificationToMap(notification models.Notification) fiber.Map {
+	actors := []fiber.Map{}
+	for _, actor := range notification.Actors {
+		actors = append(actors, fiber.Map{
+			"id":   actor.User.ID,
+			"name": actor.User.FirstName,
+		})
+	}
+
+	return fiber.Map{
+		"id":         notification.ID,
+		"type":       notification.Type,
+		"postId":     notification.PostID,
+		"commentId":  notification.CommentID,
+		"read":       notification.Read,
+		"message":    notification.Summary(),
+		"actors":     actors,
+		"actorCount": len(notification.Actors),
+		"createdAt":  notification.CreatedAt,
+		"updatedAt":  notification.UpdatedAt,
+	}
+}
+
+func (s *Server) HandleGetNotifications(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	limit := ctx.QueryInt("limit", 20)
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	offset := ctx.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := s.db.Where("user_id = ?", userID)
+	if ctx.QueryBool("unread", false) {
+		query = query.Where("read = ?", false)
+	}
+
+	notifications := []models.Notification{}
+	if err := preloadNotificationActors(query).Order("updated_at DESC").Limit(limit).Offset(offset).Find(&notifications).Error; err != nil {
+		return apperror.Internal("Failed to retrieve notifications", err)
+	}
+
+	result := []fiber.Map{}
+	for _, notification := range notifications {
+		result = append(result, notificationToMap(notification))
+	}
+
+	return ctx.JSON(fiber.Map{
+		"notifications": result,
+		"unreadCount":   unreadNotificationCount(s.db, userID),
+	})
+}
+
+func (s *Server) HandleGetUnreadNotificationCount(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	return ctx.JSON(fiber.Map{"unreadCount": unreadNotificationCount(s.db, userID)})
+}
+
+func (s *Server) HandleMarkNotificationRead(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	result := s.db.Model(&models.Notification{}).Where("id = ? AND user_id = ?", ctx.Params("id"), userID).Update("read", true)
+	if result.Error != nil {
+		return apperror.Internal("Failed to update notification", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return apperror.NotFound("Notification not found")
+	}
+
+	unreadCount := unreadNotificationCount(s.db, userID)
+	s.events.SendToUser(fiber.Map{
+		"type": "NOTIFICATIONS_READ",
+		"data": fiber.Map{
+			"ids":         []string{ctx.Params("id")},
+			"unreadCount": unreadCount,
+		},
+	}, userID)
+
+	return ctx.JSON(fiber.Map{"message": "Notification marked as read", "unreadCount": unreadCount})
+}
+
+func (s *Server) HandleMarkAllNotificationsRead(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	if err := s.db.Model(&models.Notification{}).Where("user_id = ? AND read = ?", userID, false).Update("read", true).Error; err != nil {
+		return apperror.Internal("Failed to update notifications", err)
+	}
+
+	s.events.SendToUser(fiber.Map{
+		"type": "NOTIFICATIONS_READ",
+		"data": fiber.Map{
+			"all":         true,
+			"unreadCount": 0,
+		},
+	}, userID)
+
+	return ctx.JSON(fiber.Map{"message": "All notifications marked as read", "unreadCount": 0})
+}
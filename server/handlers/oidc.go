@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"blog_post/apperror"
+	"blog_post/models"
+	"blog_post/oidc"
+
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	oidcStateTTL    = 10 * time.Minute
+	oidcStateCookie = "oidc_state"
+)
+
+var errIdentityLinkedElsewhere = errors.New("identity is linked to another account")
+
+// errLinkRequired means an account with the provider's email exists but has
+// never proven it owns that address, so it is not linked automatically:
+// whoever signed up with it could be someone else.
+var errLinkRequired = errors.New("account with this email is not verified")
+
+func (s *Server) oidcRedirect(ctx *fiber.Ctx, path string, query url.Values) error {
+	target := s.config.AppURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	return ctx.Redirect(target, fiber.StatusFound)
+}
+
+func (s *Server) oidcFailure(ctx *fiber.Ctx, reason string) error {
+	return s.oidcRedirect(ctx, "/signIn", url.Values{"error": {reason}})
+}
+
+func (s *Server) HandleOIDCLogin(ctx *fiber.Ctx) error {
+	providerName := ctx.Params("provider")
+	client, ok := s.oidc[providerName]
+	if !ok {
+		return apperror.NotFound("Unknown identity provider")
+	}
+
+	state, err := oidc.RandomString(32)
+	if err != nil {
+		return apperror.Internal("Failed to start sign-in", err)
+	}
+	nonce, err := oidc.RandomString(32)
+	if err != nil {
+		return apperror.Internal("Failed to start sign-in", err)
+	}
+	codeVerifier, err := oidc.RandomString(48)
+	if err != nil {
+		return apperror.Internal("Failed to start sign-in", err)
+	}
+
+	loginState := models.OIDCState{
+		StateHash:    hashToken(state),
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpireAt:     time.Now().Add(oidcStateTTL),
+	}
+	if userID := currentUserID(ctx); userID != "" && ctx.QueryBool("link", false) {
+		loginState.LinkUserID = &userID
+	}
+
+	if err := s.db.Where("expire_at < ?", time.Now()).Delete(&models.OIDCState{}).Error; err != nil {
+		log.Println("Failed to delete expired OIDC states:", err)
+	}
+	if err := s.db.Create(&loginState).Error; err != nil {
+		return apperror.Internal("Failed to start sign-in", err)
+	}
+
+	authURL, err := client.AuthCodeURL(ctx.Context(), state, nonce, codeVerifier)
+	if err != nil {
+		log.Printf("OIDC provider %s unavailable: %v", providerName, err)
+		return apperror.New(fiber.StatusBadGateway, "bad_gateway", "Identity provider is unavailable")
+	}
+
+	// The callback only accepts the state from the browser that started the
+	// login, so nobody can finish their own login in someone else's browser.
+	ctx.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Expires:  loginState.ExpireAt,
+		HTTPOnly: true,
+		Secure:   s.config.CookieSecure,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	return ctx.Redirect(authURL, fiber.StatusFound)
+}
+
+func (s *Server) HandleOIDCCallback(ctx *fiber.Ctx) error {
+	providerName := ctx.Params("provider")
+	client, ok := s.oidc[providerName]
+	if !ok {
+		return apperror.NotFound("Unknown identity provider")
+	}
+
+	if providerError := ctx.Query("error"); providerError != "" {
+		log.Printf("OIDC provider %s returned error %q", providerName, providerError)
+		return s.oidcFailure(ctx, "provider_error")
+	}
+
+	state := ctx.Query("state")
+	code := ctx.Query("code")
+	if state == "" || code == "" {
+		return s.oidcFailure(ctx, "invalid_request")
+	}
+	if subtle.ConstantTimeCompare([]byte(state), []byte(ctx.Cookies(oidcStateCookie))) != 1 {
+		return s.oidcFailure(ctx, "invalid_state")
+	}
+	ctx.ClearCookie(oidcStateCookie)
+
+	loginState := models.OIDCState{}
+	if err := s.db.Where("state_hash = ?", hashToken(state)).Limit(1).Find(&loginState).Error; err != nil {
+		return s.oidcFailure(ctx, "server_error")
+	}
+	if loginState.ID == "" || loginState.Provider != providerName || time.Now().After(loginState.ExpireAt) {
+		return s.oidcFailure(ctx, "invalid_state")
+	}
+	if err := s.db.Delete(&loginState).Error; err != nil {
+		return s.oidcFailure(ctx, "server_error")
+	}
+
+	claims, err := client.Exchange(ctx.Context(), code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("OIDC code exchange with %s failed: %v", providerName, err)
+		return s.oidcFailure(ctx, "invalid_token")
+	}
+
+	user, err := resolveOIDCUser(s.db, providerName, claims, loginState.LinkUserID)
+	if err != nil {
+		log.Printf("OIDC sign-in with %s for subject %s failed: %v", providerName, claims.Subject, err)
+		if errors.Is(err, errIdentityLinkedElsewhere) {
+			return s.oidcFailure(ctx, "already_linked")
+		}
+		if errors.Is(err, errLinkRequired) {
+			return s.oidcFailure(ctx, "link_required")
+		}
+		return s.oidcFailure(ctx, "account_unavailable")
+	}
+
+	if loginState.LinkUserID != nil {
+		RecordAudit(ctx, s.db, user.ID, AuditIdentityLinked, "user", user.ID, fiber.Map{"provider": providerName})
+		return s.oidcRedirect(ctx, "/profile", url.Values{"linked": {providerName}})
+	}
+
+	if user.TOTPEnabled {
+		challengeToken, err := createTwoFactorChallenge(s.db, user.ID)
+		if err != nil {
+			return s.oidcFailure(ctx, "server_error")
+		}
+		return s.oidcRedirect(ctx, "/signIn", url.Values{"challengeToken": {challengeToken}})
+	}
+
+	if err := s.createSession(ctx, user.ID); err != nil {
+		return s.oidcFailure(ctx, "server_error")
+	}
+
+	return s.oidcRedirect(ctx, "/", nil)
+}
+
+// resolveOIDCUser finds the account for a provider identity. Known identities
+// sign in directly; otherwise the identity is linked to the signed-in user,
+// to an existing account with the same email if both sides verified it, or
+// to a new account.
+func resolveOIDCUser(db *gorm.DB, providerName string, claims *oidc.Claims, linkUserID *string) (models.User, error) {
+	user := models.User{}
+
+	identity := models.Identity{}
+	if err := db.Where("provider = ? AND subject = ?", providerName, claims.Subject).Limit(1).Find(&identity).Error; err != nil {
+		return user, err
+	}
+
+	if identity.ID != "" {
+		if linkUserID != nil && *linkUserID != identity.UserID {
+			return user, errIdentityLinkedElsewhere
+		}
+		err := db.Where("id = ?", identity.UserID).First(&user).Error
+		return user, err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		switch {
+		case linkUserID != nil:
+			if err := tx.Where("id = ?", *linkUserID).First(&user).Error; err != nil {
+				return err
+			}
+		case claims.Email != "" && claims.EmailVerified:
+			if err := tx.Where("email = ?", strings.ToLower(claims.Email)).Limit(1).Find(&user).Error; err != nil {
+				return err
+			}
+			if user.ID != "" && !user.EmailVerified {
+				return errLinkRequired
+			}
+			if user.ID == "" {
+				user = newOIDCUser(claims)
+				if err := tx.Create(&user).Error; err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("provider did not supply a verified email")
+		}
+
+		return tx.Omit("User").Create(&models.Identity{
+			UserID:   user.ID,
+			Provider: providerName,
+			Subject:  claims.Subject,
+			Email:    claims.Email,
+		}).Error
+	})
+
+	return user, err
+}
+
+func newOIDCUser(claims *oidc.Claims) models.User {
+	firstName := claims.GivenName
+	lastName := claims.FamilyName
+	if firstName == "" && claims.Name != "" {
+		parts := strings.SplitN(claims.Name, " ", 2)
+		firstName = parts[0]
+		if len(parts) == 2 && lastName == "" {
+			lastName = parts[1]
+		}
+	}
+	if firstName == "" {
+		firstName = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+
+	return models.User{
+		ID:            uuid.New().String(),
+		FirstName:     firstName,
+		LastName:      lastName,
+		Email:         strings.ToLower(claims.Email),
+		EmailVerified: true,
+	}
+}
+
+func (s *Server) HandleGetIdentities(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	identities := []models.Identity{}
+	if err := s.db.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		return apperror.Internal("Failed to retrieve identities", err)
+	}
+
+	result := []fiber.Map{}
+	for _, identity := range identities {
+		result = append(result, fiber.Map{
+			"id":        identity.ID,
+			"provider":  identity.Provider,
+			"email":     identity.Email,
+			"createdAt": identity.CreatedAt,
+		})
+	}
+
+	return ctx.JSON(result)
+}
+
+func (s *Server) HandleUnlinkIdentity(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	user := models.User{}
+	if err := s.db.Where("id = ?", userID).Find(&user).Error; err != nil || user.ID == "" {
+		return apperror.Internal("Failed to retrieve user", err)
+	}
+
+	var identityCount int64
+	if err := s.db.Model(&models.Identity{}).Where("user_id = ?", userID).Count(&identityCount).Error; err != nil {
+		return apperror.Internal("Failed to retrieve identities", err)
+	}
+	if user.HashPassword == "" && identityCount <= 1 {
+		return apperror.Conflict("Set a password before unlinking your last sign-in method")
+	}
+
+	result := s.db.Where("id = ? AND user_id = ?", ctx.Params("id"), userID).Delete(&models.Identity{})
+	if result.Error != nil {
+		return apperror.Internal("Failed to unlink identity", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return apperror.NotFound("Identity not found")
+	}
+
+	RecordAudit(ctx, s.db, userID, AuditIdentityUnlinked, "identity", ctx.Params("id"), nil)
+
+	return ctx.JSON(fiber.Map{"message": "Identity unlinked"})
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"blog_post/apperror"
+	"blog_post/models"
+	"blog_post/repo"
+
+	"encoding/json"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"strings"
+)
+
+const (
+	PermissionEditAnyPost      = "posts:edit_any"
+	PermissionDeleteAnyPost    = "posts:delete_any"
+	PermissionEditAnyComment   = "comments:edit_any"
+	PermissionDeleteAnyComment = "comments:delete_any"
+	PermissionModerate         = "moderation:manage"
+	PermissionManageRoles      = "users:manage_roles"
+	PermissionRestoreUsers     = "users:restore"
+	PermissionViewAudit        = "audit:read"
+)
+
+var rolePermissions = map[string][]string{
+	models.RoleUser: {},
+	models.RoleModerator: {
+		PermissionDeleteAnyPost,
+		PermissionEditAnyComment,
+		PermissionDeleteAnyComment,
+		PermissionModerate,
+	},
+	models.RoleAdmin: {
+		PermissionEditAnyPost,
+		PermissionDeleteAnyPost,
+		PermissionEditAnyComment,
+		PermissionDeleteAnyComment,
+		PermissionModerate,
+		PermissionManageRoles,
+		PermissionRestoreUsers,
+		PermissionViewAudit,
+	},
+}
+
+func HasPermission(role string, permission string) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeOwnerOr allows owners to act on their own content and anyone whose
+// role grants permission to act on other people's content. The returned
+// privileged flag is set when the role was what made the action possible, so
+// the caller can record it.
+func (s *Server) authorizeOwnerOr(userID string, ownerID string, permission string) (allowed bool, privileged bool) {
+	if userID == "" {
+		return false, false
+	}
+	if userID == ownerID {
+		return true, false
+	}
+
+	if s.userHasPermission(userID, permission) {
+		return true, true
+	}
+	return false, false
+}
+
+func (s *Server) userHasPermission(userID string, permission string) bool {
+	if userID == "" {
+		return false
+	}
+
+	user, err := s.repos.Users.Get(userID)
+	if err != nil {
+		if err != repo.ErrNotFound {
+			log.Println("Failed to retrieve user role:", err)
+		}
+		return false
+	}
+
+	return HasPermission(user.Role, permission)
+}
+
+// RecordModerationAction logs the action in the moderation log and the audit
+// trail.
+func RecordModerationAction(ctx *fiber.Ctx, db *gorm.DB, actorID string, action string, targetType string, targetID string, details fiber.Map) {
+	encoded := ""
+	if len(details) > 0 {
+		if data, err := json.Marshal(details); err == nil {
+			encoded = string(data)
+		}
+	}
+
+	entry := models.ModerationAction{
+		ActorID:    &actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Details:    encoded,
+	}
+	if err := db.Omit("Actor").Create(&entry).Error; err != nil {
+		log.Printf("Failed to record moderation action %s on %s %s: %v", action, targetType, targetID, err)
+	}
+
+	RecordAudit(ctx, db, actorID, action, targetType, targetID, details)
+}
+
+func (s *Server) RequirePermission(permission string) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		userID := currentUserID(ctx)
+		if userID == "" {
+			return apperror.Unauthorized("User not authenticated")
+		}
+
+		user, err := s.repos.Users.Get(userID)
+		if err != nil && err != repo.ErrNotFound {
+			return apperror.Internal("Failed to retrieve user", err)
+		}
+
+		if !HasPermission(user.Role, permission) {
+			return apperror.Forbidden("You do not have permission to do this")
+		}
+
+		return ctx.Next()
+	}
+}
+
+func BootstrapAdmins(db *gorm.DB, emails string) {
+	for _, email := range strings.Split(emails, ",") {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email == "" {
+			continue
+		}
+
+		result := db.Model(&models.User{}).Where("email = ? AND role <> ?", email, models.RoleAdmin).Update("role", models.RoleAdmin)
+		if result.Error != nil {
+			log.Printf("Failed to promote %s to admin: %v", email, result.Error)
+		} else if result.RowsAffected > 0 {
+			log.Printf("Promoted %s to admin", email)
+		}
+	}
+}
+
+func (s *Server) HandleAdminGetUsers(ctx *fiber.Ctx) error {
+	query := s.db.Model(&models.User{})
+	if role := ctx.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	if search := ctx.Query("q"); search != "" {
+		like := "%" + search + "%"
+		query = query.Where("email ILIKE ? OR first_name ILIKE ? OR last_name ILIKE ?", like, like, like)
+	}
+
+	limit := ctx.QueryInt("limit", 50)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	users := []models.User{}
+	if err := query.Order("email").Limit(limit).Offset(ctx.QueryInt("offset", 0)).Find(&users).Error; err != nil {
+		return apperror.Internal("Failed to retrieve users", err)
+	}
+
+	result := []fiber.Map{}
+	for _, user := range users {
+		result = append(result, fiber.Map{
+			"id":        user.ID,
+			"firstName": user.FirstName,
+			"lastName":  user.LastName,
+			"email":     user.Email,
+			"role":      user.Role,
+		})
+	}
+
+	return ctx.JSON(result)
+}
+
+var (
+	errUserNotFound = errors.New("user not found")
+	errLastAdmin    = errors.New("last admin")
+)
+
+func (s *Server) HandleAdminUpdateRole(ctx *fiber.Ctx) error {
+	var body struct {
+		Role   string `json:"role" validate:"trim,lower,required,oneof=user moderator admin"`
+		Reason string `json:"reason" validate:"trim,max=1000"`
+	}
+
+	if err := parseBody(ctx, &body); err != nil {
+		return err
+	}
+
+	// The admins are locked before anything is read, so two admins demoting
+	// each other at once cannot both see the other one still in place.
+	target := models.User{}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var admins []string
+		if err := tx.Model(&models.User{}).Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("role = ?", models.RoleAdmin).Pluck("id", &admins).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("id = ?", ctx.Params("id")).Find(&target).Error; err != nil {
+			return err
+		}
+		if target.ID == "" {
+			return errUserNotFound
+		}
+		if target.Role == body.Role {
+			return nil
+		}
+		if target.Role == models.RoleAdmin && len(admins) <= 1 {
+			return errLastAdmin
+		}
+
+		return tx.Model(&models.User{}).Where("id = ?", target.ID).Update("role", body.Role).Error
+	})
+	switch {
+	case errors.Is(err, errUserNotFound):
+		return apperror.NotFound("User not found")
+	case errors.Is(err, errLastAdmin):
+		return apperror.Conflict("Cannot demote the last admin")
+	case err != nil:
+		return apperror.Internal("Failed to update role", err)
+	}
+
+	if target.Role == body.Role {
+		return ctx.JSON(fiber.Map{"message": "Role unchanged", "role": target.Role})
+	}
+
+	RecordModerationAction(ctx, s.db, currentUserID(ctx), "user.role_changed", "user", target.ID, fiber.Map{
+		"from":   target.Role,
+		"to":     body.Role,
+		"reason": body.Reason,
+	})
+
+	return ctx.JSON(fiber.Map{"message": "Role updated", "role": body.Role})
+}
+
+func (s *Server) HandleAdminGetModerationActions(ctx *fiber.Ctx) error {
+	query := s.db.Preload("Actor")
+	if action := ctx.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if actorID := ctx.Query("actorId"); actorID != "" {
+		query = query.Where("actor_id = ?", actorID)
+	}
+	if targetID := ctx.Query("targetId"); targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+
+	limit := ctx.QueryInt("limit", 50)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	actions := []models.ModerationAction{}
+	if err := query.Order("created_at DESC").Limit(limit).Offset(ctx.QueryInt("offset", 0)).Find(&actions).Error; err != nil {
+		return apperror.Internal("Failed to retrieve moderation actions", err)
+	}
+
+	result := []fiber.Map{}
+	for _, action := range actions {
+		var actor fiber.Map
+		if action.Actor != nil {
+			actor = fiber.Map{
+				"id":   action.Actor.ID,
+				"name": action.Actor.FirstName,
+			}
+		}
+		result = append(result, fiber.Map{
+			"id":         action.ID,
+			"actor":      actor,
+			"action":     action.Action,
+			"targetType": action.TargetType,
+			"targetId":   action.TargetID,
+			"details":    json.RawMessage(nullIfEmpty(action.Details)),
+			"createdAt":  action.CreatedAt,
+		})
+	}
+
+	return ctx.JSON(result)
+}
+
+func nullIfEmpty(value string) string {
+	if value == "" {
+		return "null"
+	}
+	return value
+}
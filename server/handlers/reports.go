@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"blog_post/apperror"
+	"blog_post/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+var reportActions = map[string]string{
+	"hide":    models.ReportStatusActioned,
+	"delete":  models.ReportStatusActioned,
+	"warn":    models.ReportStatusActioned,
+	"restore": models.ReportStatusDismissed,
+	"dismiss": models.ReportStatusDismissed,
+}
+
+func createReport(ctx *fiber.Ctx, db *gorm.DB, reporterID string, targetType string, targetID string, postID string, ownerID string) error {
+	var body struct {
+		Reason  string `json:"reason" validate:"trim,lower,required,oneof=spam harassment hate violence misinformation other"`
+		Details string `json:"details" validate:"trim,max=2000"`
+	}
+
+	if err := parseBody(ctx, &body); err != nil {
+		return err
+	}
+	if body.Reason == "other" && body.Details == "" {
+		return apperror.InvalidField("details", "details is required when reason is other")
+	}
+
+	if reporterID == ownerID {
+		return apperror.Forbidden("You cannot report your own content")
+	}
+
+	var existing int64
+	if err := db.Model(&models.Report{}).Where("reporter_id = ? AND target_type = ? AND target_id = ? AND status = ?", reporterID, targetType, targetID, models.ReportStatusOpen).Count(&existing).Error; err != nil {
+		return apperror.Internal("Failed to submit report", err)
+	}
+	if existing > 0 {
+		return apperror.Conflict("You have already reported this")
+	}
+
+	report := models.Report{
+		ReporterID: reporterID,
+		TargetType: targetType,
+		TargetID:   targetID,
+		PostID:     postID,
+		Reason:     body.Reason,
+		Details:    body.Details,
+		CreatedAt:  time.Now(),
+	}
+	if err := db.Omit("Reporter").Create(&report).Error; err != nil {
+		return apperror.Internal("Failed to submit report", err)
+	}
+
+	return nil
+}
+
+func (s *Server) HandleReportPost(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	post := models.Post{}
+	if err := s.db.Where("id = ?", ctx.Params("id")).Limit(1).Find(&post).Error; err != nil {
+		return apperror.Internal("Failed to retrieve post", err)
+	}
+	if post.ID == "" {
+		return apperror.NotFound("Post not found")
+	}
+
+	if err := createReport(ctx, s.db, userID, models.ReportTargetPost, post.ID, post.ID, post.UserID); err != nil {
+		return err
+	}
+
+	threshold := s.config.ReportHideThreshold
+	if threshold > 0 && !post.Hidden {
+		var reporters int64
+		if err := s.db.Model(&models.Report{}).Where("target_type = ? AND target_id = ? AND status = ?", models.ReportTargetPost, post.ID, models.ReportStatusOpen).Distinct("reporter_id").Count(&reporters).Error; err != nil {
+			log.Println("Failed to count reports:", err)
+		} else if reporters >= int64(threshold) {
+			if err := setHidden(s.db, s.events, models.ReportTargetPost, post.ID, post.ID, true); err != nil {
+				log.Println("Failed to hide reported post:", err)
+			} else {
+				log.Printf("Post %s hidden after %d reports", post.ID, reporters)
+			}
+		}
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Report submitted"})
+}
+
+func (s *Server) HandleReportComment(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	comment := models.Comment{}
+	if err := s.db.Where("id = ? AND post_id = ?", ctx.Params("commentId"), ctx.Params("postId")).Limit(1).Find(&comment).Error; err != nil {
+		return apperror.Internal("Failed to retrieve comment", err)
+	}
+	if comment.ID == "" {
+		return apperror.NotFound("Comment not found")
+	}
+
+	if err := createReport(ctx, s.db, userID, models.ReportTargetComment, comment.ID, comment.PostID, comment.UserID); err != nil {
+		return err
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Report submitted"})
+}
+
+func setHidden(db *gorm.DB, events EventHub, targetType string, targetID string, postID string, hidden bool) error {
+	messageType := "HIDDEN"
+	if !hidden {
+		messageType = "RESTORED"
+	}
+
+	if targetType == models.ReportTargetPost {
+		if err := db.Model(&models.Post{}).Where("id = ?", targetID).Update("hidden", hidden).Error; err != nil {
+			return err
+		}
+		events.Broadcast(fiber.Map{
+			"type": "POST_" + messageType,
+			"data": fiber.Map{"id": targetID},
+		})
+		return nil
+	}
+
+	if err := db.Model(&models.Comment{}).Where("id = ?", targetID).Update("hidden", hidden).Error; err != nil {
+		return err
+	}
+	events.Broadcast(fiber.Map{
+		"type": "COMMENT_" + messageType,
+		"data": fiber.Map{"postId": postID, "commentId": targetID},
+	})
+	return nil
+}
+
+func (s *Server) HandleGetReports(ctx *fiber.Ctx) error {
+	query := s.db.Preload("Reporter")
+
+	switch status := ctx.Query("status", models.ReportStatusOpen); status {
+	case "all":
+	case models.ReportStatusOpen, models.ReportStatusActioned, models.ReportStatusDismissed:
+		query = query.Where("status = ?", status)
+	default:
+		return apperror.Unprocessable("Status must be open, actioned, dismissed or all")
+	}
+	if targetType := ctx.Query("targetType"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if reason := ctx.Query("reason"); reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+	if postID := ctx.Query("postId"); postID != "" {
+		query = query.Where("post_id = ?", postID)
+	}
+
+	limit := ctx.QueryInt("limit", 50)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	reports := []models.Report{}
+	if err := query.Order("created_at").Limit(limit).Offset(ctx.QueryInt("offset", 0)).Find(&reports).Error; err != nil {
+		return apperror.Internal("Failed to retrieve reports", err)
+	}
+
+	postIDs := []string{}
+	commentIDs := []string{}
+	for _, report := range reports {
+		if report.TargetType == models.ReportTargetPost {
+			postIDs = append(postIDs, report.TargetID)
+		} else {
+			commentIDs = append(commentIDs, report.TargetID)
+		}
+	}
+
+	posts := []models.Post{}
+	if len(postIDs) > 0 {
+		if err := s.db.Preload("User").Where("id IN ?", postIDs).Find(&posts).Error; err != nil {
+			return apperror.Internal("Failed to retrieve reported posts", err)
+		}
+	}
+	comments := []models.Comment{}
+	if len(commentIDs) > 0 {
+		if err := s.db.Preload("User").Where("id IN ?", commentIDs).Find(&comments).Error; err != nil {
+			return apperror.Internal("Failed to retrieve reported comments", err)
+		}
+	}
+
+	targets := map[string]fiber.Map{}
+	for _, post := range posts {
+		targets[post.ID] = fiber.Map{
+			"title":  post.Title,
+			"body":   post.Body,
+			"hidden": post.Hidden,
+			"user":   fiber.Map{"id": post.UserID, "name": post.User.FirstName},
+		}
+	}
+	for _, comment := range comments {
+		targets[comment.ID] = fiber.Map{
+			"message": comment.Message,
+			"hidden":  comment.Hidden,
+			"user":    fiber.Map{"id": comment.UserID, "name": comment.User.FirstName},
+		}
+	}
+
+	result := []fiber.Map{}
+	for _, report := range reports {
+		var target interface{}
+		if content, ok := targets[report.TargetID]; ok {
+			target = content
+		}
+
+		result = append(result, fiber.Map{
+			"id":         report.ID,
+			"targetType": report.TargetType,
+			"targetId":   report.TargetID,
+			"postId":     report.PostID,
+			"target":     target,
+			"reason":     report.Reason,
+			"details":    report.Details,
+			"status":     report.Status,
+			"resolution": report.Resolution,
+			"resolvedAt": report.ResolvedAt,
+			"createdAt":  report.CreatedAt,
+			"reporter": fiber.Map{
+				"id":   report.Reporter.ID,
+				"name": report.Reporter.FirstName,
+			},
+		})
+	}
+
+	return ctx.JSON(result)
+}
+
+func (s *Server) HandleResolveReport(ctx *fiber.Ctx) error {
+	moderatorID := currentUserID(ctx)
+	if moderatorID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	var body struct {
+		Action string `json:"action" validate:"trim,lower,required,oneof=hide delete warn restore dismiss"`
+		Note   string `json:"note" validate:"trim,max=2000"`
+	}
+
+	if err := parseBody(ctx, &body); err != nil {
+		return err
+	}
+
+	report := models.Report{}
+	if err := s.db.Where("id = ?", ctx.Params("id")).Limit(1).Find(&report).Error; err != nil {
+		return apperror.Internal("Failed to retrieve report", err)
+	}
+	if report.ID == "" {
+		return apperror.NotFound("Report not found")
+	}
+	if report.Status != models.ReportStatusOpen {
+		return apperror.Conflict("Report has already been resolved")
+	}
+
+	var ownerID string
+	post := models.Post{}
+	comment := models.Comment{}
+	if report.TargetType == models.ReportTargetPost {
+		if err := s.db.Where("id = ?", report.TargetID).Limit(1).Find(&post).Error; err != nil {
+			return apperror.Internal("Failed to retrieve reported post", err)
+		}
+		ownerID = post.UserID
+	} else {
+		if err := s.db.Where("id = ?", report.TargetID).Limit(1).Find(&comment).Error; err != nil {
+			return apperror.Internal("Failed to retrieve reported comment", err)
+		}
+		ownerID = comment.UserID
+	}
+	if ownerID == "" && body.Action != "dismiss" {
+		return apperror.Gone("The reported content no longer exists; dismiss the report instead")
+	}
+
+	var err error
+	switch body.Action {
+	case "hide":
+		err = setHidden(s.db, s.events, report.TargetType, report.TargetID, report.PostID, true)
+	case "restore":
+		err = setHidden(s.db, s.events, report.TargetType, report.TargetID, report.PostID, false)
+	case "delete":
+		if report.TargetType == models.ReportTargetPost {
+			err = s.removePost(post, moderatorID)
+		} else {
+			err = s.removeComment(comment, moderatorID)
+		}
+	case "warn":
+		err = warnUser(s.db, s.events, ownerID, moderatorID, report, body.Note)
+	}
+	if err != nil {
+		log.Printf("Failed to %s reported %s %s: %v", body.Action, report.TargetType, report.TargetID, err)
+		return apperror.Internal("Failed to resolve report", err)
+	}
+
+	// Every open report on the same content is settled by the same decision.
+	now := time.Now()
+	status := reportActions[body.Action]
+	if err := s.db.Model(&models.Report{}).
+		Where("target_type = ? AND target_id = ? AND status = ?", report.TargetType, report.TargetID, models.ReportStatusOpen).
+		Updates(map[string]interface{}{
+			"status":         status,
+			"resolution":     body.Action,
+			"resolved_by_id": moderatorID,
+			"resolved_at":    now,
+		}).Error; err != nil {
+		return apperror.Internal("Failed to resolve report", err)
+	}
+
+	RecordModerationAction(ctx, s.db, moderatorID, "report."+body.Action, report.TargetType, report.TargetID, fiber.Map{
+		"reportId": report.ID,
+		"ownerId":  ownerID,
+		"note":     body.Note,
+	})
+
+	return ctx.JSON(fiber.Map{"message": "Report resolved", "status": status})
+}
+
+func warnUser(db *gorm.DB, events EventHub, userID string, moderatorID string, report models.Report, note string) error {
+	reason := note
+	if reason == "" {
+		reason = "Your " + report.TargetType + " was reported for " + report.Reason + " and reviewed by a moderator"
+	}
+
+	warning := models.Warning{
+		UserID:     userID,
+		IssuedByID: moderatorID,
+		ReportID:   &report.ID,
+		Reason:     reason,
+		CreatedAt:  time.Now(),
+	}
+	if err := db.Omit("User").Create(&warning).Error; err != nil {
+		return err
+	}
+
+	events.SendToUser(fiber.Map{
+		"type": "WARNING_ISSUED",
+		"data": fiber.Map{
+			"id":         warning.ID,
+			"reason":     warning.Reason,
+			"targetType": report.TargetType,
+			"targetId":   report.TargetID,
+			"postId":     report.PostID,
+			"createdAt":  warning.CreatedAt,
+		},
+	}, userID)
+	return nil
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"blog_post/apperror"
+	"blog_post/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func TestResolveReportFailsWhenTheTargetCannotBeLoaded(t *testing.T) {
+	ts := newTestServer(t)
+	moderator := ts.addUser("Mod", models.RoleModerator, true)
+
+	for _, targetType := range []string{models.ReportTargetPost, models.ReportTargetComment} {
+		t.Run(targetType, func(t *testing.T) {
+			name := "test:report_" + targetType
+			err := ts.db.Callback().Query().After("gorm:query").Register(name, func(tx *gorm.DB) {
+				switch dest := tx.Statement.Dest.(type) {
+				case *models.Report:
+					*dest = models.Report{ID: "report", TargetType: targetType, TargetID: "target", PostID: "post", Status: models.ReportStatusOpen}
+				case *models.Post, *models.Comment:
+					tx.AddError(errors.New("connection lost"))
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ts.db.Callback().Query().Remove(name)
+
+			ts.json(moderator.ID, http.MethodPost, "/moderation/reports/report/resolve", fiber.Map{"action": "dismiss"}).
+				expectError(t, http.StatusInternalServerError, apperror.CodeInternal)
+		})
+	}
+}
+
+func TestReportLookups(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.addUser("Alice", models.RoleModerator, true)
+
+	post := "/posts/00000000-0000-0000-0000-000000000000"
+	comment := post + "/comments/00000000-0000-0000-0000-000000000000"
+	report := fiber.Map{"reason": "spam"}
+	resolve := "/moderation/reports/00000000-0000-0000-0000-000000000000/resolve"
+
+	// The dry-run connection finds nothing.
+	ts.json(alice.ID, http.MethodPost, post+"/report", report).expectError(t, http.StatusNotFound, apperror.CodeNotFound)
+	ts.json(alice.ID, http.MethodPost, comment+"/report", report).expectError(t, http.StatusNotFound, apperror.CodeNotFound)
+	ts.json(alice.ID, http.MethodPost, resolve, fiber.Map{"action": "dismiss"}).expectError(t, http.StatusNotFound, apperror.CodeNotFound)
+
+	err := ts.db.Callback().Query().After("gorm:query").Register("test:broken", func(tx *gorm.DB) {
+		tx.AddError(errors.New("connection lost"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.json(alice.ID, http.MethodPost, post+"/report", report).expectError(t, http.StatusInternalServerError, apperror.CodeInternal)
+	ts.json(alice.ID, http.MethodPost, comment+"/report", report).expectError(t, http.StatusInternalServerError, apperror.CodeInternal)
+	ts.json(alice.ID, http.MethodPost, resolve, fiber.Map{"action": "dismiss"}).expectError(t, http.StatusInternalServerError, apperror.CodeInternal)
+}
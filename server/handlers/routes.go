@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"blog_post/ratelimit"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/gofiber/websocket/v2"
+	"time"
+)
+
+// Routes registers the whole API under /blog_post. The app should use
+// apperror.Handler as its ErrorHandler.
+func (s *Server) Routes(app *fiber.App) {
+	app.Use(requestid.New())
+	blogPost := app.Group("/blog_post")
+
+	signInLimit := ratelimit.PerIP("signIn", ratelimit.FromConfig(s.config.RateLimits, "signin_ip", ratelimit.Rule{Max: 20, Window: 15 * time.Minute}))
+	signInAccountLimit := ratelimit.PerAccount("signInAccount", ratelimit.FromConfig(s.config.RateLimits, "signin_account", ratelimit.Rule{Max: 10, Window: 15 * time.Minute}))
+	twoFactorLimit := ratelimit.PerIP("twoFactor", ratelimit.FromConfig(s.config.RateLimits, "two_factor_ip", ratelimit.Rule{Max: 20, Window: 15 * time.Minute}))
+	signUpLimit := ratelimit.PerIP("signUp", ratelimit.FromConfig(s.config.RateLimits, "signup_ip", ratelimit.Rule{Max: 10, Window: time.Hour}))
+	passwordForgottenLimit := ratelimit.PerIP("passwordForgotten", ratelimit.FromConfig(s.config.RateLimits, "password_forgotten_ip", ratelimit.Rule{Max: 5, Window: 15 * time.Minute}))
+	passwordForgottenAccountLimit := ratelimit.PerAccount("passwordForgottenAccount", ratelimit.FromConfig(s.config.RateLimits, "password_forgotten_account", ratelimit.Rule{Max: 3, Window: 15 * time.Minute}))
+	resetPasswordLimit := ratelimit.PerIP("resetPassword", ratelimit.FromConfig(s.config.RateLimits, "reset_password_ip", ratelimit.Rule{Max: 10, Window: 15 * time.Minute}))
+	postsLimit := ratelimit.PerUser("posts", ratelimit.FromConfig(s.config.RateLimits, "posts", ratelimit.Rule{Max: 10, Window: time.Minute}))
+	commentsLimit := ratelimit.PerUser("comments", ratelimit.FromConfig(s.config.RateLimits, "comments", ratelimit.Rule{Max: 30, Window: time.Minute}))
+	reportsLimit := ratelimit.PerUser("reports", ratelimit.FromConfig(s.config.RateLimits, "reports", ratelimit.Rule{Max: 10, Window: 10 * time.Minute}))
+	likesLimit := ratelimit.PerUser("likes", ratelimit.FromConfig(s.config.RateLimits, "likes", ratelimit.Rule{Max: 60, Window: time.Minute}))
+
+	readScope := RequireScope(ScopeRead)
+	writePostsScope := RequireScope(ScopeWritePosts)
+	writeCommentsScope := RequireScope(ScopeWriteComments)
+	writeNotificationsScope := RequireScope(ScopeWriteNotifications)
+
+	blogPost.Use(cors.New(cors.Config{
+		AllowOrigins:     s.config.AllowedOrigins,
+		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
+		AllowHeaders:     "Origin,Accept,Content-Type,Authorization",
+		AllowCredentials: true,
+		ExposeHeaders:    "Content-Length,X-Request-ID",
+	}))
+	blogPost.Use(APITokenMiddleware(s.db))
+	blogPost.Use(s.SessionMiddleware())
+	blogPost.Use("/auth", RejectAPITokens)
+	blogPost.Use("/admin", RejectAPITokens)
+	blogPost.Use("/moderation", RejectAPITokens, s.RequirePermission(PermissionModerate))
+	blogPost.Use("/ws", HandleWebSocket)
+	blogPost.Get("/ws/", websocket.New(s.events.Serve))
+	blogPost.Post("/auth/signIn", signInLimit, signInAccountLimit, s.HandleSignIn)
+	blogPost.Post("/auth/signIn/2fa", twoFactorLimit, s.HandleTwoFactorSignIn)
+	blogPost.Post("/auth/2fa/enroll", s.HandleTwoFactorEnroll)
+	blogPost.Post("/auth/2fa/confirm", s.HandleTwoFactorConfirm)
+	blogPost.Post("/auth/2fa/disable", s.HandleTwoFactorDisable)
+	blogPost.Post("/auth/2fa/recoveryCodes", s.HandleRegenerateRecoveryCodes)
+	blogPost.Post("/auth/signOut", s.HandleSignOut)
+	blogPost.Get("/auth/sessions", s.HandleGetSessions)
+	blogPost.Delete("/auth/sessions", s.HandleRevokeOtherSessions)
+	blogPost.Delete("/auth/sessions/:id", s.HandleRevokeSession)
+	blogPost.Get("/auth/oidc/:provider/login", s.HandleOIDCLogin)
+	blogPost.Get("/auth/oidc/:provider/callback", s.HandleOIDCCallback)
+	blogPost.Get("/auth/identities", s.HandleGetIdentities)
+	blogPost.Delete("/auth/identities/:id", s.HandleUnlinkIdentity)
+	blogPost.Post("/auth/tokens", s.HandleCreateAPIToken)
+	blogPost.Get("/auth/tokens", s.HandleGetAPITokens)
+	blogPost.Delete("/auth/tokens/:id", s.HandleRevokeAPIToken)
+	blogPost.Post("/auth/signUp", signUpLimit, s.HandleSignUp)
+	blogPost.Post("/auth/verifyEmail", s.HandleVerifyEmail)
+	blogPost.Post("/auth/resendVerification", s.HandleResendVerification)
+	blogPost.Get("/auth/userInfo/:userId", s.HandleUserInfo)
+	blogPost.Put("/auth/updateUserInfo", s.HandleUpdateUserInfo)
+	blogPost.Put("/auth/updatePassword", s.HandleUpdatePassword)
+	blogPost.Delete("/auth/deleteUser", s.HandleDeleteUser)
+	blogPost.Post("/auth/cancelDeletion", s.HandleCancelDeletion)
+	blogPost.Post("/auth/exportData", s.HandleRequestDataExport)
+	blogPost.Get("/auth/exportData", s.HandleGetDataExports)
+	blogPost.Post("auth/passwordForgotten", passwordForgottenLimit, passwordForgottenAccountLimit, s.HandlePasswordForgotten)
+	blogPost.Post("/auth/resetPassword", resetPasswordLimit, s.HandleResetPassword)
+	blogPost.Get("/tags", readScope, s.HandleGetTags)
+	blogPost.Get("/posts", readScope, s.HandleGetPosts)
+	blogPost.Post("/posts/", writePostsScope, postsLimit, s.HandleAddPost)
+	blogPost.Put("/posts/:id", writePostsScope, postsLimit, s.HandleUpdatePost)
+	blogPost.Delete("/posts/:id", writePostsScope, postsLimit, s.HandleDeletePost)
+	blogPost.Post("/posts/:postId/toggleLike", writePostsScope, likesLimit, s.HandleToggleLikePost)
+	blogPost.Post("/posts/:id/comments", writeCommentsScope, commentsLimit, s.HandleAddComment)
+	blogPost.Put("/posts/:postId/comments/:commentId", writeCommentsScope, commentsLimit, s.HandleUpdateComment)
+	blogPost.Delete("/posts/:postId/comments/:commentId", writeCommentsScope, commentsLimit, s.HandleDeleteComment)
+	blogPost.Post("/posts/:id/report", writePostsScope, reportsLimit, s.HandleReportPost)
+	blogPost.Post("/posts/:postId/comments/:commentId/report", writeCommentsScope, reportsLimit, s.HandleReportComment)
+	blogPost.Post("/posts/:id/restore", writePostsScope, postsLimit, s.HandleRestorePost)
+	blogPost.Post("/posts/:postId/comments/:commentId/restore", writeCommentsScope, commentsLimit, s.HandleRestoreComment)
+	blogPost.Get("/trash", readScope, s.HandleGetDeletedContent)
+	blogPost.Post("/posts/:postId/comments/:commentId/toggleLike", writeCommentsScope, likesLimit, s.HandleToggleCommentLike)
+	blogPost.Get("/notifications", readScope, s.HandleGetNotifications)
+	blogPost.Get("/notifications/unreadCount", readScope, s.HandleGetUnreadNotificationCount)
+	blogPost.Put("/notifications/readAll", writeNotificationsScope, s.HandleMarkAllNotificationsRead)
+	blogPost.Put("/notifications/:id/read", writeNotificationsScope, s.HandleMarkNotificationRead)
+	blogPost.Get("/auth/emailPreferences", s.HandleGetEmailPreferences)
+	blogPost.Put("/auth/emailPreferences", s.HandleUpdateEmailPreferences)
+	blogPost.Get("/unsubscribe/:token", s.HandleUnsubscribePage)
+	blogPost.Post("/unsubscribe/:token", s.HandleUnsubscribe)
+	blogPost.Get("/moderation/reports", s.HandleGetReports)
+	blogPost.Post("/moderation/reports/:id/resolve", s.HandleResolveReport)
+	blogPost.Get("/admin/users", s.RequirePermission(PermissionManageRoles), s.HandleAdminGetUsers)
+	blogPost.Put("/admin/users/:id/role", s.RequirePermission(PermissionManageRoles), s.HandleAdminUpdateRole)
+	blogPost.Post("/admin/users/:id/restore", s.RequirePermission(PermissionRestoreUsers), s.HandleAdminRestoreUser)
+	blogPost.Get("/admin/audit", s.RequirePermission(PermissionViewAudit), s.HandleGetAuditEvents)
+	blogPost.Get("/admin/audit/export", s.RequirePermission(PermissionViewAudit), s.HandleExportAuditEvents)
+	blogPost.Get("/admin/moderationActions", s.RequirePermission(PermissionModerate), s.HandleAdminGetModerationActions)
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"blog_post/config"
+	"blog_post/db_aws"
+	"blog_post/mailer"
+	"blog_post/oidc"
+	"blog_post/repo"
+	"blog_post/storage"
+
+	"gorm.io/gorm"
+	"sync"
+)
+
+// Server owns everything the HTTP handlers depend on. Handlers are its
+// methods; Routes registers them. Users, posts, comments, tags and likes go
+// through repos; the remaining features still query db directly.
+type Server struct {
+	db      *gorm.DB
+	repos   repo.Repos
+	storage storage.Storage
+	mail    mailer.Mailer
+	events  EventHub
+	config  config.Config
+	oidc    map[string]*oidc.Client
+
+	passwordParams db_aws.Argon2Params
+	dummyHashOnce  sync.Once
+	dummyHash      string
+}
+
+func NewServer(db *gorm.DB, repos repo.Repos, store storage.Storage, mail mailer.Mailer, events EventHub, cfg config.Config) *Server {
+	return &Server{
+		db:      db,
+		repos:   repos,
+		storage: store,
+		mail:    mail,
+		events:  events,
+		config:  cfg,
+		oidc:    oidc.ClientsFromConfig(cfg.OIDCProviders, cfg.APIURL+"/blog_post/auth/oidc"),
+
+		passwordParams: db_aws.Argon2Params(cfg.Argon2),
+	}
+}
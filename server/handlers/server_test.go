@@ -0,0 +1,698 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"blog_post/apperror"
+	"blog_post/config"
+	"blog_post/db_aws"
+	"blog_post/mailer"
+	"blog_post/models"
+	"blog_post/repo"
+	"blog_post/storage"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// These tests run the routes in process on the memory repositories and
+// storage, so they need no database. The side tables that still go through
+// db (sessions, audit, notifications) get a dry-run connection: writes are
+// dropped, reads find nothing and explicit transactions fail, which those
+// features only log. The e2e package covers them on PostgreSQL.
+
+var testArgon2 = db_aws.Argon2Params{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+// recordingMailer keeps every message instead of sending it.
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *recordingMailer) Send(msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// waitFor returns the first message to the address whose subject contains
+// subject. Sign-up sends its emails in the background, so it polls.
+func (m *recordingMailer) waitFor(t *testing.T, to string, subject string) mailer.Message {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		for _, msg := range m.messages {
+			if msg.To == to && strings.Contains(msg.Subject, subject) {
+				m.mu.Unlock()
+				return msg
+			}
+		}
+		m.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("no email %q to %s", subject, to)
+	return mailer.Message{}
+}
+
+// recordingHub keeps every broadcast event.
+type recordingHub struct {
+	mu     sync.Mutex
+	events []fiber.Map
+}
+
+func (h *recordingHub) Serve(conn *websocket.Conn) {}
+
+func (h *recordingHub) Broadcast(message interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, message.(fiber.Map))
+}
+
+func (h *recordingHub) SendToUser(message interface{}, userID string) {}
+
+func (h *recordingHub) types() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	types := []string{}
+	for _, event := range h.events {
+		types = append(types, event["type"].(string))
+	}
+	return types
+}
+
+type testServer struct {
+	t       *testing.T
+	app     *fiber.App
+	db      *gorm.DB
+	repos   repo.Repos
+	storage *storage.Memory
+	mail    *recordingMailer
+	hub     *recordingHub
+}
+
+// newDryRunDB returns a connection that builds queries without running them.
+func newDryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=/nonexistent"}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newTestServer serves the routes on a dry-run database and the memory
+// repositories. options can swap out parts before the server is built.
+func newTestServer(t *testing.T, options ...func(ts *testServer)) *testServer {
+	t.Helper()
+
+	db := newDryRunDB(t)
+	ts := &testServer{
+		t:       t,
+		db:      db,
+		repos:   repo.NewMemory(),
+		storage: storage.NewMemory(),
+		mail:    &recordingMailer{},
+		hub:     &recordingHub{},
+	}
+
+	cfg := config.Config{
+		Env:            config.EnvDevelopment,
+		AppURL:         "http://localhost:3000",
+		APIURL:         "http://localhost:8080",
+		AllowedOrigins: "http://localhost:3000",
+		Argon2:         config.Argon2(testArgon2),
+	}
+
+	// The memory repositories keep the strings they are given, which fiber
+	// otherwise reuses once the request is done.
+	ts.app = fiber.New(fiber.Config{ErrorHandler: apperror.Handler, Immutable: true, DisableStartupMessage: true})
+	// Stands in for the session cookie and API tokens, which live in db.
+	ts.app.Use(func(ctx *fiber.Ctx) error {
+		if userID := ctx.Get("X-Test-User"); userID != "" {
+			ctx.Locals("userId", userID)
+		}
+		if scopes := ctx.Get("X-Test-Scopes"); scopes != "" {
+			ctx.Locals("tokenScopes", strings.Fields(scopes))
+		}
+		return ctx.Next()
+	})
+	for _, option := range options {
+		option(ts)
+	}
+	NewServer(db, ts.repos, ts.storage, ts.mail, ts.hub, cfg).Routes(ts.app)
+
+	return ts
+}
+
+// addUser stores a user with the password "password123".
+func (ts *testServer) addUser(firstName string, role string, verified bool) models.User {
+	ts.t.Helper()
+
+	hash, err := db_aws.HashPassword("password123", testArgon2)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	user := models.User{
+		FirstName:     firstName,
+		LastName:      "Test",
+		Email:         strings.ToLower(firstName) + "@example.com",
+		HashPassword:  hash,
+		Role:          role,
+		EmailVerified: verified,
+	}
+	if err := ts.repos.Users.Create(&user); err != nil {
+		ts.t.Fatal(err)
+	}
+	return user
+}
+
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func (r response) decode(t *testing.T, value interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(r.body, value); err != nil {
+		t.Fatalf("decode response %s: %v", r.body, err)
+	}
+}
+
+func (r response) expect(t *testing.T, status int) response {
+	t.Helper()
+	if r.status != status {
+		t.Fatalf("got status %d, want %d: %s", r.status, status, r.body)
+	}
+	return r
+}
+
+func (r response) expectError(t *testing.T, status int, code string) apperror.Body {
+	t.Helper()
+	r.expect(t, status)
+	var body apperror.Body
+	r.decode(t, &body)
+	if body.Code != code {
+		t.Fatalf("got error code %q, want %q: %s", body.Code, code, r.body)
+	}
+	return body
+}
+
+func (ts *testServer) do(userID string, method string, path string, contentType string, body io.Reader) response {
+	ts.t.Helper()
+
+	req := httptest.NewRequest(method, "/blog_post"+path, body)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if userID != "" {
+		req.Header.Set("X-Test-User", userID)
+	}
+
+	res, err := ts.app.Test(req, -1)
+	if err != nil {
+		ts.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer res.Body.Close()
+
+	content, err := io.ReadAll(res.Body)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	return response{status: res.StatusCode, header: res.Header, body: content}
+}
+
+func (ts *testServer) json(userID string, method string, path string, body interface{}) response {
+	ts.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	return ts.do(userID, method, path, fiber.MIMEApplicationJSON, reader)
+}
+
+// form sends a multipart form, attaching an image unless image is "".
+func (ts *testServer) form(userID string, method string, path string, fields map[string][]string, image string) response {
+	ts.t.Helper()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for name, values := range fields {
+		for _, value := range values {
+			writer.WriteField(name, value)
+		}
+	}
+	if image != "" {
+		part, err := writer.CreateFormFile("image", image)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		part.Write([]byte("image bytes"))
+	}
+	writer.Close()
+
+	return ts.do(userID, method, path, writer.FormDataContentType(), &buf)
+}
+
+type postView struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	ImageURL  string `json:"imageUrl"`
+	LikeCount int    `json:"likeCount"`
+	LikedByMe bool   `json:"likedByMe"`
+	Tags      []struct {
+		Name string `json:"name"`
+	} `json:"tags"`
+	Comments []struct {
+		ID       string  `json:"id"`
+		Message  string  `json:"message"`
+		ParentID *string `json:"parentId"`
+		Deleted  bool    `json:"deleted"`
+	} `json:"comments"`
+}
+
+func (ts *testServer) posts(userID string) []postView {
+	ts.t.Helper()
+	var posts []postView
+	ts.json(userID, http.MethodGet, "/posts", nil).expect(ts.t, http.StatusOK).decode(ts.t, &posts)
+	return posts
+}
+
+// addPost creates a post as userID and returns it as the listing shows it.
+func (ts *testServer) addPost(userID string, title string, tags ...string) postView {
+	ts.t.Helper()
+
+	ts.form(userID, http.MethodPost, "/posts/", map[string][]string{
+		"title": {title},
+		"body":  {"Body of " + title},
+		"tags":  tags,
+	}, "photo.png").expect(ts.t, http.StatusCreated)
+
+	for _, post := range ts.posts(userID) {
+		if post.Title == title {
+			return post
+		}
+	}
+	ts.t.Fatalf("post %q not listed", title)
+	return postView{}
+}
+
+func TestSignUp(t *testing.T) {
+	ts := newTestServer(t)
+
+	ts.json("", http.MethodPost, "/auth/signUp", fiber.Map{
+		"firstName": "Alice",
+		"lastName":  "Smith",
+		"email":     " Alice@Example.com ",
+		"password":  "password123",
+	}).expect(t, http.StatusAccepted)
+
+	msg := ts.mail.waitFor(t, "alice@example.com", "Verify your email address")
+	if !strings.Contains(msg.Text, "http://localhost:3000/") {
+		t.Fatalf("verification email has no link: %s", msg.Text)
+	}
+
+	user, err := ts.repos.Users.GetByEmail("alice@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.EmailVerified || user.HashPassword == "password123" {
+		t.Fatalf("unexpected user %+v", user)
+	}
+
+	// A second sign-up answers the same and warns the owner instead.
+	ts.json("", http.MethodPost, "/auth/signUp", fiber.Map{
+		"firstName": "Mallory",
+		"lastName":  "Jones",
+		"email":     "alice@example.com",
+		"password":  "password456",
+	}).expect(t, http.StatusAccepted)
+	ts.mail.waitFor(t, "alice@example.com", "Sign-up attempt")
+}
+
+// racingUsers stores rival right after the first email lookup, as a sign-up
+// finishing at the same time would.
+type racingUsers struct {
+	repo.UserRepo
+	rival *models.User
+	once  sync.Once
+}
+
+func (r *racingUsers) GetByEmailWithDeleted(email string) (models.User, error) {
+	user, err := r.UserRepo.GetByEmailWithDeleted(email)
+	r.once.Do(func() {
+		if err := r.UserRepo.Create(r.rival); err != nil {
+			panic(err)
+		}
+	})
+	return user, err
+}
+
+func TestSignUpRacingAnotherSignUp(t *testing.T) {
+	rival := &models.User{FirstName: "Rival", Email: "alice@example.com"}
+	ts := newTestServer(t, func(ts *testServer) {
+		ts.repos.Users = &racingUsers{UserRepo: ts.repos.Users, rival: rival}
+	})
+
+	ts.json("", http.MethodPost, "/auth/signUp", fiber.Map{
+		"firstName": "Alice",
+		"lastName":  "Smith",
+		"email":     "alice@example.com",
+		"password":  "password123",
+	}).expect(t, http.StatusAccepted)
+
+	// The sign-up that lost answers like any taken email.
+	ts.mail.waitFor(t, "alice@example.com", "Sign-up attempt")
+	if user, err := ts.repos.Users.GetByEmail("alice@example.com"); err != nil || user.ID != rival.ID {
+		t.Fatalf("got %+v, %v; want the rival's account", user, err)
+	}
+}
+
+func TestSignUpValidation(t *testing.T) {
+	ts := newTestServer(t)
+
+	body := ts.json("", http.MethodPost, "/auth/signUp", fiber.Map{
+		"firstName": "  ",
+		"lastName":  "Smith",
+		"email":     "not-an-email",
+		"password":  "short",
+	}).expectError(t, http.StatusUnprocessableEntity, apperror.CodeValidationFailed)
+
+	want := map[string]string{
+		"firstName": "firstName is required",
+		"email":     "email must be a valid email address",
+		"password":  "password must be at least 8 characters",
+	}
+	for field, message := range want {
+		if body.Fields[field] != message {
+			t.Errorf("field %s: got %q, want %q", field, body.Fields[field], message)
+		}
+	}
+	if len(body.Fields) != len(want) {
+		t.Errorf("got fields %v", body.Fields)
+	}
+}
+
+func TestSignIn(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.addUser("Alice", models.RoleUser, true)
+
+	var user struct {
+		ID string `json:"id"`
+	}
+	res := ts.json("", http.MethodPost, "/auth/signIn", fiber.Map{"email": "ALICE@example.com", "password": "password123"}).expect(t, http.StatusOK)
+	res.decode(t, &user)
+	if user.ID != alice.ID {
+		t.Fatalf("signed in as %q, want %q", user.ID, alice.ID)
+	}
+	if !strings.Contains(strings.Join(res.header.Values("Set-Cookie"), "\n"), sessionCookieName+"=") {
+		t.Fatalf("no session cookie in %v", res.header.Values("Set-Cookie"))
+	}
+
+	wrong := ts.json("", http.MethodPost, "/auth/signIn", fiber.Map{"email": "alice@example.com", "password": "wrong-password"}).
+		expectError(t, http.StatusUnauthorized, apperror.CodeInvalidCredentials)
+	unknown := ts.json("", http.MethodPost, "/auth/signIn", fiber.Map{"email": "nobody@example.com", "password": "password123"}).
+		expectError(t, http.StatusUnauthorized, apperror.CodeInvalidCredentials)
+	if wrong.Message != unknown.Message {
+		t.Fatalf("unknown email answered %q, wrong password %q", unknown.Message, wrong.Message)
+	}
+}
+
+func TestPostLifecycle(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.addUser("Alice", models.RoleUser, true)
+
+	post := ts.addPost(alice.ID, "First post", " go ", "news")
+	if post.Body != "Body of First post" || len(post.Tags) != 2 || post.Tags[0].Name != "go" || post.Tags[1].Name != "news" {
+		t.Fatalf("unexpected post %+v", post)
+	}
+	if keys := ts.storage.Keys(); len(keys) != 1 || ts.storage.KeyFromURL(post.ImageURL) != keys[0] {
+		t.Fatalf("image %q not stored, have %v", post.ImageURL, keys)
+	}
+
+	var tags []models.Tag
+	ts.json(alice.ID, http.MethodGet, "/tags", nil).expect(t, http.StatusOK).decode(t, &tags)
+	if len(tags) != 2 {
+		t.Fatalf("got tags %+v", tags)
+	}
+
+	ts.form(alice.ID, http.MethodPut, "/posts/"+post.ID, map[string][]string{
+		"title": {"Edited"},
+		"body":  {"New body"},
+		"tags":  {"go"},
+	}, "").expect(t, http.StatusOK)
+
+	posts := ts.posts(alice.ID)
+	if len(posts) != 1 || posts[0].Title != "Edited" || posts[0].Body != "New body" || len(posts[0].Tags) != 1 {
+		t.Fatalf("post not updated: %+v", posts)
+	}
+
+	ts.json(alice.ID, http.MethodDelete, "/posts/"+post.ID, nil).expect(t, http.StatusOK)
+	if posts := ts.posts(alice.ID); len(posts) != 0 {
+		t.Fatalf("deleted post still listed: %+v", posts)
+	}
+
+	want := []string{"POST_ADDED", "POST_UPDATED", "POST_DELETED"}
+	if got := ts.hub.types(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("got events %v, want %v", got, want)
+	}
+}
+
+func TestAddPostRequiresVerifiedEmailAndImage(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.addUser("Alice", models.RoleUser, true)
+	bob := ts.addUser("Bob", models.RoleUser, false)
+	fields := map[string][]string{"title": {"Title"}, "body": {"Body"}}
+
+	ts.form("", http.MethodPost, "/posts/", fields, "photo.png").expectError(t, http.StatusUnauthorized, apperror.CodeUnauthorized)
+	ts.form(bob.ID, http.MethodPost, "/posts/", fields, "photo.png").expectError(t, http.StatusForbidden, apperror.CodeEmailNotVerified)
+	ts.form(alice.ID, http.MethodPost, "/posts/", fields, "").expectError(t, http.StatusUnprocessableEntity, apperror.CodeValidationFailed)
+
+	body := ts.form(alice.ID, http.MethodPost, "/posts/", map[string][]string{"title": {"Title"}, "body": {" "}}, "photo.png").
+		expectError(t, http.StatusUnprocessableEntity, apperror.CodeValidationFailed)
+	if body.Fields["body"] != "body is required" {
+		t.Fatalf("got fields %v", body.Fields)
+	}
+}
+
+func TestPostPermissions(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.addUser("Alice", models.RoleUser, true)
+	bob := ts.addUser("Bob", models.RoleUser, true)
+	moderator := ts.addUser("Mod", models.RoleModerator, true)
+	admin := ts.addUser("Admin", models.RoleAdmin, true)
+
+	post := ts.addPost(alice.ID, "Alice's post")
+	edit := map[string][]string{"title": {"Hijacked"}, "body": {"Hijacked"}}
+
+	ts.form(bob.ID, http.MethodPut, "/posts/"+post.ID, edit, "").expectError(t, http.StatusForbidden, apperror.CodeForbidden)
+	ts.json(bob.ID, http.MethodDelete, "/posts/"+post.ID, nil).expectError(t, http.StatusForbidden, apperror.CodeForbidden)
+
+	// Moderators may remove posts but only admins may rewrite them.
+	ts.form(moderator.ID, http.MethodPut, "/posts/"+post.ID, edit, "").expectError(t, http.StatusForbidden, apperror.CodeForbidden)
+	ts.form(admin.ID, http.MethodPut, "/posts/"+post.ID, edit, "").expect(t, http.StatusOK)
+	ts.json(moderator.ID, http.MethodDelete, "/posts/"+post.ID, nil).expect(t, http.StatusOK)
+	ts.json(alice.ID, http.MethodDelete, "/posts/"+post.ID, nil).expectError(t, http.StatusNotFound, apperror.CodeNotFound)
+}
+
+func TestCommentThreads(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.addUser("Alice", models.RoleUser, true)
+	bob := ts.addUser("Bob", models.RoleUser, true)
+	post := ts.addPost(alice.ID, "Discussion")
+
+	ts.json(bob.ID, http.MethodPost, "/posts/"+post.ID+"/comments", fiber.Map{"message": "First"}).expect(t, http.StatusCreated)
+	parent := ts.posts(bob.ID)[0].Comments[0]
+
+	ts.json(alice.ID, http.MethodPost, "/posts/"+post.ID+"/comments", fiber.Map{"message": "Reply", "parentId": parent.ID}).expect(t, http.StatusCreated)
+	reply := ts.posts(bob.ID)[0].Comments[0]
+	ts.json(alice.ID, http.MethodPost, "/posts/"+post.ID+"/comments", fiber.Map{"message": "Bad", "parentId": "not-an-id"}).
+		expectError(t, http.StatusUnprocessableEntity, apperror.CodeValidationFailed)
+
+	// Comments are listed newest first.
+	comments := ts.posts(bob.ID)[0].Comments
+	if len(comments) != 2 || comments[0].ID != reply.ID || comments[0].ParentID == nil || *comments[0].ParentID != parent.ID {
+		t.Fatalf("reply not threaded: %+v", comments)
+	}
+
+	ts.json(alice.ID, http.MethodDelete, "/posts/"+post.ID+"/comments/"+parent.ID, nil).expectError(t, http.StatusForbidden, apperror.CodeForbidden)
+	ts.json(bob.ID, http.MethodDelete, "/posts/"+post.ID+"/comments/"+parent.ID, nil).expect(t, http.StatusOK)
+
+	// The deleted parent stays as a placeholder while its reply remains.
+	comments = ts.posts(bob.ID)[0].Comments
+	if len(comments) != 2 || comments[0].Message != "Reply" || !comments[1].Deleted || comments[1].Message != "[deleted]" {
+		t.Fatalf("unexpected thread after delete: %+v", comments)
+	}
+}
+
+func TestToggleLikePost(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.addUser("Alice", models.RoleUser, true)
+	bob := ts.addUser("Bob", models.RoleUser, true)
+	post := ts.addPost(alice.ID, "Likeable")
+
+	var result struct {
+		Message string `json:"message"`
+	}
+	ts.json(bob.ID, http.MethodPost, "/posts/"+post.ID+"/toggleLike", nil).expect(t, http.StatusOK).decode(t, &result)
+	if result.Message != "Post Liked" {
+		t.Fatalf("got %q", result.Message)
+	}
+	if liked := ts.posts(bob.ID)[0]; liked.LikeCount != 1 || !liked.LikedByMe {
+		t.Fatalf("like not counted: %+v", liked)
+	}
+	if seen := ts.posts(alice.ID)[0]; seen.LikeCount != 1 || seen.LikedByMe {
+		t.Fatalf("like shown wrongly to the author: %+v", seen)
+	}
+
+	ts.json(bob.ID, http.MethodPost, "/posts/"+post.ID+"/toggleLike", nil).expect(t, http.StatusOK).decode(t, &result)
+	if result.Message != "Post Unliked" {
+		t.Fatalf("got %q", result.Message)
+	}
+	if unliked := ts.posts(bob.ID)[0]; unliked.LikeCount != 0 || unliked.LikedByMe {
+		t.Fatalf("like not removed: %+v", unliked)
+	}
+
+	ts.json("", http.MethodPost, "/posts/"+post.ID+"/toggleLike", nil).expectError(t, http.StatusUnauthorized, apperror.CodeUnauthorized)
+}
+
+// Anonymous callers are turned away before the content is looked up, so they
+// cannot tell which IDs exist.
+func TestWritesRequireAuthenticationFirst(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.addUser("Alice", models.RoleUser, true)
+	post := ts.addPost(alice.ID, "Existing")
+	ts.json(alice.ID, http.MethodPost, "/posts/"+post.ID+"/comments", fiber.Map{"message": "Existing"}).expect(t, http.StatusCreated)
+	comment := ts.posts(alice.ID)[0].Comments[0]
+
+	missing := "00000000-0000-0000-0000-000000000000"
+	edit := map[string][]string{"title": {"Title"}, "body": {"Body"}}
+	for _, postID := range []string{post.ID, missing} {
+		ts.form("", http.MethodPut, "/posts/"+postID, edit, "").expectError(t, http.StatusUnauthorized, apperror.CodeUnauthorized)
+		ts.json("", http.MethodDelete, "/posts/"+postID, nil).expectError(t, http.StatusUnauthorized, apperror.CodeUnauthorized)
+	}
+	for _, commentID := range []string{comment.ID, missing} {
+		path := "/posts/" + post.ID + "/comments/" + commentID
+		ts.json("", http.MethodPut, path, fiber.Map{"message": "Edited"}).expectError(t, http.StatusUnauthorized, apperror.CodeUnauthorized)
+		ts.json("", http.MethodDelete, path, nil).expectError(t, http.StatusUnauthorized, apperror.CodeUnauthorized)
+	}
+}
+
+// Anonymous callers learn nothing about the expected body either: they are
+// turned away before it is validated.
+func TestAuthenticationIsCheckedBeforeTheBody(t *testing.T) {
+	ts := newTestServer(t)
+	missing := "00000000-0000-0000-0000-000000000000"
+
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPost, "/auth/tokens"},
+		{http.MethodPut, "/auth/emailPreferences"},
+		{http.MethodPut, "/auth/updateUserInfo"},
+		{http.MethodPut, "/auth/updatePassword"},
+		{http.MethodPost, "/auth/2fa/confirm"},
+		{http.MethodPost, "/auth/2fa/disable"},
+		{http.MethodPost, "/auth/2fa/recoveryCodes"},
+		{http.MethodPost, "/posts/"},
+		{http.MethodPut, "/posts/" + missing},
+		{http.MethodPost, "/posts/" + missing + "/comments"},
+		{http.MethodPut, "/posts/" + missing + "/comments/" + missing},
+		{http.MethodPost, "/moderation/reports/" + missing + "/resolve"},
+	} {
+		ts.json("", route.method, route.path, fiber.Map{}).expectError(t, http.StatusUnauthorized, apperror.CodeUnauthorized)
+	}
+}
+
+func TestLikesAndCommentsNeedAnExistingPost(t *testing.T) {
+	ts := newTestServer(t)
+	alice := ts.addUser("Alice", models.RoleUser, true)
+	bob := ts.addUser("Bob", models.RoleUser, true)
+
+	deleted := ts.addPost(alice.ID, "Deleted")
+	ts.json(alice.ID, http.MethodDelete, "/posts/"+deleted.ID, nil).expect(t, http.StatusOK)
+
+	other := ts.addPost(alice.ID, "Other")
+	ts.json(bob.ID, http.MethodPost, "/posts/"+other.ID+"/comments", fiber.Map{"message": "Elsewhere"}).expect(t, http.StatusCreated)
+	otherComment := ts.posts(bob.ID)[0].Comments[0]
+
+	post := ts.addPost(alice.ID, "Live")
+	missing := "00000000-0000-0000-0000-000000000000"
+
+	for _, postID := range []string{missing, deleted.ID} {
+		ts.json(bob.ID, http.MethodPost, "/posts/"+postID+"/toggleLike", nil).expectError(t, http.StatusNotFound, apperror.CodeNotFound)
+		ts.json(bob.ID, http.MethodPost, "/posts/"+postID+"/comments", fiber.Map{"message": "Hello"}).expectError(t, http.StatusNotFound, apperror.CodeNotFound)
+	}
+	for _, parentID := range []string{missing, otherComment.ID} {
+		ts.json(bob.ID, http.MethodPost, "/posts/"+post.ID+"/comments", fiber.Map{"message": "Reply", "parentId": parentID}).
+			expectError(t, http.StatusNotFound, apperror.CodeNotFound)
+	}
+	ts.json(bob.ID, http.MethodPost, "/posts/"+post.ID+"/comments/"+missing+"/toggleLike", nil).expectError(t, http.StatusNotFound, apperror.CodeNotFound)
+
+	ts.json(alice.ID, http.MethodDelete, "/posts/"+other.ID+"/comments/"+otherComment.ID, nil).expectError(t, http.StatusForbidden, apperror.CodeForbidden)
+	ts.json(bob.ID, http.MethodDelete, "/posts/"+other.ID+"/comments/"+otherComment.ID, nil).expect(t, http.StatusOK)
+	ts.json(alice.ID, http.MethodPost, "/posts/"+other.ID+"/comments/"+otherComment.ID+"/toggleLike", nil).expectError(t, http.StatusNotFound, apperror.CodeNotFound)
+
+	if posts := ts.posts(bob.ID); len(posts) != 2 || len(posts[0].Comments) != 0 || posts[0].LikeCount != 0 {
+		t.Fatalf("rejected requests left traces: %+v", posts)
+	}
+}
+
+// brokenPosts and brokenComments fail every lookup, as they would with the
+// database down.
+type brokenPosts struct{ repo.PostRepo }
+
+func (brokenPosts) Get(id string) (models.Post, error) {
+	return models.Post{}, errors.New("connection lost")
+}
+
+type brokenComments struct{ repo.CommentRepo }
+
+func (brokenComments) Get(id string) (models.Comment, error) {
+	return models.Comment{}, errors.New("connection lost")
+}
+
+func TestEditsFailWhenTheContentCannotBeLoaded(t *testing.T) {
+	ts := newTestServer(t, func(ts *testServer) {
+		ts.repos.Posts = brokenPosts{ts.repos.Posts}
+		ts.repos.Comments = brokenComments{ts.repos.Comments}
+	})
+	alice := ts.addUser("Alice", models.RoleUser, true)
+
+	path := "/posts/00000000-0000-0000-0000-000000000000"
+	ts.form(alice.ID, http.MethodPut, path, map[string][]string{"title": {"Title"}, "body": {"Body"}}, "").
+		expectError(t, http.StatusInternalServerError, apperror.CodeInternal)
+	ts.json(alice.ID, http.MethodDelete, path, nil).expectError(t, http.StatusInternalServerError, apperror.CodeInternal)
+
+	path += "/comments/00000000-0000-0000-0000-000000000000"
+	ts.json(alice.ID, http.MethodPut, path, fiber.Map{"message": "Edited"}).expectError(t, http.StatusInternalServerError, apperror.CodeInternal)
+	ts.json(alice.ID, http.MethodDelete, path, nil).expectError(t, http.StatusInternalServerError, apperror.CodeInternal)
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"blog_post/apperror"
+	"blog_post/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+const (
+	sessionCookieName     = "session"
+	sessionTTL            = 24 * time.Hour
+	sessionTouchInterval  = time.Minute
+	sessionCleanupPeriod  = time.Hour
+	sessionUserAgentLimit = 512
+)
+
+func currentUserID(ctx *fiber.Ctx) string {
+	userID, _ := ctx.Locals("userId").(string)
+	return userID
+}
+
+func currentSessionID(ctx *fiber.Ctx) string {
+	sessionID, _ := ctx.Locals("sessionId").(string)
+	return sessionID
+}
+
+func (s *Server) setSessionCookies(ctx *fiber.Ctx, token string, userID string, expiresAt time.Time) {
+	secure := s.config.CookieSecure
+
+	ctx.Cookie(&fiber.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Expires:  expiresAt,
+		HTTPOnly: true,
+		Secure:   secure,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	// The client only reads userId to know who is signed in; it is never
+	// trusted for authentication.
+	ctx.Cookie(&fiber.Cookie{
+		Name:     "userId",
+		Value:    userID,
+		Expires:  expiresAt,
+		Secure:   secure,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+func clearSessionCookies(ctx *fiber.Ctx) {
+	ctx.ClearCookie(sessionCookieName, "userId")
+}
+
+func (s *Server) createSession(ctx *fiber.Ctx, userID string) error {
+	token, err := newToken()
+	if err != nil {
+		return err
+	}
+
+	userAgent := ctx.Get(fiber.HeaderUserAgent)
+	if len(userAgent) > sessionUserAgentLimit {
+		userAgent = userAgent[:sessionUserAgentLimit]
+	}
+
+	now := time.Now()
+	session := models.Session{
+		UserID:     userID,
+		TokenHash:  hashToken(token),
+		UserAgent:  userAgent,
+		IP:         ctx.IP(),
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(sessionTTL),
+	}
+	if err := s.db.Omit("User").Create(&session).Error; err != nil {
+		return err
+	}
+
+	RecordAudit(ctx, s.db, userID, AuditSignIn, "session", session.ID, nil)
+
+	s.setSessionCookies(ctx, token, userID, session.ExpiresAt)
+	return nil
+}
+
+// SessionMiddleware resolves the session cookie to a user and stores it in
+// ctx.Locals. Sessions slide: every request pushes the expiry out again once
+// half of the lifetime has passed.
+func (s *Server) SessionMiddleware() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		token := ctx.Cookies(sessionCookieName)
+		if token == "" || currentUserID(ctx) != "" {
+			return ctx.Next()
+		}
+
+		session := models.Session{}
+		if err := s.db.Where("token_hash = ?", hashToken(token)).Limit(1).Find(&session).Error; err != nil {
+			log.Println("Failed to retrieve session:", err)
+			return ctx.Next()
+		}
+
+		now := time.Now()
+		if session.ID == "" || now.After(session.ExpiresAt) {
+			if session.ID != "" {
+				s.db.Delete(&session)
+			}
+			clearSessionCookies(ctx)
+			return ctx.Next()
+		}
+
+		updates := map[string]interface{}{}
+		if now.Sub(session.LastSeenAt) > sessionTouchInterval {
+			updates["last_seen_at"] = now
+			updates["ip"] = ctx.IP()
+		}
+		if session.ExpiresAt.Sub(now) < sessionTTL/2 {
+			session.ExpiresAt = now.Add(sessionTTL)
+			updates["expires_at"] = session.ExpiresAt
+			s.setSessionCookies(ctx, token, session.UserID, session.ExpiresAt)
+		}
+		if len(updates) > 0 {
+			if err := s.db.Model(&session).Updates(updates).Error; err != nil {
+				log.Println("Failed to refresh session:", err)
+			}
+		}
+
+		ctx.Locals("userId", session.UserID)
+		ctx.Locals("sessionId", session.ID)
+		return ctx.Next()
+	}
+}
+
+func RevokeUserSessions(db *gorm.DB, userID string, exceptSessionID string) error {
+	query := db.Where("user_id = ?", userID)
+	if exceptSessionID != "" {
+		query = query.Where("id <> ?", exceptSessionID)
+	}
+	return query.Delete(&models.Session{}).Error
+}
+
+func CleanExpiredSessions(db *gorm.DB) {
+	ticker := time.NewTicker(sessionCleanupPeriod)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		result := db.Where("expires_at < ?", time.Now()).Delete(&models.Session{})
+		if result.Error != nil {
+			log.Printf("Failed to delete expired sessions: %v", result.Error)
+		} else if result.RowsAffected > 0 {
+			log.Printf("Deleted %d expired sessions", result.RowsAffected)
+		}
+	}
+}
+
+func (s *Server) HandleSignOut(ctx *fiber.Ctx) error {
+	if sessionID := currentSessionID(ctx); sessionID != "" {
+		if err := s.db.Where("id = ?", sessionID).Delete(&models.Session{}).Error; err != nil {
+			return apperror.Internal("Failed to sign out", err)
+		}
+		RecordAudit(ctx, s.db, currentUserID(ctx), AuditSignOut, "session", sessionID, nil)
+	}
+
+	clearSessionCookies(ctx)
+	return ctx.JSON(fiber.Map{"message": "Signed out"})
+}
+
+func (s *Server) HandleGetSessions(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	sessions := []models.Session{}
+	if err := s.db.Where("user_id = ? AND expires_at > ?", userID, time.Now()).Order("last_seen_at DESC").Find(&sessions).Error; err != nil {
+		return apperror.Internal("Failed to retrieve sessions", err)
+	}
+
+	result := []fiber.Map{}
+	for _, session := range sessions {
+		result = append(result, fiber.Map{
+			"id":         session.ID,
+			"userAgent":  session.UserAgent,
+			"ip":         session.IP,
+			"createdAt":  session.CreatedAt,
+			"lastSeenAt": session.LastSeenAt,
+			"expiresAt":  session.ExpiresAt,
+			"current":    session.ID == currentSessionID(ctx),
+		})
+	}
+
+	return ctx.JSON(result)
+}
+
+func (s *Server) HandleRevokeSession(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	sessionID := ctx.Params("id")
+	result := s.db.Where("id = ? AND user_id = ?", sessionID, userID).Delete(&models.Session{})
+	if result.Error != nil {
+		return apperror.Internal("Failed to revoke session", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return apperror.NotFound("Session not found")
+	}
+
+	if sessionID == currentSessionID(ctx) {
+		clearSessionCookies(ctx)
+	}
+
+	RecordAudit(ctx, s.db, userID, AuditSessionRevoked, "session", sessionID, nil)
+
+	return ctx.JSON(fiber.Map{"message": "Session revoked"})
+}
+
+func (s *Server) HandleRevokeOtherSessions(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	if err := RevokeUserSessions(s.db, userID, currentSessionID(ctx)); err != nil {
+		return apperror.Internal("Failed to revoke sessions", err)
+	}
+
+	RecordAudit(ctx, s.db, userID, AuditOtherSessionsRevoked, "user", userID, nil)
+
+	return ctx.JSON(fiber.Map{"message": "All other sessions revoked"})
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"blog_post/apperror"
+	"blog_post/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"time"
+)
+
+// canRestore lets owners bring back what they deleted themselves. Content
+// removed by a moderator can only be restored by someone with the matching
+// permission.
+func (s *Server) canRestore(userID string, ownerID string, deletedByID *string, permission string) (allowed bool, privileged bool) {
+	if userID == ownerID && (deletedByID == nil || *deletedByID == ownerID) {
+		return true, false
+	}
+	if s.userHasPermission(userID, permission) {
+		return true, true
+	}
+	return false, false
+}
+
+func (s *Server) restoreDeadline(deletedAt gorm.DeletedAt) time.Time {
+	return deletedAt.Time.Add(s.config.DeletedRetention)
+}
+
+func (s *Server) HandleGetDeletedContent(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	cutoff := time.Now().Add(-s.config.DeletedRetention)
+	ownDeletions := "user_id = ? AND deleted_at > ? AND (deleted_by_id IS NULL OR deleted_by_id = user_id)"
+
+	posts := []models.Post{}
+	if err := s.db.Unscoped().Where(ownDeletions, userID, cutoff).Order("deleted_at DESC").Find(&posts).Error; err != nil {
+		return apperror.Internal("Failed to retrieve deleted posts", err)
+	}
+
+	comments := []models.Comment{}
+	if err := s.db.Unscoped().Where(ownDeletions, userID, cutoff).Order("deleted_at DESC").Find(&comments).Error; err != nil {
+		return apperror.Internal("Failed to retrieve deleted comments", err)
+	}
+
+	deletedPosts := []fiber.Map{}
+	for _, post := range posts {
+		deletedPosts = append(deletedPosts, fiber.Map{
+			"id":           post.ID,
+			"title":        post.Title,
+			"deletedAt":    post.DeletedAt.Time,
+			"restoreUntil": s.restoreDeadline(post.DeletedAt),
+		})
+	}
+
+	deletedComments := []fiber.Map{}
+	for _, comment := range comments {
+		deletedComments = append(deletedComments, fiber.Map{
+			"id":           comment.ID,
+			"postId":       comment.PostID,
+			"message":      comment.Message,
+			"deletedAt":    comment.DeletedAt.Time,
+			"restoreUntil": s.restoreDeadline(comment.DeletedAt),
+		})
+	}
+
+	return ctx.JSON(fiber.Map{"posts": deletedPosts, "comments": deletedComments})
+}
+
+func (s *Server) HandleRestorePost(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	post := models.Post{}
+	if err := s.db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", ctx.Params("id")).Limit(1).Find(&post).Error; err != nil {
+		return apperror.Internal("Failed to retrieve post", err)
+	}
+	if post.ID == "" {
+		return apperror.NotFound("Deleted post not found")
+	}
+
+	allowed, privileged := s.canRestore(userID, post.UserID, post.DeletedByID, PermissionDeleteAnyPost)
+	if !allowed {
+		return apperror.Forbidden("You do not have permission to restore this post")
+	}
+	if time.Now().After(s.restoreDeadline(post.DeletedAt)) {
+		return apperror.Gone("This post can no longer be restored")
+	}
+
+	if err := s.db.Unscoped().Model(&models.Post{}).Where("id = ?", post.ID).Updates(map[string]interface{}{
+		"deleted_at":    nil,
+		"deleted_by_id": nil,
+	}).Error; err != nil {
+		return apperror.Internal("Failed to restore post", err)
+	}
+
+	s.events.Broadcast(fiber.Map{
+		"type": "POST_RESTORED",
+		"data": fiber.Map{"id": post.ID},
+	})
+
+	if privileged {
+		RecordModerationAction(ctx, s.db, userID, "post.restored", "post", post.ID, fiber.Map{"ownerId": post.UserID, "reason": ctx.Query("reason")})
+	}
+
+	return ctx.JSON(fiber.Map{"message": "Post restored"})
+}
+
+func (s *Server) HandleRestoreComment(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	comment := models.Comment{}
+	if err := s.db.Unscoped().Where("id = ? AND post_id = ? AND deleted_at IS NOT NULL", ctx.Params("commentId"), ctx.Params("postId")).Limit(1).Find(&comment).Error; err != nil {
+		return apperror.Internal("Failed to retrieve comment", err)
+	}
+	if comment.ID == "" {
+		return apperror.NotFound("Deleted comment not found")
+	}
+
+	allowed, privileged := s.canRestore(userID, comment.UserID, comment.DeletedByID, PermissionDeleteAnyComment)
+	if !allowed {
+		return apperror.Forbidden("You do not have permission to restore this comment")
+	}
+	if time.Now().After(s.restoreDeadline(comment.DeletedAt)) {
+		return apperror.Gone("This comment can no longer be restored")
+	}
+
+	if err := s.db.Unscoped().Model(&models.Comment{}).Where("id = ?", comment.ID).Updates(map[string]interface{}{
+		"deleted_at":    nil,
+		"deleted_by_id": nil,
+	}).Error; err != nil {
+		return apperror.Internal("Failed to restore comment", err)
+	}
+
+	s.events.Broadcast(fiber.Map{
+		"type": "COMMENT_RESTORED",
+		"data": fiber.Map{"postId": comment.PostID, "commentId": comment.ID},
+	})
+
+	if privileged {
+		RecordModerationAction(ctx, s.db, userID, "comment.restored", "comment", comment.ID, fiber.Map{"ownerId": comment.UserID, "postId": comment.PostID, "reason": ctx.Query("reason")})
+	}
+
+	return ctx.JSON(fiber.Map{"message": "Comment restored"})
+}
+
+// softDeleteUser deletes the account together with its posts and comments
+// using one timestamp, so that restoring the account brings back exactly what
+// was removed with it.
+func softDeleteUser(db *gorm.DB, userID string) error {
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&models.Post{}, &models.Comment{}} {
+			if err := tx.Model(model).Where("user_id = ?", userID).UpdateColumns(map[string]interface{}{
+				"deleted_at":    now,
+				"deleted_by_id": userID,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&models.Session{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.APIToken{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).Where("id = ?", userID).UpdateColumn("deleted_at", now).Error
+	})
+}
+
+// restoreDeletedUser undoes softDeleteUser and cancels any pending account
+// deletion.
+func restoreDeletedUser(db *gorm.DB, user models.User) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&models.Post{}, &models.Comment{}} {
+			if err := tx.Unscoped().Model(model).Where("user_id = ? AND deleted_by_id = ? AND deleted_at = ?", user.ID, user.ID, user.DeletedAt.Time).UpdateColumns(map[string]interface{}{
+				"deleted_at":    nil,
+				"deleted_by_id": nil,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.AccountDeletion{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Model(&models.User{}).Where("id = ?", user.ID).UpdateColumn("deleted_at", nil).Error
+	})
+}
+
+func (s *Server) HandleAdminRestoreUser(ctx *fiber.Ctx) error {
+	user := models.User{}
+	if err := s.db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", ctx.Params("id")).Limit(1).Find(&user).Error; err != nil {
+		return apperror.Internal("Failed to retrieve user", err)
+	}
+	if user.ID == "" {
+		return apperror.NotFound("Deleted user not found")
+	}
+
+	if err := restoreDeletedUser(s.db, user); err != nil {
+		return apperror.Internal("Failed to restore user", err)
+	}
+
+	RecordModerationAction(ctx, s.db, currentUserID(ctx), "user.restored", "user", user.ID, fiber.Map{"email": user.Email})
+
+	return ctx.JSON(fiber.Map{"message": "User restored"})
+}
@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"blog_post/apperror"
+	"blog_post/db_aws"
+	"blog_post/models"
+	"blog_post/totp"
+
+	"crypto/rand"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	twoFactorChallengeTTL = 5 * time.Minute
+	maxTwoFactorAttempts  = 5
+	recoveryCodeCount     = 10
+	recoveryCodeLength    = 10
+	recoveryCodeAlphabet  = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+func createTwoFactorChallenge(db *gorm.DB, userID string) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	challenge := models.TwoFactorChallenge{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpireAt:  time.Now().Add(twoFactorChallengeTTL),
+	}
+	if err := db.Omit("User").Create(&challenge).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func generateRecoveryCode() (string, error) {
+	code := make([]byte, recoveryCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = recoveryCodeAlphabet[n.Int64()]
+	}
+	return string(code[:5]) + "-" + string(code[5:]), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// regenerateRecoveryCodes replaces every recovery code of the user and returns
+// the new plain codes, which are only ever shown once.
+func regenerateRecoveryCodes(db *gorm.DB, userID string) ([]string, error) {
+	codes := []string{}
+	rows := []models.RecoveryCode{}
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		rows = append(rows, models.RecoveryCode{UserID: userID, CodeHash: hashToken(normalizeRecoveryCode(code))})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Omit("User").Create(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func useRecoveryCode(db *gorm.DB, userID string, code string) bool {
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+func verifyTOTP(db *gorm.DB, user *models.User, code string) bool {
+	step, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok || step <= user.TOTPLastStep {
+		return false
+	}
+
+	result := db.Model(&models.User{}).Where("id = ? AND totp_last_step < ?", user.ID, step).Update("totp_last_step", step)
+	if result.Error != nil || result.RowsAffected != 1 {
+		return false
+	}
+
+	user.TOTPLastStep = step
+	return true
+}
+
+func (s *Server) HandleTwoFactorSignIn(ctx *fiber.Ctx) error {
+	var body struct {
+		ChallengeToken string `json:"challengeToken" validate:"trim,required"`
+		Code           string `json:"code" validate:"trim"`
+		RecoveryCode   string `json:"recoveryCode" validate:"trim"`
+	}
+
+	if err := parseBody(ctx, &body); err != nil {
+		return err
+	}
+	if body.Code == "" && body.RecoveryCode == "" {
+		return apperror.InvalidField("code", "code or recoveryCode is required")
+	}
+
+	challenge := models.TwoFactorChallenge{}
+	if err := s.db.Where("token_hash = ?", hashToken(body.ChallengeToken)).Limit(1).Find(&challenge).Error; err != nil {
+		return apperror.Internal("Failed to retrieve challenge", err)
+	}
+
+	expired := apperror.Unauthorized("Sign-in expired, please sign in again").WithCode(apperror.CodeSessionExpired)
+	if challenge.ID == "" || time.Now().After(challenge.ExpireAt) {
+		if challenge.ID != "" {
+			s.db.Delete(&challenge)
+		}
+		return expired
+	}
+
+	// The attempt is taken before the code is checked, in one statement, so
+	// guesses sent in parallel cannot all pass the limit.
+	result := s.db.Model(&models.TwoFactorChallenge{}).
+		Where("id = ? AND attempts < ?", challenge.ID, maxTwoFactorAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return apperror.Internal("Failed to record attempt", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		s.db.Delete(&challenge)
+		return expired
+	}
+
+	user := models.User{}
+	if err := s.db.Where("id = ?", challenge.UserID).Find(&user).Error; err != nil || user.ID == "" {
+		return apperror.Internal("Failed to retrieve user", err)
+	}
+
+	// Failed codes count toward the lockout, which also ends challenges
+	// already handed out.
+	if lockedFor(user) > 0 {
+		s.db.Delete(&challenge)
+		return expired
+	}
+
+	verified := false
+	if body.Code != "" {
+		verified = verifyTOTP(s.db, &user, body.Code)
+	} else {
+		verified = useRecoveryCode(s.db, user.ID, body.RecoveryCode)
+	}
+
+	if !verified {
+		if err := registerFailedLogin(s.db, &user); err != nil {
+			log.Println("Failed to record failed sign-in:", err)
+		}
+		log.Printf("Two-factor sign-in failed for user %s", user.ID)
+		RecordAudit(ctx, s.db, "", AuditTwoFactorFailed, "user", user.ID, fiber.Map{"recoveryCode": body.Code == "", "failedLogins": user.FailedLogins})
+		if lockedFor(user) > 0 {
+			RecordAudit(ctx, s.db, "", AuditAccountLocked, "user", user.ID, fiber.Map{"lockedUntil": user.LockedUntil})
+		}
+		return apperror.Unauthorized("Invalid authentication code")
+	}
+
+	if err := s.db.Delete(&challenge).Error; err != nil {
+		return apperror.Internal("Failed to complete sign-in", err)
+	}
+
+	return s.completeSignIn(ctx, user)
+}
+
+func (s *Server) HandleTwoFactorEnroll(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	user := models.User{}
+	if err := s.db.Where("id = ?", userID).Find(&user).Error; err != nil || user.ID == "" {
+		return apperror.Internal("Failed to retrieve user", err)
+	}
+
+	if user.TOTPEnabled {
+		return apperror.Conflict("Two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return apperror.Internal("Failed to generate secret", err)
+	}
+
+	if err := s.db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		return apperror.Internal("Failed to start enrollment", err)
+	}
+
+	return ctx.JSON(fiber.Map{
+		"secret":     secret,
+		"otpauthUri": totp.URI(secret, s.config.TOTPIssuer, user.Email),
+	})
+}
+
+func (s *Server) HandleTwoFactorConfirm(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	var body struct {
+		Code string `json:"code" validate:"trim,required"`
+	}
+
+	if err := parseBody(ctx, &body); err != nil {
+		return err
+	}
+
+	user := models.User{}
+	if err := s.db.Where("id = ?", userID).Find(&user).Error; err != nil || user.ID == "" {
+		return apperror.Internal("Failed to retrieve user", err)
+	}
+
+	if user.TOTPEnabled {
+		return apperror.Conflict("Two-factor authentication is already enabled")
+	}
+
+	if user.TOTPSecret == "" {
+		return apperror.Conflict("Start enrollment first")
+	}
+
+	if !verifyTOTP(s.db, &user, body.Code) {
+		return apperror.BadRequest("Invalid authentication code")
+	}
+
+	if err := s.db.Model(&models.User{}).Where("id = ?", user.ID).Update("totp_enabled", true).Error; err != nil {
+		return apperror.Internal("Failed to enable two-factor authentication", err)
+	}
+
+	codes, err := regenerateRecoveryCodes(s.db, user.ID)
+	if err != nil {
+		return apperror.Internal("Failed to generate recovery codes", err)
+	}
+
+	RecordAudit(ctx, s.db, user.ID, AuditTwoFactorEnabled, "user", user.ID, nil)
+
+	return ctx.JSON(fiber.Map{
+		"message":       "Two-factor authentication enabled",
+		"recoveryCodes": codes,
+	})
+}
+
+func requirePasswordAndTwoFactor(db *gorm.DB, userID string, password string) (models.User, error) {
+	user := models.User{}
+	if err := db.Where("id = ?", userID).Find(&user).Error; err != nil || user.ID == "" {
+		return user, apperror.Internal("Failed to retrieve user", err)
+	}
+
+	if err := db_aws.VerifyPassword(password, user.HashPassword); err != nil {
+		return user, apperror.Unauthorized("Invalid password")
+	}
+
+	if !user.TOTPEnabled {
+		return user, apperror.Conflict("Two-factor authentication is not enabled")
+	}
+
+	return user, nil
+}
+
+func (s *Server) HandleTwoFactorDisable(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	var body struct {
+		Password string `json:"password" validate:"required"`
+	}
+
+	if err := parseBody(ctx, &body); err != nil {
+		return err
+	}
+
+	user, err := requirePasswordAndTwoFactor(s.db, userID, body.Password)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.TwoFactorChallenge{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		return apperror.Internal("Failed to disable two-factor authentication", err)
+	}
+
+	RecordAudit(ctx, s.db, user.ID, AuditTwoFactorDisabled, "user", user.ID, nil)
+
+	return ctx.JSON(fiber.Map{"message": "Two-factor authentication disabled"})
+}
+
+func (s *Server) HandleRegenerateRecoveryCodes(ctx *fiber.Ctx) error {
+	userID := currentUserID(ctx)
+	if userID == "" {
+		return apperror.Unauthorized("User not authenticated")
+	}
+
+	var body struct {
+		Password string `json:"password" validate:"required"`
+	}
+
+	if err := parseBody(ctx, &body); err != nil {
+		return err
+	}
+
+	user, err := requirePasswordAndTwoFactor(s.db, userID, body.Password)
+	if err != nil {
+		return err
+	}
+
+	codes, err := regenerateRecoveryCodes(s.db, user.ID)
+	if err != nil {
+		return apperror.Internal("Failed to generate recovery codes", err)
+	}
+
+	RecordAudit(ctx, s.db, user.ID, AuditRecoveryCodesRegenerate, "user", user.ID, nil)
+
+	return ctx.JSON(fiber.Map{"recoveryCodes": codes})
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"blog_post/models"
+	"blog_post/totp"
+)
+
+func TestVerifyTOTPRejectsUsedSteps(t *testing.T) {
+	db := newDryRunDB(t)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := totp.Step(time.Now())
+	code, err := totp.CodeAt(secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A code from the step already accepted, or from an earlier one still in
+	// the window, is refused before the database is asked.
+	for _, lastStep := range []int64{step, step + 1} {
+		user := models.User{ID: "user", TOTPSecret: secret, TOTPLastStep: lastStep}
+		if verifyTOTP(db, &user, code) {
+			t.Errorf("code for step %d accepted after step %d", step, lastStep)
+		}
+		if user.TOTPLastStep != lastStep {
+			t.Errorf("last step moved to %d", user.TOTPLastStep)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"blog_post/config"
+
+	"github.com/google/uuid"
+	gomail "gopkg.in/gomail.v2"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string
+}
+
+type Mailer interface {
+	Send(msg Message) error
+}
+
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	email := gomail.NewMessage()
+	email.SetHeader("From", m.From)
+	email.SetHeader("To", msg.To)
+	email.SetHeader("Subject", msg.Subject)
+	for key, value := range msg.Headers {
+		email.SetHeader(key, value)
+	}
+
+	email.SetBody("text/plain", msg.Text)
+	if msg.HTML != "" {
+		email.AddAlternative("text/html", msg.HTML)
+	}
+
+	dialer := gomail.NewDialer(m.Host, m.Port, m.Username, m.Password)
+	if err := dialer.DialAndSend(email); err != nil {
+		return fmt.Errorf("failed to send email to %s: %v", msg.To, err)
+	}
+
+	return nil
+}
+
+// OutboxMailer never talks to a mail server. Messages are written as files to
+// Dir, or only logged when Dir is empty, which is what local development and
+// tests want.
+type OutboxMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *OutboxMailer) Send(msg Message) error {
+	if m.Dir == "" {
+		log.Printf("Outbox email to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create outbox directory: %v", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+
+	keys := make([]string, 0, len(msg.Headers))
+	for key := range msg.Headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s: %s\r\n", key, msg.Headers[key])
+	}
+
+	fmt.Fprintf(&b, "\r\n%s\r\n", msg.Text)
+	if msg.HTML != "" {
+		fmt.Fprintf(&b, "\r\n--- text/html ---\r\n%s\r\n", msg.HTML)
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405"), uuid.New().String()[:8])
+	if err := os.WriteFile(filepath.Join(m.Dir, name), []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("failed to write outbox email: %v", err)
+	}
+
+	return nil
+}
+
+func New(cfg config.Mail) (Mailer, error) {
+	switch cfg.Transport {
+	case "", "smtp":
+		return &SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}, nil
+	case "outbox":
+		return &OutboxMailer{Dir: cfg.OutboxDir, From: cfg.From}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_TRANSPORT %q", cfg.Transport)
+	}
+}
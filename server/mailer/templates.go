@@ -0,0 +1,40 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+//go:embed templates/*
+var templateFS embed.FS
+
+var (
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html"))
+)
+
+func Render(name string, data interface{}) (string, string, error) {
+	var text bytes.Buffer
+	if err := textTemplates.ExecuteTemplate(&text, name+".txt", data); err != nil {
+		return "", "", fmt.Errorf("failed to render %s text template: %v", name, err)
+	}
+
+	var html bytes.Buffer
+	if err := htmlTemplates.ExecuteTemplate(&html, name+".html", data); err != nil {
+		return "", "", fmt.Errorf("failed to render %s html template: %v", name, err)
+	}
+
+	return text.String(), html.String(), nil
+}
+
+func NewMessage(to string, subject string, name string, data interface{}) (Message, error) {
+	text, html, err := Render(name, data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	return Message{To: to, Subject: subject, Text: text, HTML: html}, nil
+}
@@ -0,0 +1,24 @@
+DROP TABLE IF EXISTS "data_exports";
+DROP TABLE IF EXISTS "account_deletions";
+DROP TABLE IF EXISTS "audit_events";
+DROP TABLE IF EXISTS "warnings";
+DROP TABLE IF EXISTS "reports";
+DROP TABLE IF EXISTS "moderation_actions";
+DROP TABLE IF EXISTS "api_tokens";
+DROP TABLE IF EXISTS "o_id_c_states";
+DROP TABLE IF EXISTS "identities";
+DROP TABLE IF EXISTS "sessions";
+DROP TABLE IF EXISTS "two_factor_challenges";
+DROP TABLE IF EXISTS "recovery_codes";
+DROP TABLE IF EXISTS "email_verifications";
+DROP TABLE IF EXISTS "email_preferences";
+DROP TABLE IF EXISTS "notification_actors";
+DROP TABLE IF EXISTS "notifications";
+DROP TABLE IF EXISTS "codes";
+DROP TABLE IF EXISTS "comment_likes";
+DROP TABLE IF EXISTS "post_likes";
+DROP TABLE IF EXISTS "post_tags";
+DROP TABLE IF EXISTS "tags";
+DROP TABLE IF EXISTS "comments";
+DROP TABLE IF EXISTS "posts";
+DROP TABLE IF EXISTS "users";
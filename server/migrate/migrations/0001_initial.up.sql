@@ -0,0 +1,333 @@
+-- Baseline schema. Every statement is guarded with IF NOT EXISTS so that it
+-- runs on databases created by AutoMigrate, which already have the users,
+-- posts, comments, likes, tags and codes tables. Those tables keep their old
+-- columns here; 0003 brings them up to this schema.
+
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+CREATE TABLE IF NOT EXISTS "users" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "first_name" varchar(100) NOT NULL,
+    "last_name" varchar(100) NOT NULL,
+    "email" varchar(100) NOT NULL,
+    "hash_password" varchar(255) NOT NULL,
+    "email_verified" boolean NOT NULL DEFAULT false,
+    "failed_logins" bigint NOT NULL DEFAULT 0,
+    "locked_until" timestamptz,
+    "totp_secret" text,
+    "totp_enabled" boolean NOT NULL DEFAULT false,
+    "totp_last_step" bigint NOT NULL DEFAULT 0,
+    "role" varchar(20) NOT NULL DEFAULT 'user',
+    "deleted_at" timestamptz,
+    "image" text,
+    "image_key" text,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "uni_users_email" UNIQUE ("email")
+);
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "posts" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "title" varchar(255) NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    "updated_at" timestamptz NOT NULL DEFAULT now(),
+    "body" text NOT NULL,
+    "user_id" uuid NOT NULL,
+    "image" text,
+    "image_key" text,
+    "hidden" boolean NOT NULL DEFAULT false,
+    "deleted_at" timestamptz,
+    "deleted_by_id" uuid,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_users_posts" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_posts_deleted_at" ON "posts" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_posts_hidden" ON "posts" ("hidden");
+CREATE INDEX IF NOT EXISTS "idx_posts_user_id" ON "posts" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "comments" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "message" text NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    "updated_at" timestamptz NOT NULL DEFAULT now(),
+    "user_id" uuid NOT NULL,
+    "post_id" uuid NOT NULL,
+    "hidden" boolean NOT NULL DEFAULT false,
+    "deleted_at" timestamptz,
+    "deleted_by_id" uuid,
+    "parent_id" uuid,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_users_comments" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_posts_comments" FOREIGN KEY ("post_id") REFERENCES "posts"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_comments_children" FOREIGN KEY ("parent_id") REFERENCES "comments"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_comments_parent_id" ON "comments" ("parent_id");
+CREATE INDEX IF NOT EXISTS "idx_comments_deleted_at" ON "comments" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_comments_post_id" ON "comments" ("post_id");
+CREATE INDEX IF NOT EXISTS "idx_comments_user_id" ON "comments" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "tags" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "name" varchar(255) NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "uni_tags_name" UNIQUE ("name")
+);
+
+CREATE TABLE IF NOT EXISTS "post_tags" (
+    "post_id" uuid,
+    "tag_id" uuid,
+    PRIMARY KEY ("post_id","tag_id"),
+    CONSTRAINT "fk_post_tags_post" FOREIGN KEY ("post_id") REFERENCES "posts"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_post_tags_tag" FOREIGN KEY ("tag_id") REFERENCES "tags"("id") ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS "post_likes" (
+    "user_id" uuid,
+    "post_id" uuid,
+    PRIMARY KEY ("user_id","post_id"),
+    CONSTRAINT "fk_posts_likes" FOREIGN KEY ("post_id") REFERENCES "posts"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_users_post_likes" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS "comment_likes" (
+    "user_id" uuid,
+    "comment_id" uuid,
+    PRIMARY KEY ("user_id","comment_id"),
+    CONSTRAINT "fk_comments_likes" FOREIGN KEY ("comment_id") REFERENCES "comments"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_users_comment_likes" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS "codes" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid NOT NULL,
+    "code" text NOT NULL,
+    "attempts" bigint NOT NULL DEFAULT 0,
+    "expire_at" timestamptz NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_codes_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_codes_user_id" ON "codes" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "notifications" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid NOT NULL,
+    "type" varchar(50) NOT NULL,
+    "post_id" uuid NOT NULL,
+    "comment_id" uuid,
+    "read" boolean NOT NULL DEFAULT false,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    "updated_at" timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_notifications_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_notifications_post" FOREIGN KEY ("post_id") REFERENCES "posts"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_notifications_comment" FOREIGN KEY ("comment_id") REFERENCES "comments"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_notifications_user_id" ON "notifications" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_notifications_read" ON "notifications" ("read");
+CREATE INDEX IF NOT EXISTS "idx_notifications_comment_id" ON "notifications" ("comment_id");
+CREATE INDEX IF NOT EXISTS "idx_notifications_post_id" ON "notifications" ("post_id");
+
+CREATE TABLE IF NOT EXISTS "notification_actors" (
+    "notification_id" uuid,
+    "user_id" uuid,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY ("notification_id","user_id"),
+    CONSTRAINT "fk_notification_actors_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_notifications_actors" FOREIGN KEY ("notification_id") REFERENCES "notifications"("id") ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS "email_preferences" (
+    "user_id" uuid,
+    "digest" varchar(20) NOT NULL DEFAULT 'weekly',
+    "last_digest_at" timestamptz,
+    "unsubscribe_token" varchar(64) NOT NULL,
+    PRIMARY KEY ("user_id"),
+    CONSTRAINT "fk_email_preferences_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_email_preferences_unsubscribe_token" ON "email_preferences" ("unsubscribe_token");
+
+CREATE TABLE IF NOT EXISTS "email_verifications" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid NOT NULL,
+    "email" varchar(100) NOT NULL,
+    "token_hash" varchar(64) NOT NULL,
+    "expire_at" timestamptz NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_email_verifications_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_email_verifications_token_hash" ON "email_verifications" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_email_verifications_user_id" ON "email_verifications" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "recovery_codes" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid NOT NULL,
+    "code_hash" varchar(64) NOT NULL,
+    "used_at" timestamptz,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_recovery_codes_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_recovery_codes_user_id" ON "recovery_codes" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "two_factor_challenges" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid NOT NULL,
+    "token_hash" varchar(64) NOT NULL,
+    "attempts" bigint NOT NULL DEFAULT 0,
+    "expire_at" timestamptz NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_two_factor_challenges_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_two_factor_challenges_token_hash" ON "two_factor_challenges" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_two_factor_challenges_user_id" ON "two_factor_challenges" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "sessions" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid NOT NULL,
+    "token_hash" varchar(64) NOT NULL,
+    "user_agent" text,
+    "ip" varchar(64),
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    "last_seen_at" timestamptz NOT NULL DEFAULT now(),
+    "expires_at" timestamptz NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_sessions_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_sessions_expires_at" ON "sessions" ("expires_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_sessions_token_hash" ON "sessions" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_sessions_user_id" ON "sessions" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "identities" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid NOT NULL,
+    "provider" varchar(50) NOT NULL,
+    "subject" varchar(255) NOT NULL,
+    "email" varchar(100),
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_identities_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_identities_provider_subject" ON "identities" ("provider","subject");
+CREATE INDEX IF NOT EXISTS "idx_identities_user_id" ON "identities" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "o_id_c_states" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "state_hash" varchar(64) NOT NULL,
+    "provider" varchar(50) NOT NULL,
+    "nonce" varchar(100) NOT NULL,
+    "code_verifier" varchar(128) NOT NULL,
+    "link_user_id" uuid,
+    "expire_at" timestamptz NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_o_id_c_states_state_hash" ON "o_id_c_states" ("state_hash");
+
+CREATE TABLE IF NOT EXISTS "api_tokens" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid NOT NULL,
+    "name" varchar(100) NOT NULL,
+    "prefix" varchar(16) NOT NULL,
+    "token_hash" varchar(64) NOT NULL,
+    "scopes" varchar(255) NOT NULL,
+    "expires_at" timestamptz NOT NULL,
+    "last_used_at" timestamptz,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_api_tokens_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_api_tokens_token_hash" ON "api_tokens" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_api_tokens_user_id" ON "api_tokens" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "moderation_actions" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "actor_id" uuid NOT NULL,
+    "action" varchar(50) NOT NULL,
+    "target_type" varchar(50) NOT NULL,
+    "target_id" varchar(100) NOT NULL,
+    "details" text,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_moderation_actions_actor" FOREIGN KEY ("actor_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_moderation_actions_target_id" ON "moderation_actions" ("target_id");
+CREATE INDEX IF NOT EXISTS "idx_moderation_actions_action" ON "moderation_actions" ("action");
+CREATE INDEX IF NOT EXISTS "idx_moderation_actions_actor_id" ON "moderation_actions" ("actor_id");
+CREATE INDEX IF NOT EXISTS "idx_moderation_actions_created_at" ON "moderation_actions" ("created_at");
+
+CREATE TABLE IF NOT EXISTS "reports" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "reporter_id" uuid NOT NULL,
+    "target_type" varchar(20) NOT NULL,
+    "target_id" uuid NOT NULL,
+    "post_id" uuid NOT NULL,
+    "reason" varchar(50) NOT NULL,
+    "details" text,
+    "status" varchar(20) NOT NULL DEFAULT 'open',
+    "resolved_by_id" uuid,
+    "resolved_at" timestamptz,
+    "resolution" varchar(20),
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_reports_reporter" FOREIGN KEY ("reporter_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_reports_created_at" ON "reports" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_reports_status" ON "reports" ("status");
+CREATE INDEX IF NOT EXISTS "idx_reports_post_id" ON "reports" ("post_id");
+CREATE INDEX IF NOT EXISTS "idx_reports_target" ON "reports" ("target_type","target_id");
+CREATE INDEX IF NOT EXISTS "idx_reports_reporter_id" ON "reports" ("reporter_id");
+
+CREATE TABLE IF NOT EXISTS "warnings" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid NOT NULL,
+    "issued_by_id" uuid NOT NULL,
+    "report_id" uuid,
+    "reason" text,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_warnings_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_warnings_user_id" ON "warnings" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "audit_events" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "actor_id" uuid,
+    "action" varchar(64) NOT NULL,
+    "target_type" varchar(50),
+    "target_id" varchar(100),
+    "ip" varchar(64),
+    "user_agent" text,
+    "metadata" text,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_audit_events_created_at" ON "audit_events" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_audit_events_target_id" ON "audit_events" ("target_id");
+CREATE INDEX IF NOT EXISTS "idx_audit_events_action" ON "audit_events" ("action");
+CREATE INDEX IF NOT EXISTS "idx_audit_events_actor_id" ON "audit_events" ("actor_id");
+
+CREATE TABLE IF NOT EXISTS "account_deletions" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid NOT NULL,
+    "token_hash" varchar(64) NOT NULL,
+    "requested_at" timestamptz NOT NULL DEFAULT now(),
+    "scheduled_for" timestamptz NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_account_deletions_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_account_deletions_user_id" ON "account_deletions" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_account_deletions_scheduled_for" ON "account_deletions" ("scheduled_for");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_account_deletions_token_hash" ON "account_deletions" ("token_hash");
+
+CREATE TABLE IF NOT EXISTS "data_exports" (
+    "id" uuid DEFAULT uuid_generate_v4(),
+    "user_id" uuid NOT NULL,
+    "status" varchar(20) NOT NULL DEFAULT 'pending',
+    "object_key" text,
+    "requested_at" timestamptz NOT NULL DEFAULT now(),
+    "completed_at" timestamptz,
+    "expires_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_data_exports_user" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_data_exports_user_id" ON "data_exports" ("user_id");
+CREATE INDEX IF NOT EXISTS "idx_data_exports_expires_at" ON "data_exports" ("expires_at");
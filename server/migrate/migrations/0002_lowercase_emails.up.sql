@@ -0,0 +1,11 @@
+-- Emails are now trimmed and lowercased on the way in, so stored ones must
+-- match. Addresses that would collide with another account once lowercased
+-- are left alone for an administrator to merge.
+
+UPDATE "users" AS u
+SET "email" = lower(trim(u."email"))
+WHERE u."email" <> lower(trim(u."email"))
+  AND NOT EXISTS (
+    SELECT 1 FROM "users" AS other
+    WHERE other."id" <> u."id" AND lower(trim(other."email")) = lower(trim(u."email"))
+  );
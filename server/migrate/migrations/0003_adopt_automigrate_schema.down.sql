@@ -0,0 +1,3 @@
+-- The columns are part of the 0001 schema, so they stay until 0001 is
+-- reverted.
+SELECT 1;
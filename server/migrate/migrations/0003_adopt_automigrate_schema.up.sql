@@ -0,0 +1,40 @@
+-- Databases created by AutoMigrate before versioned migrations keep the
+-- original users, posts, comments and codes tables through 0001, without the
+-- columns added since. This adds them, and the indexes on them, as 0001
+-- defines them; on databases 0001 created, every statement is a no-op. The
+-- foreign keys AutoMigrate created already have the names 0001 uses.
+
+ALTER TABLE "users"
+    ALTER COLUMN "hash_password" TYPE varchar(255),
+    ADD COLUMN IF NOT EXISTS "email_verified" boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS "failed_logins" bigint NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS "locked_until" timestamptz,
+    ADD COLUMN IF NOT EXISTS "totp_secret" text,
+    ADD COLUMN IF NOT EXISTS "totp_enabled" boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS "totp_last_step" bigint NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS "role" varchar(20) NOT NULL DEFAULT 'user',
+    ADD COLUMN IF NOT EXISTS "deleted_at" timestamptz,
+    ADD COLUMN IF NOT EXISTS "image_key" text;
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+ALTER TABLE "posts"
+    ADD COLUMN IF NOT EXISTS "image_key" text,
+    ADD COLUMN IF NOT EXISTS "hidden" boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS "deleted_at" timestamptz,
+    ADD COLUMN IF NOT EXISTS "deleted_by_id" uuid;
+CREATE INDEX IF NOT EXISTS "idx_posts_deleted_at" ON "posts" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_posts_hidden" ON "posts" ("hidden");
+CREATE INDEX IF NOT EXISTS "idx_posts_user_id" ON "posts" ("user_id");
+
+ALTER TABLE "comments"
+    ADD COLUMN IF NOT EXISTS "hidden" boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS "deleted_at" timestamptz,
+    ADD COLUMN IF NOT EXISTS "deleted_by_id" uuid;
+CREATE INDEX IF NOT EXISTS "idx_comments_parent_id" ON "comments" ("parent_id");
+CREATE INDEX IF NOT EXISTS "idx_comments_deleted_at" ON "comments" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_comments_post_id" ON "comments" ("post_id");
+CREATE INDEX IF NOT EXISTS "idx_comments_user_id" ON "comments" ("user_id");
+
+ALTER TABLE "codes"
+    ADD COLUMN IF NOT EXISTS "attempts" bigint NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS "idx_codes_user_id" ON "codes" ("user_id");
@@ -0,0 +1,3 @@
+-- Which accounts were verified by the up migration is not recorded, so there
+-- is nothing to undo.
+SELECT 1;
@@ -0,0 +1,12 @@
+-- Accounts created before email verification existed got email_verified =
+-- false when the column was added, which keeps them from posting and from
+-- receiving digests. Every sign-up since then gets an email_verifications
+-- row that is only removed once the address is verified, so unverified
+-- accounts without one predate verification and are trusted as they were.
+
+UPDATE "users"
+SET "email_verified" = true
+WHERE "email_verified" = false
+  AND NOT EXISTS (
+    SELECT 1 FROM "email_verifications" WHERE "email_verifications"."user_id" = "users"."id"
+  );
@@ -0,0 +1,13 @@
+-- The model hooks only stop changes made through GORM. This refuses them in
+-- the database too, for raw SQL, sessions that skip hooks and psql alike.
+-- TRUNCATE is left to the seeder, which resets every table.
+
+CREATE FUNCTION "audit_events_append_only"() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit events cannot be changed or deleted';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "audit_events_append_only"
+    BEFORE UPDATE OR DELETE ON "audit_events"
+    FOR EACH ROW EXECUTE FUNCTION "audit_events_append_only"();
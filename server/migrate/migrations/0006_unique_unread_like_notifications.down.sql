@@ -0,0 +1,2 @@
+-- Merged notifications are not split up again.
+DROP INDEX IF EXISTS "idx_notifications_unread_likes";
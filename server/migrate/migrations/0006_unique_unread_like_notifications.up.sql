@@ -0,0 +1,34 @@
+-- Likes on the same target collapse into one unread notification. Concurrent
+-- likes could each insert one, so existing duplicates are merged into the
+-- latest one before a unique index makes the database enforce it. Post likes
+-- have no comment, and NULLs never collide in a unique index, hence the
+-- coalesce.
+
+INSERT INTO "notification_actors" ("notification_id", "user_id", "created_at")
+SELECT ranked."keeper", actors."user_id", actors."created_at"
+FROM (
+    SELECT "id", first_value("id") OVER (
+        PARTITION BY "user_id", "type", "post_id", "comment_id" ORDER BY "updated_at" DESC, "id"
+    ) AS "keeper"
+    FROM "notifications"
+    WHERE NOT "read" AND "type" IN ('POST_LIKE', 'COMMENT_LIKE')
+) AS ranked
+JOIN "notification_actors" AS actors ON actors."notification_id" = ranked."id"
+WHERE ranked."id" <> ranked."keeper"
+ON CONFLICT DO NOTHING;
+
+DELETE FROM "notifications"
+WHERE "id" IN (
+    SELECT "id" FROM (
+        SELECT "id", row_number() OVER (
+            PARTITION BY "user_id", "type", "post_id", "comment_id" ORDER BY "updated_at" DESC, "id"
+        ) AS "position"
+        FROM "notifications"
+        WHERE NOT "read" AND "type" IN ('POST_LIKE', 'COMMENT_LIKE')
+    ) AS ranked
+    WHERE ranked."position" > 1
+);
+
+CREATE UNIQUE INDEX "idx_notifications_unread_likes"
+    ON "notifications" ("user_id", "type", "post_id", (coalesce("comment_id", '00000000-0000-0000-0000-000000000000')))
+    WHERE NOT "read" AND "type" IN ('POST_LIKE', 'COMMENT_LIKE');
@@ -0,0 +1,5 @@
+DELETE FROM "moderation_actions" WHERE "actor_id" IS NULL;
+ALTER TABLE "moderation_actions" DROP CONSTRAINT IF EXISTS "fk_moderation_actions_actor";
+ALTER TABLE "moderation_actions"
+    ADD CONSTRAINT "fk_moderation_actions_actor" FOREIGN KEY ("actor_id") REFERENCES "users"("id") ON DELETE CASCADE;
+ALTER TABLE "moderation_actions" ALTER COLUMN "actor_id" SET NOT NULL;
@@ -0,0 +1,8 @@
+-- Purging a moderator's account deleted every moderation action they took.
+-- Like the audit trail, the log now outlives the account and loses only the
+-- link to it.
+
+ALTER TABLE "moderation_actions" ALTER COLUMN "actor_id" DROP NOT NULL;
+ALTER TABLE "moderation_actions" DROP CONSTRAINT IF EXISTS "fk_moderation_actions_actor";
+ALTER TABLE "moderation_actions"
+    ADD CONSTRAINT "fk_moderation_actions_actor" FOREIGN KEY ("actor_id") REFERENCES "users"("id") ON DELETE SET NULL;
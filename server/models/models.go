@@ -1,7 +1,11 @@
 package models
 
 import (
+	"errors"
+	"fmt"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type Tag struct {
@@ -36,48 +40,308 @@ type Code struct {
 	UserID   string    `gorm:"not null;type:uuid;index" json:"user_id"`
 	User     User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"user"`
 	Code     string    `gorm:"not null;type:text" json:"code"`
+	Attempts int       `gorm:"not null;default:0" json:"attempts"`
 	ExpireAt time.Time `gorm:"not null" json:"expire_at"`
 }
 
-type User struct {
-	ID           string        `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
-	FirstName    string        `gorm:"not null;size:100" json:"first_name"`
-	LastName     string        `gorm:"not null;size:100" json:"last_name"`
-	Email        string        `gorm:"not null;size:100;unique" json:"email"`
-	HashPassword string        `gorm:"not null;size:100" json:"hash_password"`
-	Image        string        `gorm:"type:text" json:"image"`
-	Comments     []Comment     `gorm:"constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"comments"`
-	Posts        []Post        `gorm:"constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"posts"`
-	PostLikes    []PostLike    `gorm:"constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"post_likes"`
-	CommentLikes []CommentLike `gorm:"constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"comment_likes"`
+type EmailVerification struct {
+	ID        string    `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	UserID    string    `gorm:"not null;type:uuid;index" json:"user_id"`
+	User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"user"`
+	Email     string    `gorm:"not null;size:100" json:"email"`
+	TokenHash string    `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	ExpireAt  time.Time `gorm:"not null" json:"expire_at"`
 }
 
-type Post struct {
+type RecoveryCode struct {
 	ID        string     `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
-	Title     string     `gorm:"not null;size:255" json:"title"`
-	CreatedAt time.Time  `gorm:"not null;default:now()" json:"created_at"`
-	UpdatedAt time.Time  `gorm:"not null;default:now();autoUpdateTime" json:"updated_at"`
-	Body      string     `gorm:"not null;type:text" json:"body"`
 	UserID    string     `gorm:"not null;type:uuid;index" json:"user_id"`
 	User      User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"user"`
-	Image     string     `gorm:"type:text" json:"image"`
-	ImageKey  string     `gorm:"type:text" json:"image_key"`
-	Comments  []Comment  `gorm:"constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"comments"`
-	Likes     []PostLike `gorm:"constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"likes"`
-	Tags      []Tag      `gorm:"many2many:post_tags;" json:"tags"`
+	CodeHash  string     `gorm:"not null;size:64" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `gorm:"not null;default:now()" json:"created_at"`
+}
+
+type TwoFactorChallenge struct {
+	ID        string    `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	UserID    string    `gorm:"not null;type:uuid;index" json:"user_id"`
+	User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"user"`
+	TokenHash string    `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	Attempts  int       `gorm:"not null;default:0" json:"attempts"`
+	ExpireAt  time.Time `gorm:"not null" json:"expire_at"`
+}
+
+type Session struct {
+	ID         string    `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	UserID     string    `gorm:"not null;type:uuid;index" json:"user_id"`
+	User       User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"user"`
+	TokenHash  string    `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	UserAgent  string    `gorm:"type:text" json:"user_agent"`
+	IP         string    `gorm:"size:64" json:"ip"`
+	CreatedAt  time.Time `gorm:"not null;default:now()" json:"created_at"`
+	LastSeenAt time.Time `gorm:"not null;default:now()" json:"last_seen_at"`
+	ExpiresAt  time.Time `gorm:"not null;index" json:"expires_at"`
+}
+
+type Identity struct {
+	ID        string    `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	UserID    string    `gorm:"not null;type:uuid;index" json:"user_id"`
+	User      User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"user"`
+	Provider  string    `gorm:"not null;size:50;uniqueIndex:idx_identities_provider_subject" json:"provider"`
+	Subject   string    `gorm:"not null;size:255;uniqueIndex:idx_identities_provider_subject" json:"subject"`
+	Email     string    `gorm:"size:100" json:"email"`
+	CreatedAt time.Time `gorm:"not null;default:now()" json:"created_at"`
+}
+
+type OIDCState struct {
+	ID           string    `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	StateHash    string    `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	Provider     string    `gorm:"not null;size:50" json:"provider"`
+	Nonce        string    `gorm:"not null;size:100" json:"-"`
+	CodeVerifier string    `gorm:"not null;size:128" json:"-"`
+	LinkUserID   *string   `gorm:"type:uuid" json:"link_user_id"`
+	ExpireAt     time.Time `gorm:"not null" json:"expire_at"`
+}
+
+type APIToken struct {
+	ID         string     `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	UserID     string     `gorm:"not null;type:uuid;index" json:"user_id"`
+	User       User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"user"`
+	Name       string     `gorm:"not null;size:100" json:"name"`
+	Prefix     string     `gorm:"not null;size:16" json:"prefix"`
+	TokenHash  string     `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	Scopes     string     `gorm:"not null;size:255" json:"scopes"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `gorm:"not null;default:now()" json:"created_at"`
+}
+
+// ModerationAction outlives its actor's account; purging the account only
+// clears ActorID.
+type ModerationAction struct {
+	ID         string    `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	ActorID    *string   `gorm:"type:uuid;index" json:"actor_id"`
+	Actor      *User     `gorm:"foreignKey:ActorID;constraint:OnDelete:SET NULL;onUpdate:CASCADE" json:"actor"`
+	Action     string    `gorm:"not null;size:50;index" json:"action"`
+	TargetType string    `gorm:"not null;size:50" json:"target_type"`
+	TargetID   string    `gorm:"not null;size:100;index" json:"target_id"`
+	Details    string    `gorm:"type:text" json:"details"`
+	CreatedAt  time.Time `gorm:"not null;default:now();index" json:"created_at"`
+}
+
+// AuditEvent rows are append-only: a trigger refuses updates and deletes, and
+// the hooks below refuse them before they reach the database. The actor is
+// kept as a plain id so the trail outlives purged accounts.
+type AuditEvent struct {
+	ID         string    `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	ActorID    *string   `gorm:"type:uuid;index" json:"actor_id"`
+	Action     string    `gorm:"not null;size:64;index" json:"action"`
+	TargetType string    `gorm:"size:50" json:"target_type"`
+	TargetID   string    `gorm:"size:100;index" json:"target_id"`
+	IP         string    `gorm:"size:64" json:"ip"`
+	UserAgent  string    `gorm:"type:text" json:"user_agent"`
+	Metadata   string    `gorm:"type:text" json:"metadata"`
+	CreatedAt  time.Time `gorm:"not null;default:now();index" json:"created_at"`
+}
+
+func (AuditEvent) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditEventImmutable
+}
+
+func (AuditEvent) BeforeDelete(*gorm.DB) error {
+	return ErrAuditEventImmutable
+}
+
+// Report targets are stored by id without foreign keys so that the report
+// history survives the reported content being deleted.
+type Report struct {
+	ID           string     `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	ReporterID   string     `gorm:"not null;type:uuid;index" json:"reporter_id"`
+	Reporter     User       `gorm:"foreignKey:ReporterID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"reporter"`
+	TargetType   string     `gorm:"not null;size:20;index:idx_reports_target" json:"target_type"`
+	TargetID     string     `gorm:"not null;type:uuid;index:idx_reports_target" json:"target_id"`
+	PostID       string     `gorm:"not null;type:uuid;index" json:"post_id"`
+	Reason       string     `gorm:"not null;size:50" json:"reason"`
+	Details      string     `gorm:"type:text" json:"details"`
+	Status       string     `gorm:"not null;size:20;default:open;index" json:"status"`
+	ResolvedByID *string    `gorm:"type:uuid" json:"resolved_by_id"`
+	ResolvedAt   *time.Time `json:"resolved_at"`
+	Resolution   string     `gorm:"size:20" json:"resolution"`
+	CreatedAt    time.Time  `gorm:"not null;default:now();index" json:"created_at"`
+}
+
+type Warning struct {
+	ID         string    `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	UserID     string    `gorm:"not null;type:uuid;index" json:"user_id"`
+	User       User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"user"`
+	IssuedByID string    `gorm:"not null;type:uuid" json:"issued_by_id"`
+	ReportID   *string   `gorm:"type:uuid" json:"report_id"`
+	Reason     string    `gorm:"type:text" json:"reason"`
+	CreatedAt  time.Time `gorm:"not null;default:now()" json:"created_at"`
+}
+
+type AccountDeletion struct {
+	ID           string    `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	UserID       string    `gorm:"not null;type:uuid;uniqueIndex" json:"user_id"`
+	User         User      `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"user"`
+	TokenHash    string    `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	RequestedAt  time.Time `gorm:"not null;default:now()" json:"requested_at"`
+	ScheduledFor time.Time `gorm:"not null;index" json:"scheduled_for"`
+}
+
+type DataExport struct {
+	ID          string     `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	UserID      string     `gorm:"not null;type:uuid;index" json:"user_id"`
+	User        User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"user"`
+	Status      string     `gorm:"not null;size:20;default:pending" json:"status"`
+	ObjectKey   string     `gorm:"type:text" json:"-"`
+	RequestedAt time.Time  `gorm:"not null;default:now()" json:"requested_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `gorm:"index" json:"expires_at"`
+}
+
+type User struct {
+	ID            string         `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	FirstName     string         `gorm:"not null;size:100" json:"first_name"`
+	LastName      string         `gorm:"not null;size:100" json:"last_name"`
+	Email         string         `gorm:"not null;size:100;unique" json:"email"`
+	HashPassword  string         `gorm:"not null;size:255" json:"hash_password"`
+	EmailVerified bool           `gorm:"not null;default:false" json:"email_verified"`
+	FailedLogins  int            `gorm:"not null;default:0" json:"failed_logins"`
+	LockedUntil   *time.Time     `json:"locked_until"`
+	TOTPSecret    string         `gorm:"type:text" json:"-"`
+	TOTPEnabled   bool           `gorm:"not null;default:false" json:"totp_enabled"`
+	TOTPLastStep  int64          `gorm:"not null;default:0" json:"totp_last_step"`
+	Role          string         `gorm:"not null;size:20;default:user" json:"role"`
+	DeletedAt     gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+	Image         string         `gorm:"type:text" json:"image"`
+	ImageKey      string         `gorm:"type:text" json:"image_key"`
+	Comments      []Comment      `gorm:"constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"comments"`
+	Posts         []Post         `gorm:"constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"posts"`
+	PostLikes     []PostLike     `gorm:"constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"post_likes"`
+	CommentLikes  []CommentLike  `gorm:"constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"comment_likes"`
+}
+
+type Post struct {
+	ID          string         `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	Title       string         `gorm:"not null;size:255" json:"title"`
+	CreatedAt   time.Time      `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt   time.Time      `gorm:"not null;default:now();autoUpdateTime" json:"updated_at"`
+	Body        string         `gorm:"not null;type:text" json:"body"`
+	UserID      string         `gorm:"not null;type:uuid;index" json:"user_id"`
+	User        User           `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"user"`
+	Image       string         `gorm:"type:text" json:"image"`
+	ImageKey    string         `gorm:"type:text" json:"image_key"`
+	Hidden      bool           `gorm:"not null;default:false;index" json:"hidden"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+	DeletedByID *string        `gorm:"type:uuid" json:"deleted_by_id"`
+	Comments    []Comment      `gorm:"constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"comments"`
+	Likes       []PostLike     `gorm:"constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"likes"`
+	Tags        []Tag          `gorm:"many2many:post_tags;" json:"tags"`
 }
 
 type Comment struct {
-	ID        string        `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
-	Message   string        `gorm:"not null;type:text" json:"message"`
-	CreatedAt time.Time     `gorm:"not null;default:now()" json:"created_at"`
-	UpdatedAt time.Time     `gorm:"not null;default:now();autoUpdateTime" json:"updated_at"`
-	UserID    string        `gorm:"not null;type:uuid;index" json:"user_id"`
-	User      User          `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"user"`
-	PostID    string        `gorm:"not null;type:uuid;index" json:"post_id"`
-	Post      Post          `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"post"`
-	ParentID  *string       `gorm:"type:uuid;index" json:"parent_id"`
-	Parent    *Comment      `gorm:"foreignKey:ParentID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"parent"`
-	Children  []Comment     `gorm:"foreignKey:ParentID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"children"`
-	Likes     []CommentLike `gorm:"constraint:OnDelete:CASCADE;" json:"likes"`
+	ID          string         `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	Message     string         `gorm:"not null;type:text" json:"message"`
+	CreatedAt   time.Time      `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt   time.Time      `gorm:"not null;default:now();autoUpdateTime" json:"updated_at"`
+	UserID      string         `gorm:"not null;type:uuid;index" json:"user_id"`
+	User        User           `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"user"`
+	PostID      string         `gorm:"not null;type:uuid;index" json:"post_id"`
+	Post        Post           `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"post"`
+	Hidden      bool           `gorm:"not null;default:false" json:"hidden"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+	DeletedByID *string        `gorm:"type:uuid" json:"deleted_by_id"`
+	ParentID    *string        `gorm:"type:uuid;index" json:"parent_id"`
+	Parent      *Comment       `gorm:"foreignKey:ParentID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"parent"`
+	Children    []Comment      `gorm:"foreignKey:ParentID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"children"`
+	Likes       []CommentLike  `gorm:"constraint:OnDelete:CASCADE;" json:"likes"`
+}
+
+type Notification struct {
+	ID        string              `gorm:"primaryKey;type:uuid;default:uuid_generate_v4()" json:"id"`
+	UserID    string              `gorm:"not null;type:uuid;index" json:"user_id"`
+	User      User                `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"user"`
+	Type      string              `gorm:"not null;size:50" json:"type"`
+	PostID    string              `gorm:"not null;type:uuid;index" json:"post_id"`
+	Post      Post                `gorm:"foreignKey:PostID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"post"`
+	CommentID *string             `gorm:"type:uuid;index" json:"comment_id"`
+	Comment   *Comment            `gorm:"foreignKey:CommentID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"comment"`
+	Read      bool                `gorm:"not null;default:false;index" json:"read"`
+	CreatedAt time.Time           `gorm:"not null;default:now()" json:"created_at"`
+	UpdatedAt time.Time           `gorm:"not null;default:now();autoUpdateTime" json:"updated_at"`
+	Actors    []NotificationActor `gorm:"constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"actors"`
+}
+
+type NotificationActor struct {
+	NotificationID string       `gorm:"primaryKey;type:uuid" json:"notification_id"`
+	UserID         string       `gorm:"primaryKey;type:uuid" json:"user_id"`
+	Notification   Notification `gorm:"foreignKey:NotificationID;constraint:OnDelete:CASCADE;onUpdate:CASCADE;" json:"notification"`
+	User           User         `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;onUpdate:CASCADE;" json:"user"`
+	CreatedAt      time.Time    `gorm:"not null;default:now()" json:"created_at"`
+}
+
+var ErrAuditEventImmutable = errors.New("audit events cannot be changed or deleted")
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusActioned  = "actioned"
+	ReportStatusDismissed = "dismissed"
+
+	ReportTargetPost    = "post"
+	ReportTargetComment = "comment"
+)
+
+const (
+	DataExportPending = "pending"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+const (
+	NotificationCommentReply = "COMMENT_REPLY"
+	NotificationPostComment  = "POST_COMMENT"
+	NotificationPostLike     = "POST_LIKE"
+	NotificationCommentLike  = "COMMENT_LIKE"
+)
+
+func (n Notification) Summary() string {
+	names := ""
+	switch len(n.Actors) {
+	case 0:
+		names = "Someone"
+	case 1:
+		names = n.Actors[0].User.FirstName
+	case 2:
+		names = fmt.Sprintf("%s and %s", n.Actors[0].User.FirstName, n.Actors[1].User.FirstName)
+	default:
+		names = fmt.Sprintf("%s and %d others", n.Actors[0].User.FirstName, len(n.Actors)-1)
+	}
+
+	switch n.Type {
+	case NotificationCommentReply:
+		return names + " replied to your comment"
+	case NotificationPostComment:
+		return names + " commented on your post"
+	case NotificationPostLike:
+		return names + " liked your post"
+	case NotificationCommentLike:
+		return names + " liked your comment"
+	default:
+		return names + " interacted with your content"
+	}
+}
+
+type EmailPreference struct {
+	UserID           string     `gorm:"primaryKey;type:uuid" json:"user_id"`
+	User             User       `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE;onUpdate:CASCADE" json:"user"`
+	Digest           string     `gorm:"not null;size:20;default:weekly" json:"digest"`
+	LastDigestAt     *time.Time `json:"last_digest_at"`
+	UnsubscribeToken string     `gorm:"not null;size:64;uniqueIndex" json:"-"`
 }
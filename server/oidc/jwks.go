@@ -0,0 +1,192 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const jwksRefreshInterval = 5 * time.Minute
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+type keySet struct {
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+func decodeSegment(segment string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+}
+
+func parseKey(key JSONWebKey) (crypto.PublicKey, error) {
+	switch key.Kty {
+	case "RSA":
+		n, err := decodeSegment(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeSegment(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if key.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", key.Crv)
+		}
+		x, err := decodeSegment(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeSegment(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", key.Kty)
+	}
+}
+
+func (c *Client) fetchKeys(ctx context.Context, jwksURI string) (*keySet, error) {
+	set := JSONWebKeySet{}
+	if err := c.getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch signing keys: %v", err)
+	}
+
+	keys := &keySet{keys: map[string]crypto.PublicKey{}, fetchedAt: time.Now()}
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		publicKey, err := parseKey(key)
+		if err != nil {
+			continue
+		}
+		keys.keys[key.Kid] = publicKey
+	}
+
+	return keys, nil
+}
+
+// lookupKey returns the key for kid, refetching the key set when the kid is
+// unknown so that provider key rotation is picked up.
+func (c *Client) lookupKey(ctx context.Context, jwksURI string, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	keys := c.keys
+	c.mu.Unlock()
+
+	if keys != nil {
+		if key, ok := keys.keys[kid]; ok {
+			return key, nil
+		}
+		if time.Since(keys.fetchedAt) < jwksRefreshInterval && len(keys.keys) > 0 && kid != "" {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+
+	keys, err := c.fetchKeys(ctx, jwksURI)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.mu.Unlock()
+
+	if key, ok := keys.keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(keys.keys) == 1 {
+		for _, key := range keys.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (c *Client) verifySignature(ctx context.Context, jwksURI string, rawToken string, claims interface{}) error {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return errors.New("malformed id token")
+	}
+
+	headerBytes, err := decodeSegment(parts[0])
+	if err != nil {
+		return errors.New("malformed id token header")
+	}
+	header := jwtHeader{}
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return errors.New("malformed id token header")
+	}
+
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return errors.New("malformed id token signature")
+	}
+
+	key, err := c.lookupKey(ctx, jwksURI, header.Kid)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch header.Alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("signing key does not match RS256")
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("invalid id token signature")
+		}
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return errors.New("signing key does not match ES256")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return errors.New("invalid id token signature")
+		}
+	default:
+		return fmt.Errorf("unsupported id token algorithm %q", header.Alg)
+	}
+
+	payload, err := decodeSegment(parts[1])
+	if err != nil {
+		return errors.New("malformed id token payload")
+	}
+	return json.Unmarshal(payload, claims)
+}
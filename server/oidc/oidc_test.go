@@ -0,0 +1,244 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"blog_post/oidc"
+	"blog_post/oidc/oidctest"
+)
+
+const (
+	clientID = "blog"
+	nonce    = "expected-nonce"
+)
+
+func newProvider(t *testing.T) (*oidctest.Server, *oidc.Client) {
+	t.Helper()
+
+	provider := oidctest.NewServer(clientID, "secret")
+	t.Cleanup(provider.Close)
+
+	client := oidc.NewClient(oidc.Config{
+		Name:         "test",
+		Issuer:       provider.Issuer(),
+		ClientID:     clientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/callback",
+	})
+	return provider, client
+}
+
+func validClaims(provider *oidctest.Server) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":            provider.Issuer(),
+		"sub":            "subject",
+		"aud":            clientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          nonce,
+		"email":          "user@example.com",
+		"email_verified": true,
+	}
+}
+
+func sign(t *testing.T, provider *oidctest.Server, claims map[string]interface{}) string {
+	t.Helper()
+	token, err := provider.SignIDToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// withHeader swaps the header of a signed token, keeping its signature.
+func withHeader(token string, header string) string {
+	parts := strings.Split(token, ".")
+	parts[0] = base64.RawURLEncoding.EncodeToString([]byte(header))
+	return strings.Join(parts, ".")
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	provider, client := newProvider(t)
+
+	claims, err := client.VerifyIDToken(context.Background(), sign(t, provider, validClaims(provider)), nonce)
+	if err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	if claims.Subject != "subject" || claims.Email != "user@example.com" || !claims.EmailVerified {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+
+	audiences := validClaims(provider)
+	audiences["aud"] = []string{"other", clientID}
+	if _, err := client.VerifyIDToken(context.Background(), sign(t, provider, audiences), nonce); err != nil {
+		t.Fatalf("token with several audiences rejected: %v", err)
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	provider, client := newProvider(t)
+
+	modified := func(key string, value interface{}) string {
+		claims := validClaims(provider)
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return sign(t, provider, claims)
+	}
+
+	valid := sign(t, provider, validClaims(provider))
+	parts := strings.Split(valid, ".")
+	otherPayload := strings.Split(modified("sub", "someone-else"), ".")[1]
+
+	tests := []struct {
+		name  string
+		token string
+		nonce string
+		want  string
+	}{
+		{"malformed", "not-a-token", nonce, "malformed"},
+		{"bad signature", parts[0] + "." + otherPayload + "." + parts[2], nonce, "invalid id token signature"},
+		{"truncated signature", parts[0] + "." + parts[1] + "." + parts[2][:10], nonce, "invalid id token signature"},
+		{"alg none", withHeader(parts[0]+"."+parts[1]+".", `{"alg":"none","kid":"oidctest-key"}`), nonce, "unsupported id token algorithm"},
+		{"alg HS256", withHeader(valid, `{"alg":"HS256","kid":"oidctest-key"}`), nonce, "unsupported id token algorithm"},
+		{"alg ES256 with an RSA key", withHeader(valid, `{"alg":"ES256","kid":"oidctest-key"}`), nonce, "does not match ES256"},
+		{"unknown key", withHeader(valid, `{"alg":"RS256","kid":"rotated-away"}`), nonce, "unknown signing key"},
+		{"wrong audience", modified("aud", "someone-else"), nonce, "not issued for this client"},
+		{"wrong issuer", modified("iss", "https://evil.example.com"), nonce, "unexpected issuer"},
+		{"expired", modified("exp", time.Now().Add(-2*time.Minute).Unix()), nonce, "expired"},
+		{"no expiry", modified("exp", nil), nonce, "expired"},
+		{"issued in the future", modified("iat", time.Now().Add(5*time.Minute).Unix()), nonce, "in the future"},
+		{"nonce mismatch", valid, "another-nonce", "nonce mismatch"},
+		{"no subject", modified("sub", ""), nonce, "no subject"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := client.VerifyIDToken(context.Background(), test.token, test.nonce)
+			if err == nil {
+				t.Fatal("token accepted")
+			}
+			if !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("got error %q, want it to mention %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestExchangeChecksPKCE(t *testing.T) {
+	provider, client := newProvider(t)
+	ctx := context.Background()
+
+	verifier, err := oidc.RandomString(48)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code := func() string {
+		t.Helper()
+		authURL, err := client.AuthCodeURL(ctx, "state", nonce, verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		redirect, err := provider.Authorize(authURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return redirect.Query().Get("code")
+	}
+
+	if _, err := client.Exchange(ctx, code(), "wrong-verifier", nonce); err == nil || !strings.Contains(err.Error(), "PKCE") {
+		t.Fatalf("got %v, want a PKCE failure", err)
+	}
+
+	claims, err := client.Exchange(ctx, code(), verifier, nonce)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if claims.Subject != "oidctest-subject" {
+		t.Fatalf("unexpected subject %q", claims.Subject)
+	}
+}
+
+// TestVerifyIDTokenES256 serves an EC key set directly, since the mock
+// provider only signs with RSA.
+func TestVerifyIDTokenES256(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var issuer string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": issuer + "/authorize",
+			"token_endpoint":         issuer + "/token",
+			"jwks_uri":               issuer + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "EC",
+			"kid": "ec",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		}}})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	issuer = server.URL
+
+	client := oidc.NewClient(oidc.Config{Name: "ec", Issuer: issuer, ClientID: clientID})
+
+	signES256 := func(claims map[string]interface{}) string {
+		header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "ec"})
+		payload, _ := json.Marshal(claims)
+		input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+		digest := sha256.Sum256([]byte(input))
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":   issuer,
+		"sub":   "subject",
+		"aud":   clientID,
+		"exp":   now.Add(time.Minute).Unix(),
+		"iat":   now.Unix(),
+		"nonce": nonce,
+	}
+
+	token := signES256(claims)
+	if _, err := client.VerifyIDToken(context.Background(), token, nonce); err != nil {
+		t.Fatalf("valid ES256 token rejected: %v", err)
+	}
+
+	parts := strings.Split(token, ".")
+	claims["sub"] = "someone-else"
+	forged := parts[0] + "." + strings.Split(signES256(claims), ".")[1] + "." + parts[2]
+	if _, err := client.VerifyIDToken(context.Background(), forged, nonce); err == nil || !strings.Contains(err.Error(), "invalid id token signature") {
+		t.Fatalf("got %v, want a signature failure", err)
+	}
+}
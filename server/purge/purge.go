@@ -0,0 +1,274 @@
+package purge
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"blog_post/mailer"
+	"blog_post/models"
+	"blog_post/storage"
+
+	"gorm.io/gorm"
+)
+
+// dataExportTimeout is how long an export may stay pending. Exports are built
+// inside the server, so one still pending after that was cut off by a restart
+// and will never finish.
+const dataExportTimeout = time.Hour
+
+// Start purges, every hour, whatever was soft-deleted more than retention
+// ago. Exports left pending by the previous run of the server are failed
+// right away, so they do not hold up new ones until the first purge.
+func Start(db *gorm.DB, store storage.Storage, mail mailer.Mailer, retention time.Duration) {
+	go func() {
+		if err := failStaleDataExports(db); err != nil {
+			log.Printf("Failed to mark stale data exports as failed: %v", err)
+		}
+
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := Run(context.Background(), db, store, mail, time.Now().Add(-retention)); err != nil {
+				log.Printf("Failed to purge deleted content: %v", err)
+			}
+		}
+	}()
+}
+
+// Run hard-deletes everything soft-deleted before cutoff, including the S3
+// media of purged posts, and accounts whose scheduled deletion is due. It
+// also fails stale data exports and removes expired ones.
+func Run(ctx context.Context, db *gorm.DB, store storage.Storage, mail mailer.Mailer, cutoff time.Time) error {
+	if err := purgeUsers(ctx, db, store, mail, cutoff); err != nil {
+		return err
+	}
+	if err := purgePosts(ctx, db, store, cutoff); err != nil {
+		return err
+	}
+	if err := failStaleDataExports(db); err != nil {
+		return err
+	}
+	if err := purgeDataExports(ctx, db, store); err != nil {
+		return err
+	}
+	return purgeComments(db, cutoff)
+}
+
+func deletePostImages(ctx context.Context, db *gorm.DB, store storage.Storage, query *gorm.DB) error {
+	keys := []string{}
+	if err := query.Unscoped().Model(&models.Post{}).Where("image_key <> ''").Pluck("image_key", &keys).Error; err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeUsers removes accounts whose deletion grace period has ended, and
+// accounts deleted without a scheduled deletion once the retention period is
+// over, together with everything they own.
+func purgeUsers(ctx context.Context, db *gorm.DB, store storage.Storage, mail mailer.Mailer, cutoff time.Time) error {
+	users := []models.User{}
+	err := db.Unscoped().
+		Where(`users.deleted_at IS NOT NULL AND (
+			EXISTS (SELECT 1 FROM account_deletions WHERE account_deletions.user_id = users.id AND account_deletions.scheduled_for < ?)
+			OR (users.deleted_at < ? AND NOT EXISTS (SELECT 1 FROM account_deletions WHERE account_deletions.user_id = users.id)))`, time.Now(), cutoff).
+		Find(&users).Error
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		if err := deleteUserMedia(ctx, db, store, user); err != nil {
+			log.Printf("Failed to delete media of user %s: %v", user.ID, err)
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Replies from other users would go down with the account's
+			// comments, so move them up to the nearest ancestor first.
+			for {
+				result := tx.Exec(`UPDATE comments SET parent_id = parent.parent_id
+					FROM comments parent
+					WHERE comments.parent_id = parent.id AND parent.user_id = ? AND comments.user_id <> ?`, user.ID, user.ID)
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected == 0 {
+					break
+				}
+			}
+
+			for _, model := range []interface{}{&models.PostLike{}, &models.CommentLike{}, &models.Session{}, &models.APIToken{}} {
+				if err := tx.Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+					return err
+				}
+			}
+
+			return tx.Unscoped().Delete(&user).Error
+		})
+		if err != nil {
+			log.Printf("Failed to purge user %s: %v", user.ID, err)
+			continue
+		}
+
+		// The handlers package imports purge, so the audit entry is written
+		// here directly.
+		if err := db.Create(&models.AuditEvent{
+			Action:     "user.purged",
+			TargetType: "user",
+			TargetID:   user.ID,
+			CreatedAt:  time.Now(),
+		}).Error; err != nil {
+			log.Printf("Failed to record purge of user %s: %v", user.ID, err)
+		}
+
+		if err := sendAccountDeletedEmail(mail, user); err != nil {
+			log.Printf("Failed to send deletion confirmation to user %s: %v", user.ID, err)
+		}
+
+		log.Printf("Purged user %s", user.ID)
+	}
+
+	return nil
+}
+
+// deleteUserMedia removes the profile image and the images of every post the
+// user ever made from S3.
+func deleteUserMedia(ctx context.Context, db *gorm.DB, store storage.Storage, user models.User) error {
+	key := user.ImageKey
+	if key == "" && user.Image != "" {
+		key = store.KeyFromURL(user.Image)
+	}
+	if key != "" {
+		if err := store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+
+	if err := deletePostImages(ctx, db, store, db.Where("user_id = ?", user.ID)); err != nil {
+		return err
+	}
+
+	keys := []string{}
+	if err := db.Model(&models.DataExport{}).Where("user_id = ? AND object_key <> ''", user.ID).Pluck("object_key", &keys).Error; err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sendAccountDeletedEmail(mail mailer.Mailer, user models.User) error {
+	if mail == nil || user.Email == "" {
+		return nil
+	}
+
+	msg, err := mailer.NewMessage(user.Email, "Your account has been deleted", "account_deleted", map[string]interface{}{
+		"FirstName": user.FirstName,
+	})
+	if err != nil {
+		return err
+	}
+
+	return mail.Send(msg)
+}
+
+func purgePosts(ctx context.Context, db *gorm.DB, store storage.Storage, cutoff time.Time) error {
+	posts := []models.Post{}
+	if err := db.Unscoped().Where("deleted_at < ?", cutoff).Find(&posts).Error; err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		if post.ImageKey != "" {
+			if err := store.Delete(ctx, post.ImageKey); err != nil {
+				log.Printf("Failed to delete media of post %s: %v", post.ID, err)
+				continue
+			}
+		}
+
+		if err := db.Unscoped().Delete(&post).Error; err != nil {
+			log.Printf("Failed to purge post %s: %v", post.ID, err)
+		}
+	}
+
+	if len(posts) > 0 {
+		log.Printf("Purged %d posts", len(posts))
+	}
+	return nil
+}
+
+// failStaleDataExports marks exports pending for longer than
+// dataExportTimeout as failed, which lets the user request a new one.
+func failStaleDataExports(db *gorm.DB) error {
+	result := db.Model(&models.DataExport{}).
+		Where("status = ? AND requested_at < ?", models.DataExportPending, time.Now().Add(-dataExportTimeout)).
+		Update("status", models.DataExportFailed)
+	if result.RowsAffected > 0 {
+		log.Printf("Marked %d stale data exports as failed", result.RowsAffected)
+	}
+	return result.Error
+}
+
+// purgeDataExports removes export archives once their download link has
+// expired.
+func purgeDataExports(ctx context.Context, db *gorm.DB, store storage.Storage) error {
+	exports := []models.DataExport{}
+	if err := db.Where("expires_at < ?", time.Now()).Find(&exports).Error; err != nil {
+		return err
+	}
+
+	for _, dataExport := range exports {
+		if dataExport.ObjectKey != "" {
+			if err := store.Delete(ctx, dataExport.ObjectKey); err != nil {
+				log.Printf("Failed to delete data export %s: %v", dataExport.ID, err)
+				continue
+			}
+		}
+
+		if err := db.Delete(&dataExport).Error; err != nil {
+			log.Printf("Failed to purge data export %s: %v", dataExport.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// purgeComments removes deleted comments without replies. Deleted comments
+// that still have replies are kept as empty placeholders; they are removed
+// once their last reply is gone.
+func purgeComments(db *gorm.DB, cutoff time.Time) error {
+	var purged int64
+	for {
+		result := db.Unscoped().
+			Where("deleted_at < ?", cutoff).
+			Where("NOT EXISTS (SELECT 1 FROM comments replies WHERE replies.parent_id = comments.id)").
+			Delete(&models.Comment{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			break
+		}
+		purged += result.RowsAffected
+	}
+
+	if err := db.Unscoped().Model(&models.Comment{}).Where("deleted_at < ? AND message <> ''", cutoff).UpdateColumn("message", "").Error; err != nil {
+		return err
+	}
+
+	if purged > 0 {
+		log.Printf("Purged %d comments", purged)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"blog_post/apperror"
+	"blog_post/config"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+)
+
+type Rule struct {
+	Max    int
+	Window time.Duration
+}
+
+// FromConfig returns the RATE_LIMIT_<NAME> override for name, if one is
+// configured, or def.
+func FromConfig(limits map[string]config.RateLimit, name string, def Rule) Rule {
+	if limit, found := limits[strings.ToLower(name)]; found {
+		return Rule{Max: limit.Max, Window: limit.Window}
+	}
+	return def
+}
+
+func newLimiter(name string, rule Rule, key func(ctx *fiber.Ctx) string) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        rule.Max,
+		Expiration: rule.Window,
+		KeyGenerator: func(ctx *fiber.Ctx) string {
+			return fmt.Sprintf("%s:%s", name, key(ctx))
+		},
+		LimitReached: func(ctx *fiber.Ctx) error {
+			return apperror.TooManyRequests("Too many requests, please try again later")
+		},
+	})
+}
+
+func PerIP(name string, rule Rule) fiber.Handler {
+	return newLimiter(name, rule, func(ctx *fiber.Ctx) string {
+		return ctx.IP()
+	})
+}
+
+// PerAccount keys on the email in the JSON request body so that an attacker
+// spreading attempts over many IPs is still limited per targeted account.
+func PerAccount(name string, rule Rule) fiber.Handler {
+	return newLimiter(name, rule, func(ctx *fiber.Ctx) string {
+		var body struct {
+			Email string `json:"email"`
+		}
+		if err := json.Unmarshal(ctx.Body(), &body); err != nil || body.Email == "" {
+			return "ip:" + ctx.IP()
+		}
+		return "email:" + strings.ToLower(strings.TrimSpace(body.Email))
+	})
+}
+
+func PerUser(name string, rule Rule) fiber.Handler {
+	return newLimiter(name, rule, func(ctx *fiber.Ctx) string {
+		if userID, _ := ctx.Locals("userId").(string); userID != "" {
+			return "user:" + userID
+		}
+		return "ip:" + ctx.IP()
+	})
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"blog_post/apperror"
+	"blog_post/config"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func newApp(handler fiber.Handler) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: apperror.Handler})
+	app.Use(func(ctx *fiber.Ctx) error {
+		if userID := ctx.Get("X-Test-User"); userID != "" {
+			ctx.Locals("userId", strings.Clone(userID))
+		}
+		return ctx.Next()
+	})
+	app.Post("/", handler, func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusNoContent)
+	})
+	return app
+}
+
+func status(t *testing.T, app *fiber.App, body string, userID string) int {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", fiber.MIMEApplicationJSON)
+	if userID != "" {
+		req.Header.Set("X-Test-User", userID)
+	}
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestFromConfig(t *testing.T) {
+	def := Rule{Max: 5, Window: time.Minute}
+	limits := map[string]config.RateLimit{"signin_ip": {Max: 1, Window: time.Hour}}
+
+	if rule := FromConfig(limits, "SIGNIN_IP", def); rule != (Rule{Max: 1, Window: time.Hour}) {
+		t.Fatalf("override ignored: %+v", rule)
+	}
+	if rule := FromConfig(limits, "signup_ip", def); rule != def {
+		t.Fatalf("default ignored: %+v", rule)
+	}
+}
+
+func TestPerAccount(t *testing.T) {
+	app := newApp(PerAccount("test", Rule{Max: 2, Window: time.Minute}))
+
+	for _, body := range []string{`{"email":"alice@example.com"}`, `{"email":" ALICE@example.com "}`} {
+		if got := status(t, app, body, ""); got != fiber.StatusNoContent {
+			t.Fatalf("got %d before the limit", got)
+		}
+	}
+	if got := status(t, app, `{"email":"Alice@Example.com"}`, ""); got != fiber.StatusTooManyRequests {
+		t.Fatalf("got %d, want the account limited", got)
+	}
+	if got := status(t, app, `{"email":"bob@example.com"}`, ""); got != fiber.StatusNoContent {
+		t.Fatalf("got %d, another account was limited", got)
+	}
+}
+
+func TestPerUser(t *testing.T) {
+	app := newApp(PerUser("test", Rule{Max: 1, Window: time.Minute}))
+
+	if got := status(t, app, "", "alice"); got != fiber.StatusNoContent {
+		t.Fatalf("got %d before the limit", got)
+	}
+	if got := status(t, app, "", "alice"); got != fiber.StatusTooManyRequests {
+		t.Fatalf("got %d, want the user limited", got)
+	}
+	if got := status(t, app, "", "bob"); got != fiber.StatusNoContent {
+		t.Fatalf("got %d, another user was limited", got)
+	}
+}
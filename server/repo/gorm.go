@@ -0,0 +1,262 @@
+package repo
+
+import (
+	"blog_post/models"
+
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NewGorm returns repositories backed by the database.
+func NewGorm(db *gorm.DB) Repos {
+	return Repos{
+		Users:    gormUsers{db},
+		Posts:    gormPosts{db},
+		Comments: gormComments{db},
+		Tags:     gormTags{db},
+		Likes:    gormLikes{db},
+	}
+}
+
+type gormUsers struct {
+	db *gorm.DB
+}
+
+func (r gormUsers) find(query *gorm.DB) (models.User, error) {
+	user := models.User{}
+	if err := query.Limit(1).Find(&user).Error; err != nil {
+		return user, err
+	}
+	if user.ID == "" {
+		return user, ErrNotFound
+	}
+	return user, nil
+}
+
+func (r gormUsers) Get(id string) (models.User, error) {
+	return r.find(r.db.Where("id = ?", id))
+}
+
+func (r gormUsers) GetByEmail(email string) (models.User, error) {
+	return r.find(r.db.Where("email = ?", email))
+}
+
+func (r gormUsers) GetByEmailWithDeleted(email string) (models.User, error) {
+	return r.find(r.db.Unscoped().Where("email = ?", email))
+}
+
+func (r gormUsers) EmailTaken(email string) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.User{}).Where("email = ?", email).Count(&count).Error
+	return count > 0, err
+}
+
+// uniqueViolation is the PostgreSQL error code for a unique constraint.
+const uniqueViolation = "23505"
+
+func emailTaken(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == "uni_users_email" {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+func (r gormUsers) Create(user *models.User) error {
+	return emailTaken(r.db.Create(user).Error)
+}
+
+func (r gormUsers) Save(user *models.User) error {
+	return emailTaken(r.db.Save(user).Error)
+}
+
+func (r gormUsers) SetPasswordHash(id string, hash string) error {
+	return r.db.Model(&models.User{}).Where("id = ?", id).Update("hash_password", hash).Error
+}
+
+type gormPosts struct {
+	db *gorm.DB
+}
+
+func (r gormPosts) Get(id string) (models.Post, error) {
+	post := models.Post{}
+	if err := r.db.Where("id = ?", id).Limit(1).Find(&post).Error; err != nil {
+		return post, err
+	}
+	if post.ID == "" {
+		return post, ErrNotFound
+	}
+	return post, nil
+}
+
+func (r gormPosts) OwnerID(id string) (string, error) {
+	var ownerID string
+	if err := r.db.Model(&models.Post{}).Where("id = ?", id).Limit(1).Pluck("user_id", &ownerID).Error; err != nil {
+		return "", err
+	}
+	if ownerID == "" {
+		return "", ErrNotFound
+	}
+	return ownerID, nil
+}
+
+func (r gormPosts) List(viewerID string, includeHidden bool) ([]models.Post, error) {
+	visible := func(db *gorm.DB) *gorm.DB {
+		if includeHidden {
+			return db
+		}
+		return db.Where("hidden = ? OR user_id = ?", false, viewerID)
+	}
+
+	posts := []models.Post{}
+	err := r.db.Scopes(visible).Preload("Comments", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped().Scopes(visible).Order("created_at DESC").Preload("User").Preload("Likes")
+	}).Preload("User").Preload("Likes").Preload("Tags").Order("created_at DESC").Find(&posts).Error
+	return posts, err
+}
+
+func (r gormPosts) Create(post *models.Post) error {
+	return r.db.Create(post).Error
+}
+
+func (r gormPosts) Update(post *models.Post) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(post).Error; err != nil {
+			return err
+		}
+		return tx.Model(post).Association("Tags").Replace(post.Tags)
+	})
+}
+
+func (r gormPosts) Delete(id string, deletedBy string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		post := models.Post{ID: id}
+		if err := tx.Model(&post).UpdateColumn("deleted_by_id", deletedBy).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&post).Error
+	})
+}
+
+type gormComments struct {
+	db *gorm.DB
+}
+
+func (r gormComments) Get(id string) (models.Comment, error) {
+	comment := models.Comment{}
+	if err := r.db.Preload("User").Where("id = ?", id).Limit(1).Find(&comment).Error; err != nil {
+		return comment, err
+	}
+	if comment.ID == "" {
+		return comment, ErrNotFound
+	}
+	return comment, nil
+}
+
+func (r gormComments) OwnerID(id string) (string, error) {
+	var ownerID string
+	if err := r.db.Model(&models.Comment{}).Where("id = ?", id).Limit(1).Pluck("user_id", &ownerID).Error; err != nil {
+		return "", err
+	}
+	if ownerID == "" {
+		return "", ErrNotFound
+	}
+	return ownerID, nil
+}
+
+func (r gormComments) Create(comment *models.Comment) error {
+	return r.db.Create(comment).Error
+}
+
+func (r gormComments) Update(comment *models.Comment) error {
+	return r.db.Omit(clause.Associations).Save(comment).Error
+}
+
+func (r gormComments) Delete(id string, deletedBy string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		comment := models.Comment{ID: id}
+		if err := tx.Model(&comment).UpdateColumn("deleted_by_id", deletedBy).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&comment).Error
+	})
+}
+
+func (r gormComments) CountReplies(id string) (int64, error) {
+	var replies int64
+	err := r.db.Model(&models.Comment{}).Where("parent_id = ?", id).Count(&replies).Error
+	return replies, err
+}
+
+type gormTags struct {
+	db *gorm.DB
+}
+
+func (r gormTags) List() ([]models.Tag, error) {
+	tags := []models.Tag{}
+	err := r.db.Find(&tags).Error
+	return tags, err
+}
+
+func (r gormTags) FindOrCreate(names []string) ([]models.Tag, error) {
+	tags := []models.Tag{}
+	for _, name := range names {
+		tag := models.Tag{Name: name}
+		if err := r.db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "name"}}, DoNothing: true}).Omit("Posts").Create(&tag).Error; err != nil {
+			return nil, err
+		}
+		if err := r.db.Where("name = ?", name).First(&tag).Error; err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+type gormLikes struct {
+	db *gorm.DB
+}
+
+// A concurrent toggle by the same user can insert the like first; the insert
+// then does nothing and the post still ends up liked.
+func (r gormLikes) TogglePostLike(userID string, postID string) (bool, error) {
+	result := r.db.Where("user_id = ? AND post_id = ?", userID, postID).Delete(&models.PostLike{})
+	if result.Error != nil || result.RowsAffected > 0 {
+		return false, result.Error
+	}
+	return true, r.db.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).Create(&models.PostLike{UserID: userID, PostID: postID}).Error
+}
+
+func (r gormLikes) ToggleCommentLike(userID string, commentID string) (bool, error) {
+	result := r.db.Where("user_id = ? AND comment_id = ?", userID, commentID).Delete(&models.CommentLike{})
+	if result.Error != nil || result.RowsAffected > 0 {
+		return false, result.Error
+	}
+	return true, r.db.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).Create(&models.CommentLike{UserID: userID, CommentID: commentID}).Error
+}
+
+func (r gormLikes) LikedPostIDs(userID string) (map[string]bool, error) {
+	ids := []string{}
+	if err := r.db.Model(&models.PostLike{}).Where("user_id = ?", userID).Pluck("post_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return toSet(ids), nil
+}
+
+func (r gormLikes) LikedCommentIDs(userID string) (map[string]bool, error) {
+	ids := []string{}
+	if err := r.db.Model(&models.CommentLike{}).Where("user_id = ?", userID).Pluck("comment_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return toSet(ids), nil
+}
+
+func toSet(ids []string) map[string]bool {
+	set := map[string]bool{}
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
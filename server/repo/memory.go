@@ -0,0 +1,459 @@
+package repo
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"blog_post/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// memory keeps every record in maps. Records are stored without their
+// associations, which are filled in on the way out like GORM preloads.
+type memory struct {
+	mu           sync.Mutex
+	users        map[string]models.User
+	posts        map[string]models.Post
+	comments     map[string]models.Comment
+	tags         map[string]models.Tag
+	postTags     map[string][]string
+	postLikes    map[[2]string]models.PostLike
+	commentLikes map[[2]string]models.CommentLike
+}
+
+// NewMemory returns repositories that keep everything in memory, for tests.
+// They follow the database semantics the handlers rely on: soft deletes,
+// unique emails and tag names, and the visibility of hidden content.
+func NewMemory() Repos {
+	m := &memory{
+		users:        map[string]models.User{},
+		posts:        map[string]models.Post{},
+		comments:     map[string]models.Comment{},
+		tags:         map[string]models.Tag{},
+		postTags:     map[string][]string{},
+		postLikes:    map[[2]string]models.PostLike{},
+		commentLikes: map[[2]string]models.CommentLike{},
+	}
+	return Repos{
+		Users:    memoryUsers{m},
+		Posts:    memoryPosts{m},
+		Comments: memoryComments{m},
+		Tags:     memoryTags{m},
+		Likes:    memoryLikes{m},
+	}
+}
+
+func deletedNow() gorm.DeletedAt {
+	return gorm.DeletedAt{Time: time.Now(), Valid: true}
+}
+
+type memoryUsers struct {
+	*memory
+}
+
+func (r memoryUsers) find(match func(models.User) bool) (models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if match(user) {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r memoryUsers) Get(id string) (models.User, error) {
+	return r.find(func(user models.User) bool {
+		return user.ID == id && !user.DeletedAt.Valid
+	})
+}
+
+func (r memoryUsers) GetByEmail(email string) (models.User, error) {
+	return r.find(func(user models.User) bool {
+		return user.Email == email && !user.DeletedAt.Valid
+	})
+}
+
+func (r memoryUsers) GetByEmailWithDeleted(email string) (models.User, error) {
+	return r.find(func(user models.User) bool {
+		return user.Email == email
+	})
+}
+
+func (r memoryUsers) EmailTaken(email string) (bool, error) {
+	_, err := r.GetByEmail(email)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r memoryUsers) Create(user *models.User) error {
+	if user.ID == "" {
+		user.ID = uuid.New().String()
+	}
+	return r.Save(user)
+}
+
+func (r memoryUsers) Save(user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, other := range r.users {
+		if other.Email == user.Email && other.ID != user.ID {
+			return ErrEmailTaken
+		}
+	}
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+
+	stored := *user
+	stored.Comments, stored.Posts, stored.PostLikes, stored.CommentLikes = nil, nil, nil, nil
+	r.users[user.ID] = stored
+	return nil
+}
+
+func (r memoryUsers) SetPasswordHash(id string, hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, found := r.users[id]
+	if !found || user.DeletedAt.Valid {
+		return nil
+	}
+	user.HashPassword = hash
+	r.users[id] = user
+	return nil
+}
+
+type memoryPosts struct {
+	*memory
+}
+
+func (r memoryPosts) Get(id string) (models.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	post, found := r.posts[id]
+	if !found || post.DeletedAt.Valid {
+		return models.Post{}, ErrNotFound
+	}
+	return post, nil
+}
+
+func (r memoryPosts) OwnerID(id string) (string, error) {
+	post, err := r.Get(id)
+	return post.UserID, err
+}
+
+func (r memoryPosts) List(viewerID string, includeHidden bool) ([]models.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	visible := func(hidden bool, ownerID string) bool {
+		return includeHidden || !hidden || ownerID == viewerID
+	}
+
+	posts := []models.Post{}
+	for _, post := range r.posts {
+		if post.DeletedAt.Valid || !visible(post.Hidden, post.UserID) {
+			continue
+		}
+
+		if user, found := r.users[post.UserID]; found && !user.DeletedAt.Valid {
+			post.User = user
+		}
+		post.Tags = []models.Tag{}
+		for _, tagID := range r.postTags[post.ID] {
+			post.Tags = append(post.Tags, r.tags[tagID])
+		}
+		post.Likes = []models.PostLike{}
+		for key, like := range r.postLikes {
+			if key[1] == post.ID {
+				post.Likes = append(post.Likes, like)
+			}
+		}
+
+		post.Comments = []models.Comment{}
+		for _, comment := range r.comments {
+			if comment.PostID != post.ID || !visible(comment.Hidden, comment.UserID) {
+				continue
+			}
+			if user, found := r.users[comment.UserID]; found && !user.DeletedAt.Valid {
+				comment.User = user
+			}
+			comment.Likes = []models.CommentLike{}
+			for key, like := range r.commentLikes {
+				if key[1] == comment.ID {
+					comment.Likes = append(comment.Likes, like)
+				}
+			}
+			post.Comments = append(post.Comments, comment)
+		}
+		sort.Slice(post.Comments, func(i, j int) bool {
+			return post.Comments[i].CreatedAt.After(post.Comments[j].CreatedAt)
+		})
+
+		posts = append(posts, post)
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].CreatedAt.After(posts[j].CreatedAt)
+	})
+
+	return posts, nil
+}
+
+func (r memoryPosts) Create(post *models.Post) error {
+	if post.ID == "" {
+		post.ID = uuid.New().String()
+	}
+	now := time.Now()
+	if post.CreatedAt.IsZero() {
+		post.CreatedAt = now
+	}
+	if post.UpdatedAt.IsZero() {
+		post.UpdatedAt = now
+	}
+	return r.store(post)
+}
+
+func (r memoryPosts) Update(post *models.Post) error {
+	if _, err := r.Get(post.ID); err != nil {
+		return err
+	}
+	return r.store(post)
+}
+
+func (r memoryPosts) store(post *models.Post) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tagIDs := []string{}
+	for _, tag := range post.Tags {
+		if _, found := r.tags[tag.ID]; !found {
+			return fmt.Errorf("unknown tag %q", tag.ID)
+		}
+		tagIDs = append(tagIDs, tag.ID)
+	}
+	r.postTags[post.ID] = tagIDs
+
+	stored := *post
+	stored.User, stored.Comments, stored.Likes, stored.Tags = models.User{}, nil, nil, nil
+	r.posts[post.ID] = stored
+	return nil
+}
+
+func (r memoryPosts) Delete(id string, deletedBy string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	post, found := r.posts[id]
+	if !found || post.DeletedAt.Valid {
+		return nil
+	}
+	post.DeletedAt = deletedNow()
+	post.DeletedByID = &deletedBy
+	r.posts[id] = post
+	return nil
+}
+
+type memoryComments struct {
+	*memory
+}
+
+func (r memoryComments) Get(id string) (models.Comment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	comment, found := r.comments[id]
+	if !found || comment.DeletedAt.Valid {
+		return models.Comment{}, ErrNotFound
+	}
+	if user, found := r.users[comment.UserID]; found && !user.DeletedAt.Valid {
+		comment.User = user
+	}
+	return comment, nil
+}
+
+func (r memoryComments) OwnerID(id string) (string, error) {
+	comment, err := r.Get(id)
+	return comment.UserID, err
+}
+
+func (r memoryComments) Create(comment *models.Comment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if post, found := r.posts[comment.PostID]; !found || post.DeletedAt.Valid {
+		return fmt.Errorf("unknown post %q", comment.PostID)
+	}
+	if comment.ParentID != nil {
+		if _, found := r.comments[*comment.ParentID]; !found {
+			return fmt.Errorf("unknown parent comment %q", *comment.ParentID)
+		}
+	}
+
+	if comment.ID == "" {
+		comment.ID = uuid.New().String()
+	}
+	now := time.Now()
+	if comment.CreatedAt.IsZero() {
+		comment.CreatedAt = now
+	}
+	if comment.UpdatedAt.IsZero() {
+		comment.UpdatedAt = now
+	}
+	r.put(*comment)
+	return nil
+}
+
+func (r memoryComments) Update(comment *models.Comment) error {
+	if _, err := r.Get(comment.ID); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.put(*comment)
+	return nil
+}
+
+func (r memoryComments) put(comment models.Comment) {
+	comment.User, comment.Post, comment.Parent, comment.Children, comment.Likes = models.User{}, models.Post{}, nil, nil, nil
+	r.comments[comment.ID] = comment
+}
+
+func (r memoryComments) Delete(id string, deletedBy string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	comment, found := r.comments[id]
+	if !found || comment.DeletedAt.Valid {
+		return nil
+	}
+	comment.DeletedAt = deletedNow()
+	comment.DeletedByID = &deletedBy
+	r.comments[id] = comment
+	return nil
+}
+
+func (r memoryComments) CountReplies(id string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var replies int64
+	for _, comment := range r.comments {
+		if comment.ParentID != nil && *comment.ParentID == id && !comment.DeletedAt.Valid {
+			replies++
+		}
+	}
+	return replies, nil
+}
+
+type memoryTags struct {
+	*memory
+}
+
+func (r memoryTags) List() ([]models.Tag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tags := []models.Tag{}
+	for _, tag := range r.tags {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+	return tags, nil
+}
+
+func (r memoryTags) FindOrCreate(names []string) ([]models.Tag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	byName := map[string]models.Tag{}
+	for _, tag := range r.tags {
+		byName[tag.Name] = tag
+	}
+
+	tags := []models.Tag{}
+	for _, name := range names {
+		tag, found := byName[name]
+		if !found {
+			tag = models.Tag{ID: uuid.New().String(), Name: name}
+			r.tags[tag.ID] = tag
+			byName[name] = tag
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+type memoryLikes struct {
+	*memory
+}
+
+func (r memoryLikes) TogglePostLike(userID string, postID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := [2]string{userID, postID}
+	if _, found := r.postLikes[key]; found {
+		delete(r.postLikes, key)
+		return false, nil
+	}
+	if _, found := r.posts[postID]; !found {
+		return false, fmt.Errorf("unknown post %q", postID)
+	}
+	r.postLikes[key] = models.PostLike{UserID: userID, PostID: postID}
+	return true, nil
+}
+
+func (r memoryLikes) ToggleCommentLike(userID string, commentID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := [2]string{userID, commentID}
+	if _, found := r.commentLikes[key]; found {
+		delete(r.commentLikes, key)
+		return false, nil
+	}
+	if _, found := r.comments[commentID]; !found {
+		return false, fmt.Errorf("unknown comment %q", commentID)
+	}
+	r.commentLikes[key] = models.CommentLike{UserID: userID, CommentID: commentID}
+	return true, nil
+}
+
+func (r memoryLikes) LikedPostIDs(userID string) (map[string]bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := map[string]bool{}
+	for key := range r.postLikes {
+		if key[0] == userID {
+			ids[key[1]] = true
+		}
+	}
+	return ids, nil
+}
+
+func (r memoryLikes) LikedCommentIDs(userID string) (map[string]bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := map[string]bool{}
+	for key := range r.commentLikes {
+		if key[0] == userID {
+			ids[key[1]] = true
+		}
+	}
+	return ids, nil
+}
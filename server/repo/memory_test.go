@@ -0,0 +1,184 @@
+package repo_test
+
+import (
+	"testing"
+
+	"blog_post/models"
+	"blog_post/repo"
+)
+
+func TestMemoryUsers(t *testing.T) {
+	users := repo.NewMemory().Users
+
+	alice := models.User{FirstName: "Alice", Email: "alice@example.com"}
+	if err := users.Create(&alice); err != nil {
+		t.Fatal(err)
+	}
+	if alice.ID == "" || alice.Role != models.RoleUser {
+		t.Fatalf("defaults not applied: %+v", alice)
+	}
+	if err := users.Create(&models.User{Email: "alice@example.com"}); err != repo.ErrEmailTaken {
+		t.Fatal("duplicate email accepted")
+	}
+
+	if taken, err := users.EmailTaken("alice@example.com"); err != nil || !taken {
+		t.Fatalf("EmailTaken = %v, %v", taken, err)
+	}
+	if err := users.SetPasswordHash(alice.ID, "new-hash"); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := users.Get(alice.ID); stored.HashPassword != "new-hash" {
+		t.Fatalf("password hash not stored: %+v", stored)
+	}
+
+	alice.DeletedAt.Valid = true
+	if err := users.Save(&alice); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Get(alice.ID); err != repo.ErrNotFound {
+		t.Fatalf("Get on a deleted user: %v", err)
+	}
+	if _, err := users.GetByEmail(alice.Email); err != repo.ErrNotFound {
+		t.Fatalf("GetByEmail on a deleted user: %v", err)
+	}
+	if deleted, err := users.GetByEmailWithDeleted(alice.Email); err != nil || deleted.ID != alice.ID {
+		t.Fatalf("GetByEmailWithDeleted = %+v, %v", deleted, err)
+	}
+}
+
+func TestMemoryPosts(t *testing.T) {
+	repos := repo.NewMemory()
+
+	author := models.User{FirstName: "Alice", Email: "alice@example.com"}
+	if err := repos.Users.Create(&author); err != nil {
+		t.Fatal(err)
+	}
+
+	tags, err := repos.Tags.FindOrCreate([]string{"go", "news"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := repos.Tags.FindOrCreate([]string{"news", "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again[0].ID != tags[1].ID || again[1].ID != tags[0].ID {
+		t.Fatalf("tags not reused in order: %+v, %+v", tags, again)
+	}
+
+	visible := models.Post{UserID: author.ID, Title: "Visible", Tags: tags}
+	hidden := models.Post{UserID: author.ID, Title: "Hidden", Hidden: true}
+	for _, post := range []*models.Post{&visible, &hidden} {
+		if err := repos.Posts.Create(post); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repos.Posts.Create(&models.Post{UserID: author.ID, Tags: []models.Tag{{ID: "missing"}}}); err == nil {
+		t.Fatal("post with an unknown tag accepted")
+	}
+
+	list := func(viewerID string, includeHidden bool) []string {
+		t.Helper()
+		posts, err := repos.Posts.List(viewerID, includeHidden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		titles := []string{}
+		for _, post := range posts {
+			titles = append(titles, post.Title)
+		}
+		return titles
+	}
+
+	if titles := list("someone-else", false); len(titles) != 1 || titles[0] != "Visible" {
+		t.Fatalf("hidden post shown to others: %v", titles)
+	}
+	if titles := list(author.ID, false); len(titles) != 2 || titles[0] != "Hidden" {
+		t.Fatalf("hidden post not shown to its author newest first: %v", titles)
+	}
+	if titles := list("moderator", true); len(titles) != 2 {
+		t.Fatalf("hidden post not shown with includeHidden: %v", titles)
+	}
+
+	commenter := models.User{FirstName: "Bob", Email: "bob@example.com"}
+	if err := repos.Users.Create(&commenter); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Comments.Create(&models.Comment{PostID: visible.ID, UserID: commenter.ID, Message: "Hi"}); err != nil {
+		t.Fatal(err)
+	}
+	commenter.DeletedAt.Valid = true
+	if err := repos.Users.Save(&commenter); err != nil {
+		t.Fatal(err)
+	}
+
+	posts, _ := repos.Posts.List(author.ID, false)
+	if posts[1].User.FirstName != "Alice" || len(posts[1].Tags) != 2 {
+		t.Fatalf("associations not filled in: %+v", posts[1])
+	}
+	if comment := posts[1].Comments[0]; comment.User.ID != "" {
+		t.Fatalf("deleted author attached to comment: %+v", comment.User)
+	}
+
+	if err := repos.Posts.Delete(visible.ID, author.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Posts.Get(visible.ID); err != repo.ErrNotFound {
+		t.Fatalf("Get on a deleted post: %v", err)
+	}
+	if err := repos.Comments.Create(&models.Comment{PostID: visible.ID, UserID: author.ID, Message: "late"}); err == nil {
+		t.Fatal("comment on a deleted post accepted")
+	}
+}
+
+func TestMemoryCommentsAndLikes(t *testing.T) {
+	repos := repo.NewMemory()
+
+	post := models.Post{UserID: "author", Title: "Post"}
+	if err := repos.Posts.Create(&post); err != nil {
+		t.Fatal(err)
+	}
+
+	parent := models.Comment{PostID: post.ID, UserID: "author", Message: "Parent"}
+	if err := repos.Comments.Create(&parent); err != nil {
+		t.Fatal(err)
+	}
+	reply := models.Comment{PostID: post.ID, UserID: "reader", Message: "Reply", ParentID: &parent.ID}
+	if err := repos.Comments.Create(&reply); err != nil {
+		t.Fatal(err)
+	}
+	missing := "missing"
+	if err := repos.Comments.Create(&models.Comment{PostID: post.ID, ParentID: &missing}); err == nil {
+		t.Fatal("reply to an unknown comment accepted")
+	}
+
+	if replies, _ := repos.Comments.CountReplies(parent.ID); replies != 1 {
+		t.Fatalf("got %d replies", replies)
+	}
+	if err := repos.Comments.Delete(reply.ID, "reader"); err != nil {
+		t.Fatal(err)
+	}
+	if replies, _ := repos.Comments.CountReplies(parent.ID); replies != 0 {
+		t.Fatalf("deleted reply still counted: %d", replies)
+	}
+
+	for _, want := range []bool{true, false, true} {
+		liked, err := repos.Likes.TogglePostLike("reader", post.ID)
+		if err != nil || liked != want {
+			t.Fatalf("TogglePostLike = %v, %v; want %v", liked, err, want)
+		}
+	}
+	if ids, _ := repos.Likes.LikedPostIDs("reader"); !ids[post.ID] || len(ids) != 1 {
+		t.Fatalf("got liked posts %v", ids)
+	}
+	if _, err := repos.Likes.TogglePostLike("reader", "missing"); err == nil {
+		t.Fatal("like on an unknown post accepted")
+	}
+
+	if liked, err := repos.Likes.ToggleCommentLike("author", parent.ID); err != nil || !liked {
+		t.Fatalf("ToggleCommentLike = %v, %v", liked, err)
+	}
+	if ids, _ := repos.Likes.LikedCommentIDs("author"); !ids[parent.ID] {
+		t.Fatalf("got liked comments %v", ids)
+	}
+}
@@ -0,0 +1,76 @@
+package repo
+
+import (
+	"errors"
+
+	"blog_post/models"
+)
+
+var (
+	ErrNotFound = errors.New("record not found")
+	// ErrEmailTaken is returned when saving a user whose email another
+	// account, deleted or not, already has.
+	ErrEmailTaken = errors.New("email already taken")
+)
+
+type UserRepo interface {
+	Get(id string) (models.User, error)
+	GetByEmail(email string) (models.User, error)
+	// GetByEmailWithDeleted also finds accounts that are soft-deleted.
+	GetByEmailWithDeleted(email string) (models.User, error)
+	EmailTaken(email string) (bool, error)
+	Create(user *models.User) error
+	Save(user *models.User) error
+	SetPasswordHash(id string, hash string) error
+}
+
+type PostRepo interface {
+	Get(id string) (models.Post, error)
+	OwnerID(id string) (string, error)
+	// List returns every post, newest first, with its author, tags, likes
+	// and comments.
+	// Comments include deleted ones (newest first) so that threads can keep
+	// placeholders. Hidden posts and comments are left out unless
+	// includeHidden is set or viewerID wrote them.
+	List(viewerID string, includeHidden bool) ([]models.Post, error)
+	// Create inserts the post and links it to post.Tags, which must exist.
+	Create(post *models.Post) error
+	// Update saves the post and replaces its tags with post.Tags.
+	Update(post *models.Post) error
+	Delete(id string, deletedBy string) error
+}
+
+type CommentRepo interface {
+	// Get returns the comment with its author.
+	Get(id string) (models.Comment, error)
+	OwnerID(id string) (string, error)
+	Create(comment *models.Comment) error
+	Update(comment *models.Comment) error
+	Delete(id string, deletedBy string) error
+	CountReplies(id string) (int64, error)
+}
+
+type TagRepo interface {
+	List() ([]models.Tag, error)
+	// FindOrCreate returns the tags with the given names, in order, creating
+	// the missing ones.
+	FindOrCreate(names []string) ([]models.Tag, error)
+}
+
+type LikeRepo interface {
+	// TogglePostLike likes the post, or removes the like if there is one, and
+	// reports whether the post is now liked.
+	TogglePostLike(userID string, postID string) (bool, error)
+	ToggleCommentLike(userID string, commentID string) (bool, error)
+	LikedPostIDs(userID string) (map[string]bool, error)
+	LikedCommentIDs(userID string) (map[string]bool, error)
+}
+
+// Repos bundles one implementation of every repository.
+type Repos struct {
+	Users    UserRepo
+	Posts    PostRepo
+	Comments CommentRepo
+	Tags     TagRepo
+	Likes    LikeRepo
+}
@@ -1,118 +1,332 @@
 package seeds
 
 import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"blog_post/config"
+	"blog_post/db_aws"
 	"blog_post/models"
+
+	"gopkg.in/yaml.v3"
 	"gorm.io/gorm"
-	"os"
+	"gorm.io/gorm/clause"
 )
 
-func Seed(db *gorm.DB) {
-	db.Exec("DELETE FROM likes")
-	db.Exec("DELETE FROM comments")
-	db.Exec("DELETE FROM post_tags")
-	db.Exec("DELETE FROM posts")
-	db.Exec("DELETE FROM tags")
-	db.Exec("DELETE FROM users")
-
-	users := []models.User{
-		{FirstName: "Tony", LastName: "STARK", Email: "tonystark@gmail.com", HashPassword: os.Getenv("HASH"), Image: os.Getenv("ironman_icon")},
-		{FirstName: "Steve", LastName: "ROGERS", Email: "steverogers@gmail.com", HashPassword: os.Getenv("HASH"), Image: os.Getenv("captain_icon")},
-		{FirstName: "Bruce", LastName: "WAYNE", Email: "brucewayne@gmail.com", HashPassword: os.Getenv("HASH"), Image: os.Getenv("batman_icon")},
-		{FirstName: "Clark", LastName: "KENT", Email: "clarkkent@gmail.com", HashPassword: os.Getenv("HASH"), Image: os.Getenv("superman_icon")},
-		{FirstName: "Sley", LastName: "HORTES", Email: "sleyhortes13@gmail.com", HashPassword: os.Getenv("HASH"), Image: os.Getenv("gojo_icon")},
+//go:embed fixtures/*
+var fixtureFS embed.FS
+
+type User struct {
+	Email         string `json:"email" yaml:"email"`
+	FirstName     string `json:"firstName" yaml:"firstName"`
+	LastName      string `json:"lastName" yaml:"lastName"`
+	Password      string `json:"password" yaml:"password"`
+	PasswordHash  string `json:"passwordHash" yaml:"passwordHash"`
+	EmailVerified bool   `json:"emailVerified" yaml:"emailVerified"`
+	Role          string `json:"role" yaml:"role"`
+	Image         string `json:"image" yaml:"image"`
+}
+
+type Comment struct {
+	Author  string    `json:"author" yaml:"author"`
+	Message string    `json:"message" yaml:"message"`
+	LikedBy []string  `json:"likedBy" yaml:"likedBy"`
+	Replies []Comment `json:"replies" yaml:"replies"`
+}
+
+type Post struct {
+	Author   string    `json:"author" yaml:"author"`
+	Title    string    `json:"title" yaml:"title"`
+	Body     string    `json:"body" yaml:"body"`
+	Image    string    `json:"image" yaml:"image"`
+	Tags     []string  `json:"tags" yaml:"tags"`
+	LikedBy  []string  `json:"likedBy" yaml:"likedBy"`
+	Comments []Comment `json:"comments" yaml:"comments"`
+}
+
+// Fixture is a set of records to load. Records are matched on natural keys
+// (users by email, tags by name, posts by author and title, comments by post,
+// parent, author and message), so loading a fixture twice changes nothing.
+type Fixture struct {
+	Users []User   `json:"users" yaml:"users"`
+	Tags  []string `json:"tags" yaml:"tags"`
+	Posts []Post   `json:"posts" yaml:"posts"`
+}
+
+type Summary struct {
+	Users    int
+	Tags     int
+	Posts    int
+	Comments int
+	Likes    int
+}
+
+var envReference = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// Sets lists the fixture sets bundled with the binary.
+func Sets() []string {
+	entries, _ := fixtureFS.ReadDir("fixtures")
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), path.Ext(entry.Name())))
 	}
-	db.Create(&users)
-
-	posts := []models.Post{
-		{
-			UserID: users[0].ID,
-			Title:  "The Rise of Iron Man",
-			Body:   "A genius billionaire with a heart of steel, Tony Stark builds a suit of armor to protect the world, using his tech genius and unshakable will. With a sarcastic edge and a drive to improve, he’s the ultimate tech-powered superhero.",
-			Image:  os.Getenv("ironman_icon"),
-			Likes: []models.PostLike{
-				{UserID: users[1].ID},
-				{UserID: users[2].ID},
-			},
-		},
-		{
-			UserID: users[1].ID,
-			Title:  "Captain America: The First Avenger",
-			Body:   "A super soldier with unwavering moral integrity, Steve Rogers is the symbol of bravery and patriotism. Armed with his indestructible shield, he leads with honor, fighting for justice and equality in a world that needs hope.",
-			Image:  os.Getenv("captain_icon"),
-			Likes: []models.PostLike{
-				{UserID: users[0].ID},
-				{UserID: users[2].ID},
-			},
-		},
-		{
-			UserID: users[4].ID,
-			Title:  "Batman: The Dark Knight",
-			Body:   "The Dark Knight, Bruce Wayne, fights crime in Gotham City using his intellect, martial arts prowess, and advanced technology. Haunted by the death of his parents, he’s a brooding, relentless vigilante who believes in justice over vengeance.",
-			Image:  os.Getenv("batman_icon"),
-			Likes: []models.PostLike{
-				{UserID: users[0].ID},
-				{UserID: users[1].ID},
-			},
-		},
-		{
-			UserID: users[3].ID,
-			Title:  "Superman: Man of Steel",
-			Body:   " The Man of Steel, Clark Kent is an alien with superhuman powers, including flight, strength, and heat vision. Raised as a symbol of hope and justice, he’s the ultimate protector of Earth, embodying the ideals of truth, justice, and the American way.",
-			Image:  os.Getenv("superman_icon"),
-			Likes: []models.PostLike{
-				{UserID: users[0].ID},
-				{UserID: users[1].ID},
-			},
-		},
+	sort.Strings(names)
+	return names
+}
+
+// Load reads a bundled fixture set by name, or a YAML/JSON file when given a
+// path. ${NAME} references are replaced with environment variables.
+func Load(nameOrPath string) (Fixture, error) {
+	fixture := Fixture{}
+
+	var content []byte
+	var format string
+	if strings.ContainsAny(nameOrPath, `/\`) || path.Ext(nameOrPath) != "" {
+		data, err := os.ReadFile(nameOrPath)
+		if err != nil {
+			return fixture, err
+		}
+		content, format = data, filepath.Ext(nameOrPath)
+	} else {
+		for _, ext := range []string{".yaml", ".yml", ".json"} {
+			data, err := fixtureFS.ReadFile("fixtures/" + nameOrPath + ext)
+			if err == nil {
+				content, format = data, ext
+				break
+			}
+		}
+		if content == nil {
+			return fixture, fmt.Errorf("unknown fixture set %q (available: %s)", nameOrPath, strings.Join(Sets(), ", "))
+		}
 	}
-	db.Create(&posts)
 
-	tags := []models.Tag{
-		{Name: "Marvel"},
-		{Name: "Superhero"},
-		{Name: "DC"},
+	content = envReference.ReplaceAllFunc(content, func(reference []byte) []byte {
+		return []byte(os.Getenv(string(reference[2 : len(reference)-1])))
+	})
+
+	var err error
+	switch format {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &fixture)
+	case ".json":
+		err = json.Unmarshal(content, &fixture)
+	default:
+		err = fmt.Errorf("unsupported fixture format %q", format)
 	}
-	db.Create(&tags)
-
-	postTags := []models.PostTag{
-		{PostID: posts[0].ID, TagID: tags[0].ID},
-		{PostID: posts[0].ID, TagID: tags[1].ID},
-		{PostID: posts[1].ID, TagID: tags[0].ID},
-		{PostID: posts[1].ID, TagID: tags[1].ID},
-		{PostID: posts[2].ID, TagID: tags[1].ID},
-		{PostID: posts[2].ID, TagID: tags[2].ID},
-		{PostID: posts[3].ID, TagID: tags[1].ID},
-		{PostID: posts[3].ID, TagID: tags[2].ID},
+	if err != nil {
+		return fixture, fmt.Errorf("failed to read %s: %v", nameOrPath, err)
 	}
-	db.Create(&postTags)
 
-	mainComments := []models.Comment{
-		{Message: "Iron Man is my favorite hero!", UserID: users[4].ID, PostID: posts[0].ID},
-		{Message: "Iron Man's tech is amazing!", UserID: users[1].ID, PostID: posts[0].ID},
+	return fixture, nil
+}
+
+// Apply upserts the fixture in a single transaction. Passwords are hashed
+// with passwordParams.
+func Apply(db *gorm.DB, fixture Fixture, passwordParams db_aws.Argon2Params) (Summary, error) {
+	summary := Summary{}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		userIDs := map[string]string{}
+		for _, fixtureUser := range fixture.Users {
+			id, err := upsertUser(tx, fixtureUser, passwordParams)
+			if err != nil {
+				return err
+			}
+			userIDs[fixtureUser.Email] = id
+			summary.Users++
+		}
+
+		userID := func(email string) (string, error) {
+			if id, found := userIDs[email]; found {
+				return id, nil
+			}
+			user := models.User{}
+			if err := tx.Where("email = ?", email).Limit(1).Find(&user).Error; err != nil {
+				return "", err
+			}
+			if user.ID == "" {
+				return "", fmt.Errorf("unknown user %q", email)
+			}
+			userIDs[email] = user.ID
+			return user.ID, nil
+		}
 
-		{Message: "Captain America's shield is iconic!", UserID: users[1].ID, PostID: posts[1].ID},
-		{Message: "His values are unmatched.", UserID: users[2].ID, PostID: posts[1].ID},
+		tagIDs := map[string]string{}
+		tagID := func(name string) (string, error) {
+			if id, found := tagIDs[name]; found {
+				return id, nil
+			}
+			tag := models.Tag{Name: name}
+			if err := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "name"}}, DoNothing: true}).Omit("Posts").Create(&tag).Error; err != nil {
+				return "", err
+			}
+			if err := tx.Where("name = ?", name).First(&tag).Error; err != nil {
+				return "", err
+			}
+			tagIDs[name] = tag.ID
+			return tag.ID, nil
+		}
 
-		{Message: "Batman's dark knight is the best!", UserID: users[4].ID, PostID: posts[2].ID},
-		{Message: "The bat symbol is so iconic!", UserID: users[0].ID, PostID: posts[2].ID},
+		for _, name := range fixture.Tags {
+			if _, err := tagID(name); err != nil {
+				return err
+			}
+			summary.Tags++
+		}
 
-		{Message: "Superman's strength is unmatched!", UserID: users[3].ID, PostID: posts[3].ID},
-		{Message: "He's faster than a speeding bullet!", UserID: users[0].ID, PostID: posts[3].ID},
+		for _, fixturePost := range fixture.Posts {
+			authorID, err := userID(fixturePost.Author)
+			if err != nil {
+				return fmt.Errorf("post %q: %v", fixturePost.Title, err)
+			}
+
+			post := models.Post{}
+			if err := tx.Where("user_id = ? AND title = ?", authorID, fixturePost.Title).Limit(1).Find(&post).Error; err != nil {
+				return err
+			}
+			post.UserID = authorID
+			post.Title = fixturePost.Title
+			post.Body = fixturePost.Body
+			post.Image = fixturePost.Image
+			if err := tx.Omit(clause.Associations).Save(&post).Error; err != nil {
+				return err
+			}
+			summary.Posts++
+
+			for _, name := range fixturePost.Tags {
+				id, err := tagID(name)
+				if err != nil {
+					return err
+				}
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).Create(&models.PostTag{PostID: post.ID, TagID: id}).Error; err != nil {
+					return err
+				}
+			}
+
+			for _, email := range fixturePost.LikedBy {
+				id, err := userID(email)
+				if err != nil {
+					return fmt.Errorf("post %q: %v", fixturePost.Title, err)
+				}
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).Create(&models.PostLike{UserID: id, PostID: post.ID}).Error; err != nil {
+					return err
+				}
+				summary.Likes++
+			}
+
+			if err := applyComments(tx, post.ID, nil, fixturePost.Comments, userID, &summary); err != nil {
+				return fmt.Errorf("post %q: %v", fixturePost.Title, err)
+			}
+		}
+
+		return nil
+	})
+
+	return summary, err
+}
+
+func upsertUser(tx *gorm.DB, fixtureUser User, passwordParams db_aws.Argon2Params) (string, error) {
+	if fixtureUser.Email == "" {
+		return "", errors.New("every user needs an email")
 	}
-	db.Create(&mainComments)
 
-	nestedComments := []models.Comment{
-		{Message: "I agree, his suit is top-notch.", UserID: users[2].ID, PostID: posts[0].ID, ParentID: &mainComments[0].ID},
-		{Message: "He's a genius inventor!", UserID: users[4].ID, PostID: posts[0].ID, ParentID: &mainComments[0].ID},
+	role := fixtureUser.Role
+	if role == "" {
+		role = models.RoleUser
+	}
 
-		{Message: "Best weapon ever!", UserID: users[0].ID, PostID: posts[1].ID, ParentID: &mainComments[2].ID},
-		{Message: "I love his dedication to justice.", UserID: users[3].ID, PostID: posts[1].ID, ParentID: &mainComments[2].ID},
+	user := models.User{}
+	if err := tx.Unscoped().Where("email = ?", fixtureUser.Email).Limit(1).Find(&user).Error; err != nil {
+		return "", err
+	}
 
-		{Message: "He is the best detective!", UserID: users[3].ID, PostID: posts[2].ID, ParentID: &mainComments[4].ID},
-		{Message: "Gotham needs him!", UserID: users[4].ID, PostID: posts[2].ID, ParentID: &mainComments[4].ID},
+	passwordHash := fixtureUser.PasswordHash
+	if fixtureUser.Password != "" {
+		hash, err := db_aws.HashPassword(fixtureUser.Password, passwordParams)
+		if err != nil {
+			return "", err
+		}
+		passwordHash = hash
+	}
 
-		{Message: "Superman's heat vision is incredible.", UserID: users[1].ID, PostID: posts[3].ID, ParentID: &mainComments[6].ID},
-		{Message: "The Man of Steel never gives up.", UserID: users[2].ID, PostID: posts[3].ID, ParentID: &mainComments[6].ID},
+	user.Email = fixtureUser.Email
+	user.FirstName = fixtureUser.FirstName
+	user.LastName = fixtureUser.LastName
+	user.EmailVerified = fixtureUser.EmailVerified
+	user.Role = role
+	user.Image = fixtureUser.Image
+	// Keep the existing password unless the fixture sets one, so that
+	// reseeding does not undo a password changed by hand.
+	if passwordHash != "" {
+		user.HashPassword = passwordHash
 	}
-	db.Create(&nestedComments)
+
+	if err := tx.Unscoped().Omit(clause.Associations).Save(&user).Error; err != nil {
+		return "", fmt.Errorf("user %s: %v", fixtureUser.Email, err)
+	}
+	return user.ID, nil
+}
+
+func applyComments(tx *gorm.DB, postID string, parentID *string, comments []Comment, userID func(string) (string, error), summary *Summary) error {
+	for _, fixtureComment := range comments {
+		authorID, err := userID(fixtureComment.Author)
+		if err != nil {
+			return err
+		}
+
+		comment := models.Comment{}
+		query := tx.Where("post_id = ? AND user_id = ? AND message = ?", postID, authorID, fixtureComment.Message)
+		if parentID == nil {
+			query = query.Where("parent_id IS NULL")
+		} else {
+			query = query.Where("parent_id = ?", *parentID)
+		}
+		if err := query.Limit(1).Find(&comment).Error; err != nil {
+			return err
+		}
+		if comment.ID == "" {
+			comment = models.Comment{PostID: postID, UserID: authorID, ParentID: parentID, Message: fixtureComment.Message}
+			if err := tx.Omit(clause.Associations).Create(&comment).Error; err != nil {
+				return err
+			}
+		}
+		summary.Comments++
+
+		for _, email := range fixtureComment.LikedBy {
+			id, err := userID(email)
+			if err != nil {
+				return err
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).Create(&models.CommentLike{UserID: id, CommentID: comment.ID}).Error; err != nil {
+				return err
+			}
+			summary.Likes++
+		}
+
+		commentID := comment.ID
+		if err := applyComments(tx, postID, &commentID, fixtureComment.Replies, userID, summary); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset empties every application table. It refuses to run unless env is the
+// development environment.
+func Reset(db *gorm.DB, env string) error {
+	if env != config.EnvDevelopment {
+		return errors.New("refusing to reset the database: set APP_ENV=development to allow it")
+	}
+
+	// Everything else references users, posts or tags and is removed by the
+	// cascade.
+	return db.Exec(`TRUNCATE TABLE users, tags, audit_events, o_id_c_states CASCADE`).Error
 }
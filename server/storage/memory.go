@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory keeps objects in a map, for tests. The URLs it returns never expire
+// and cannot be fetched; Get is the only way to read an object back.
+type Memory struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func NewMemory() *Memory {
+	return &Memory{objects: map[string][]byte{}}
+}
+
+func (m *Memory) Store(ctx context.Context, key string, body io.Reader, expires time.Duration) (string, error) {
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read object body: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = content
+
+	return "memory:///" + key, nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	content, found := m.objects[key]
+	if !found {
+		return nil, fmt.Errorf("Failed to get object: %s does not exist", key)
+	}
+	return content, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *Memory) KeyFromURL(rawURL string) string {
+	return strings.TrimPrefix(rawURL, "memory:///")
+}
+
+// Keys lists the stored object keys in no particular order.
+func (m *Memory) Keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]string, 0, len(m.objects))
+	for key := range m.objects {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,17 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Storage holds uploaded media and generated files such as data exports.
+type Storage interface {
+	// Store saves body under key and returns a URL serving it until expires.
+	Store(ctx context.Context, key string, body io.Reader, expires time.Duration) (string, error)
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	// KeyFromURL recovers the key from a URL returned by Store.
+	KeyFromURL(rawURL string) string
+}
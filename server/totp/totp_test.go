@@ -0,0 +1,101 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of RFC 6238 Appendix B, "12345678901234567890".
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+// TestCodeAtRFC6238 checks the SHA-1 vectors of RFC 6238 Appendix B. The RFC
+// lists eight digits; six-digit codes are their last six.
+func TestCodeAtRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, test := range tests {
+		code, err := CodeAt(rfcSecret, Step(time.Unix(test.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != test.want {
+			t.Errorf("T=%d: got %s, want %s", test.unix, code, test.want)
+		}
+	}
+}
+
+func TestValidateWindow(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	codeAt := func(step int64) string {
+		code, err := CodeAt(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	for offset := int64(-skewSteps); offset <= skewSteps; offset++ {
+		step, ok := Validate(rfcSecret, codeAt(current+offset), now)
+		if !ok || step != current+offset {
+			t.Errorf("offset %d: got step %d, %v; want %d", offset, step, ok, current+offset)
+		}
+	}
+
+	for _, offset := range []int64{-skewSteps - 1, skewSteps + 1} {
+		if _, ok := Validate(rfcSecret, codeAt(current+offset), now); ok {
+			t.Errorf("offset %d accepted", offset)
+		}
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	if step, ok := Validate(rfcSecret, " 287 082 ", now); !ok || step != 1 {
+		t.Errorf("spaced code: got step %d, %v", step, ok)
+	}
+	for _, code := range []string{"", "28708", "2870820", "000000"} {
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("code %q accepted", code)
+		}
+	}
+	if _, ok := Validate("not base32!", "287082", now); ok {
+		t.Error("invalid secret accepted")
+	}
+}
+
+// TestValidateReturnsStepForReplayCheck checks the contract callers rely on
+// to reject replays: the same code maps to the same step for as long as it is
+// accepted, so storing the step and refusing steps at or before it makes
+// every code single-use.
+func TestValidateReturnsStepForReplayCheck(t *testing.T) {
+	issued := time.Unix(1234567890, 0)
+	code, err := CodeAt(rfcSecret, Step(issued))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, ok := Validate(rfcSecret, code, issued)
+	if !ok {
+		t.Fatal("code rejected")
+	}
+	later, ok := Validate(rfcSecret, code, issued.Add(Period*time.Second))
+	if !ok {
+		t.Fatal("code rejected one step later")
+	}
+	if later != first {
+		t.Fatalf("replayed code matched step %d, first use matched %d", later, first)
+	}
+}
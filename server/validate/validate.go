@@ -0,0 +1,207 @@
+// Package validate normalizes and checks request bodies against rules declared
+// in struct tags:
+//
+//	Email string   `json:"email" validate:"trim,lower,required,email,max=100"`
+//	Tags  []string `json:"tags" validate:"max=10" each:"trim,required,max=50"`
+//
+// Rules run left to right, so normalizers (trim, lower) must come before the
+// checks that should see their result. The first failing rule of a field is
+// the one reported. Fields are named after their json tag.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// Errors lists the failing fields in declaration order.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fieldErr.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Map returns the messages keyed by field name.
+func (e Errors) Map() map[string]string {
+	fields := make(map[string]string, len(e))
+	for _, fieldErr := range e {
+		fields[fieldErr.Field] = fieldErr.Message
+	}
+	return fields
+}
+
+// Struct normalizes the fields of the struct v points to in place and checks
+// them. It returns Errors if any field fails, and panics on malformed rules.
+func Struct(v interface{}) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validate: expected a pointer to a struct, got %T", v))
+	}
+	value = value.Elem()
+
+	var errs Errors
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		rules, each := field.Tag.Get("validate"), field.Tag.Get("each")
+		if rules == "" && each == "" {
+			continue
+		}
+
+		name := fieldName(field)
+		if message := apply(value.Field(i), name, rules); message != "" {
+			errs = append(errs, FieldError{Field: name, Message: message})
+			continue
+		}
+
+		if each == "" {
+			continue
+		}
+		if value.Field(i).Kind() != reflect.Slice {
+			panic(fmt.Sprintf("validate: each on non-slice field %s", field.Name))
+		}
+		for j := 0; j < value.Field(i).Len(); j++ {
+			itemName := fmt.Sprintf("%s[%d]", name, j)
+			if message := apply(value.Field(i).Index(j), itemName, each); message != "" {
+				errs = append(errs, FieldError{Field: itemName, Message: message})
+				break
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func fieldName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
+
+// apply runs rules on value and returns the message of the first one that
+// fails, or "" if they all pass.
+func apply(value reflect.Value, name string, rules string) string {
+	if rules == "" {
+		return ""
+	}
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			if strings.Contains(","+rules+",", ",required,") {
+				return name + " is required"
+			}
+			return ""
+		}
+		value = value.Elem()
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		rule, arg, _ := strings.Cut(rule, "=")
+
+		switch rule {
+		case "trim":
+			value.SetString(strings.TrimSpace(value.String()))
+		case "lower":
+			value.SetString(strings.ToLower(value.String()))
+		case "omitempty":
+			if value.IsZero() || (value.Kind() == reflect.Slice && value.Len() == 0) {
+				return ""
+			}
+		case "required":
+			if value.IsZero() || (value.Kind() == reflect.Slice && value.Len() == 0) {
+				return name + " is required"
+			}
+		case "min":
+			if size(value) < number(arg) {
+				return fmt.Sprintf("%s must be at least %s", name, describe(value, arg))
+			}
+		case "max":
+			if size(value) > number(arg) {
+				return fmt.Sprintf("%s must be at most %s", name, describe(value, arg))
+			}
+		case "email":
+			if address, err := mail.ParseAddress(value.String()); err != nil || address.Address != value.String() {
+				return name + " must be a valid email address"
+			}
+		case "uuid":
+			if !uuidPattern.MatchString(value.String()) {
+				return name + " must be a valid ID"
+			}
+		case "oneof":
+			options := strings.Split(arg, " ")
+			if !contains(options, value.String()) {
+				return fmt.Sprintf("%s must be one of %s", name, list(options))
+			}
+		default:
+			panic(fmt.Sprintf("validate: unknown rule %q", rule))
+		}
+	}
+	return ""
+}
+
+// size is the length in characters of a string, the number of items of a
+// slice and the value of a number.
+func size(value reflect.Value) int {
+	switch value.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(value.String())
+	case reflect.Slice:
+		return value.Len()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(value.Int())
+	}
+	panic(fmt.Sprintf("validate: cannot measure a %s", value.Kind()))
+}
+
+func describe(value reflect.Value, arg string) string {
+	switch value.Kind() {
+	case reflect.String:
+		return arg + " characters"
+	case reflect.Slice:
+		return arg + " items"
+	}
+	return arg
+}
+
+func number(arg string) int {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		panic(fmt.Sprintf("validate: invalid rule argument %q", arg))
+	}
+	return n
+}
+
+func contains(options []string, s string) bool {
+	for _, option := range options {
+		if option == s {
+			return true
+		}
+	}
+	return false
+}
+
+// list joins options as "a, b or c".
+func list(options []string) string {
+	if len(options) == 1 {
+		return options[0]
+	}
+	return strings.Join(options[:len(options)-1], ", ") + " or " + options[len(options)-1]
+}
@@ -0,0 +1,134 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStruct(t *testing.T) {
+	type body struct {
+		Name   string   `json:"name" validate:"trim,required,min=2,max=5"`
+		Email  string   `json:"email,omitempty" validate:"trim,lower,omitempty,email"`
+		ID     string   `json:"id" validate:"omitempty,uuid"`
+		Role   string   `json:"role" validate:"trim,lower,omitempty,oneof=user moderator admin"`
+		Count  int      `json:"count" validate:"max=10"`
+		Tags   []string `json:"tags" validate:"max=2" each:"trim,lower,required,max=3"`
+		Note   *string  `json:"note" validate:"trim,max=3"`
+		Needed *string  `json:"needed" validate:"required"`
+	}
+
+	valid := func() body {
+		note, needed := " abc ", "x"
+		return body{Name: "ann", Note: &note, Needed: &needed}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(b *body)
+		want   map[string]string
+	}{
+		{"valid", func(b *body) {}, nil},
+		{"required", func(b *body) { b.Name = "" }, map[string]string{"name": "name is required"}},
+		{"trim before required", func(b *body) { b.Name = "   " }, map[string]string{"name": "name is required"}},
+		{"min", func(b *body) { b.Name = "a" }, map[string]string{"name": "name must be at least 2 characters"}},
+		{"max counts characters", func(b *body) { b.Name = "ééééé" }, nil},
+		{"max", func(b *body) { b.Name = "abcdef" }, map[string]string{"name": "name must be at most 5 characters"}},
+		{"email", func(b *body) { b.Email = "not an email" }, map[string]string{"email": "email must be a valid email address"}},
+		{"email with display name", func(b *body) { b.Email = "Ann <ann@example.com>" }, map[string]string{"email": "email must be a valid email address"}},
+		{"uuid", func(b *body) { b.ID = "123" }, map[string]string{"id": "id must be a valid ID"}},
+		{"valid uuid", func(b *body) { b.ID = "6f1c1d4e-6b0b-4a47-9d1e-0c5a7a3f2b11" }, nil},
+		{"oneof", func(b *body) { b.Role = "owner" }, map[string]string{"role": "role must be one of user, moderator or admin"}},
+		{"oneof after lower", func(b *body) { b.Role = " Admin " }, nil},
+		{"max number", func(b *body) { b.Count = 11 }, map[string]string{"count": "count must be at most 10"}},
+		{"max items", func(b *body) { b.Tags = []string{"a", "b", "c"} }, map[string]string{"tags": "tags must be at most 2 items"}},
+		{"each", func(b *body) { b.Tags = []string{"go", " "} }, map[string]string{"tags[1]": "tags[1] is required"}},
+		{"each reports the first item only", func(b *body) { b.Tags = []string{"long", "longer"} }, map[string]string{"tags[0]": "tags[0] must be at most 3 characters"}},
+		{"pointer", func(b *body) { long := "abcd"; b.Note = &long }, map[string]string{"note": "note must be at most 3 characters"}},
+		{"nil pointer", func(b *body) { b.Note = nil }, nil},
+		{"nil required pointer", func(b *body) { b.Needed = nil }, map[string]string{"needed": "needed is required"}},
+		{"several fields", func(b *body) { b.Name = ""; b.Role = "owner" }, map[string]string{
+			"name": "name is required",
+			"role": "role must be one of user, moderator or admin",
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := valid()
+			test.modify(&b)
+
+			err := Struct(&b)
+			if test.want == nil {
+				if err != nil {
+					t.Fatalf("got %v, want no error", err)
+				}
+				return
+			}
+
+			var errs Errors
+			if !errors.As(err, &errs) {
+				t.Fatalf("got %v, want Errors", err)
+			}
+			if !reflect.DeepEqual(errs.Map(), test.want) {
+				t.Fatalf("got %v, want %v", errs.Map(), test.want)
+			}
+		})
+	}
+}
+
+func TestStructNormalizes(t *testing.T) {
+	body := struct {
+		Email string   `json:"email" validate:"trim,lower,email"`
+		Tags  []string `json:"tags" each:"trim,lower"`
+		Note  *string  `json:"note" validate:"trim"`
+	}{Email: "  Ann@Example.COM ", Tags: []string{" Go ", "SQL"}, Note: new(string)}
+	*body.Note = " hi "
+
+	if err := Struct(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Email != "ann@example.com" {
+		t.Errorf("got email %q", body.Email)
+	}
+	if !reflect.DeepEqual(body.Tags, []string{"go", "sql"}) {
+		t.Errorf("got tags %q", body.Tags)
+	}
+	if *body.Note != "hi" {
+		t.Errorf("got note %q", *body.Note)
+	}
+}
+
+func TestStructPanicsOnMalformedRules(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{"unknown rule", &struct {
+			Name string `validate:"requird"`
+		}{}},
+		{"bad argument", &struct {
+			Name string `validate:"max=ten"`
+		}{}},
+		{"each on a string", &struct {
+			Name string `each:"trim"`
+		}{}},
+		{"unmeasurable kind", &struct {
+			Done bool `validate:"max=1"`
+		}{}},
+		{"not a pointer", struct {
+			Name string `validate:"required"`
+		}{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("did not panic")
+				}
+			}()
+			Struct(test.v)
+		})
+	}
+}